@@ -13,29 +13,27 @@ import (
 
 const (
 	meqaDataDir = "meqa_data"
-	algoSimple  = "simple"
-	algoObject  = "object"
-	algoPath    = "path"
-	algoAll     = "all"
 )
 
-var algoList []string = []string{algoSimple, algoObject, algoPath}
-
 func main() {
 	mqutil.Logger = mqutil.NewStdLogger()
 
 	swaggerJSONFile := filepath.Join(meqaDataDir, "swagger.yml")
 	meqaPath := flag.String("d", meqaDataDir, "the directory where we put the generated files")
 	swaggerFile := flag.String("s", swaggerJSONFile, "the swagger.yml file location")
-	algorithm := flag.String("a", "all", "the algorithm - simple, object, path, all")
+	algorithm := flag.String("a", "all", "the algorithm - simple, object, path, negative, random, all")
 	verbose := flag.Bool("v", false, "turn on verbose mode")
 	whitelistFile := flag.String("w", "", "the whitelist.txt file location")
+	options := mqplan.DefaultGenerateOptions()
+	flag.IntVar(&options.Walks, "walks", options.Walks, "the number of test suites the random algorithm generates")
+	flag.IntVar(&options.WalkSteps, "steps", options.WalkSteps, "the number of operations in each test suite of the random algorithm")
+	flag.Int64Var(&options.Seed, "seed", 0, "the seed of the random algorithm, to generate the same test plan again (default a new seed every time)")
 
 	flag.Parse()
-	run(meqaPath, swaggerFile, algorithm, verbose, whitelistFile)
+	run(meqaPath, swaggerFile, algorithm, verbose, whitelistFile, options)
 }
 
-func run(meqaPath *string, swaggerFile *string, algorithm *string, verbose *bool, whitelistFile *string) {
+func run(meqaPath *string, swaggerFile *string, algorithm *string, verbose *bool, whitelistFile *string, options *mqplan.GenerateOptions) {
 	mqutil.Verbose = *verbose
 
 	swaggerJsonPath := *swaggerFile
@@ -44,14 +42,13 @@ func run(meqaPath *string, swaggerFile *string, algorithm *string, verbose *bool
 		os.Exit(1)
 	}
 	whitelistPath := *whitelistFile
-	var whitelist map[string]bool
 	if len(whitelistPath) > 0 {
 		if fi, err := os.Stat(whitelistPath); os.IsNotExist(err) || fi.Mode().IsDir() {
 			fmt.Printf("Can't load whitelist file at the following location %s", whitelistPath)
 			os.Exit(1)
 		}
 		wl, err := mqswag.GetWhitelistSuites(whitelistPath)
-		whitelist = wl
+		options.Whitelist = wl
 		if err != nil {
 			mqutil.Logger.Printf("Error: %s", err.Error())
 			os.Exit(1)
@@ -86,22 +83,14 @@ func run(meqaPath *string, swaggerFile *string, algorithm *string, verbose *bool
 	dag.CheckWeight()
 
 	var plansToGenerate []string
-	if *algorithm == algoAll {
-		plansToGenerate = algoList
+	if *algorithm == mqplan.AlgoAll {
+		plansToGenerate = mqplan.AlgoList
 	} else {
 		plansToGenerate = append(plansToGenerate, *algorithm)
 	}
 
 	for _, algo := range plansToGenerate {
-		var testPlan *mqplan.TestPlan
-		switch algo {
-		case algoPath:
-			testPlan, err = mqplan.GeneratePathTestPlan(swagger, dag, whitelist)
-		case algoObject:
-			testPlan, err = mqplan.GenerateTestPlan(swagger, dag)
-		default:
-			testPlan, err = mqplan.GenerateSimpleTestPlan(swagger, dag)
-		}
+		testPlan, err := mqplan.GenerateTestPlanByAlgorithm(algo, swagger, dag, options)
 		if err != nil {
 			mqutil.Logger.Printf("Error: %s", err.Error())
 			os.Exit(1)
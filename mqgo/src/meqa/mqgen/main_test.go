@@ -1,10 +1,14 @@
 package main
 
 import (
+	"meqa/mqplan"
+	"meqa/mqswag"
 	"meqa/mqutil"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/go-openapi/spec"
 )
 
 func TestMqgen(t *testing.T) {
@@ -14,7 +18,60 @@ func TestMqgen(t *testing.T) {
 	swaggerPath := filepath.Join(meqaPath, "petstore_meqa.yml")
 	algorithm := "all"
 	verbose := false
-	run(&meqaPath, &swaggerPath, &algorithm, &verbose)
+	whitelist := ""
+	run(&meqaPath, &swaggerPath, &algorithm, &verbose, &whitelist, mqplan.DefaultGenerateOptions())
+}
+
+func TestMqgenOpenAPI3(t *testing.T) {
+	mqutil.Logger = mqutil.NewStdLogger()
+	wd, _ := os.Getwd()
+	meqaPath := filepath.Join(wd, "../../../testdata")
+	swaggerPath := filepath.Join(meqaPath, "petstore3_meqa.yml")
+	algorithm := "all"
+	verbose := false
+	whitelist := ""
+	run(&meqaPath, &swaggerPath, &algorithm, &verbose, &whitelist, mqplan.DefaultGenerateOptions())
+
+	swagger, err := mqswag.CreateSwaggerFromURL(swaggerPath, meqaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The servers give the host, the base path and the schemes.
+	if swagger.Host != "petstore.swagger.io" || swagger.BasePath != "/v2" {
+		t.Errorf("unexpected host and base path: %s %s", swagger.Host, swagger.BasePath)
+	}
+	if len(swagger.Schemes) != 2 || swagger.Schemes[0] != "http" || swagger.Schemes[1] != "https" {
+		t.Errorf("unexpected schemes: %v", swagger.Schemes)
+	}
+	// The components/schemas are the definitions.
+	for _, name := range []string{"Pet", "Category", "Tag", "Order", "User"} {
+		if _, ok := swagger.Definitions[name]; !ok {
+			t.Errorf("definition %s is missing", name)
+		}
+	}
+	// The requestBody is the body parameter.
+	op := swagger.Paths.Paths["/pet"].Post
+	if op == nil {
+		t.Fatal("post /pet is missing")
+	}
+	var body *spec.Parameter
+	for i := range op.Parameters {
+		if op.Parameters[i].In == "body" {
+			body = &op.Parameters[i]
+		}
+	}
+	if body == nil {
+		t.Fatalf("post /pet has no body parameter: %v", op.Parameters)
+	}
+	if !body.Required || body.Schema == nil || body.Schema.Ref.String() != "#/definitions/Pet" {
+		t.Errorf("unexpected body parameter of post /pet: %+v", body)
+	}
+	if tag := mqswag.GetMeqaTag(body.Description); tag == nil || tag.Class != "Pet" {
+		t.Errorf("unexpected tag on the body of post /pet: %v", tag)
+	}
+	if len(op.Consumes) == 0 || op.Consumes[0] != "application/json" {
+		t.Errorf("unexpected consumes of post /pet: %v", op.Consumes)
+	}
 }
 
 func TestMain(m *testing.M) {
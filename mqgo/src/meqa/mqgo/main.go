@@ -9,12 +9,15 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
+	"meqa/mqmock"
 	"meqa/mqplan"
 	"meqa/mqswag"
 	"meqa/mqutil"
 	"path/filepath"
 
+	"github.com/go-openapi/spec"
 	uuid "github.com/satori/go.uuid"
 	"gopkg.in/resty.v0"
 	"gopkg.in/yaml.v2"
@@ -27,6 +30,15 @@ const (
 	serverURL   = "https://api.meqa.io"
 )
 
+// The exit codes of the run command.
+const (
+	exitOK             = 0 // all the tests passed
+	exitFailed         = 1 // some tests failed
+	exitSchemaMismatch = 2 // all the tests passed, but some responses don't match the OpenAPI schema
+	exitSetupError     = 3 // the spec or the test plan can't be loaded, or the suite to run doesn't exist
+	exitTeardownFailed = 4 // all the tests passed, but some teardown tests failed
+)
+
 const (
 	configAPIKey       = "api_key"
 	configAcceptedTerm = "terms_accepted"
@@ -68,6 +80,60 @@ func getConfigs(meqaPath string) (map[string]interface{}, error) {
 	return configMap, nil
 }
 
+// getSwaggerMeqaPath returns where the tagged spec is written. The file name is the input swagger spec
+// name + _meqa.yml, if there isn't a _meqa already.
+func getSwaggerMeqaPath(meqaPath string, swaggerPath string) string {
+	_, inputFile := filepath.Split(swaggerPath)
+	return filepath.Join(meqaPath, strings.TrimSuffix(strings.Split(inputFile, ".")[0], "_meqa")+"_meqa.yml")
+}
+
+// generateMeqaLocal tags the spec and generates the test plans on this computer. Nothing is sent to
+// the meqa server.
+func generateMeqaLocal(meqaPath string, swaggerPath string, options *mqplan.GenerateOptions) error {
+	swagger, err := mqswag.CreateSwaggerFromURL(swaggerPath, meqaPath)
+	if err != nil {
+		return err
+	}
+	swagger.AddTags()
+
+	jsonBytes, err := json.Marshal((*spec.Swagger)(swagger))
+	if err != nil {
+		return err
+	}
+	yamlBytes, err := mqutil.JsonToYaml(jsonBytes)
+	if err != nil {
+		return err
+	}
+	swaggerMeqaPath := getSwaggerMeqaPath(meqaPath, swaggerPath)
+	fmt.Printf("Writing tagged swagger spec to: %s\n", swaggerMeqaPath)
+	err = ioutil.WriteFile(swaggerMeqaPath, yamlBytes, 0644)
+	if err != nil {
+		return err
+	}
+
+	dag := mqswag.NewDAG()
+	err = swagger.AddToDAG(dag)
+	if err != nil {
+		return err
+	}
+	dag.Sort()
+	dag.CheckWeight()
+
+	for _, algo := range mqplan.AlgoList {
+		testPlan, err := mqplan.GenerateTestPlanByAlgorithm(algo, swagger, dag, options)
+		if err != nil {
+			return err
+		}
+		planPath := filepath.Join(meqaPath, algo+".yml")
+		fmt.Printf("Writing test suites file to: %s\n", planPath)
+		err = testPlan.DumpToFile(planPath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func generateMeqa(meqaPath string, swaggerPath string) error {
 	caPool := x509.NewCertPool()
 	permCert := `-----BEGIN CERTIFICATE-----
@@ -154,8 +220,26 @@ Do you wish to proceed? y/n: `
 			os.Exit(1)
 		}
 	}
-	if sv := swaggerMap["swagger"]; sv != "2.0" {
-		fmt.Printf("We only support swagger/openapi spec 2.0 right now. Your version is %s\n", sv)
+	if ov, ok := swaggerMap["openapi"].(string); ok && strings.HasPrefix(ov, "3.") {
+		// The server only understands swagger 2.0. Send it the 2.0 equivalent of the OpenAPI 3.0 spec.
+		jsonBytes, err := mqutil.YamlToJson(inputBytes)
+		if err != nil {
+			return err
+		}
+		swagger, err := mqswag.CreateSwaggerFromOpenAPI3(jsonBytes)
+		if err != nil {
+			return err
+		}
+		jsonBytes, err = json.Marshal((*spec.Swagger)(swagger))
+		if err != nil {
+			return err
+		}
+		inputBytes, err = mqutil.JsonToYaml(jsonBytes)
+		if err != nil {
+			return err
+		}
+	} else if sv := swaggerMap["swagger"]; sv != "2.0" {
+		fmt.Printf("We only support swagger spec 2.0 and openapi spec 3.0 right now. Your version is %s\n", sv)
 		os.Exit(1)
 	}
 
@@ -181,9 +265,7 @@ Do you wish to proceed? y/n: `
 		return fmt.Errorf("server call failed, status %d, body:\n%s", resp.StatusCode(), string(resp.Body()))
 	}
 
-	// output file name is the input swagger spec name + _meqa.yml, if there isn't a _meqa already
-	_, inputFile := filepath.Split(swaggerPath)
-	swaggerMeqaPath := filepath.Join(meqaPath, strings.TrimSuffix(strings.Split(inputFile, ".")[0], "_meqa")+"_meqa.yml")
+	swaggerMeqaPath := getSwaggerMeqaPath(meqaPath, swaggerPath)
 	fmt.Printf("Writing tagged swagger spec to: %s\n", swaggerMeqaPath)
 	err = ioutil.WriteFile(swaggerMeqaPath, []byte(respMap["swagger_meqa"].(string)), 0644)
 	if err != nil {
@@ -206,27 +288,82 @@ func main() {
 	genCommand.SetOutput(os.Stdout)
 	runCommand := flag.NewFlagSet("run", flag.ExitOnError)
 	runCommand.SetOutput(os.Stdout)
+	mockCommand := flag.NewFlagSet("mock", flag.ExitOnError)
+	mockCommand.SetOutput(os.Stdout)
+	fuzzCommand := flag.NewFlagSet("fuzz", flag.ExitOnError)
+	fuzzCommand.SetOutput(os.Stdout)
 
 	genMeqaPath := genCommand.String("d", meqaDataDir, "the directory where meqa config, log and output files reside")
 	genSwaggerFile := genCommand.String("s", "", "the OpenAPI (Swagger) spec file path")
-
-	runMeqaPath := runCommand.String("d", meqaDataDir, "the directory where meqa config, log and output files reside")
-	runSwaggerFile := runCommand.String("s", "", "the meqa generated OpenAPI (Swagger) spec file path")
-	testPlanFile := runCommand.String("p", "", "the test plan file name")
-	resultPath := runCommand.String("r", "", "the test result file name (default result.yml in meqa_data dir)")
-	testToRun := runCommand.String("t", "all", "the test to run")
-	username := runCommand.String("u", "", "the username for basic HTTP authentication")
-	password := runCommand.String("w", "", "the password for basic HTTP authentication")
-	apitoken := runCommand.String("a", "", "the api token for bearer HTTP authentication")
-	verbose := runCommand.Bool("v", false, "turn on verbose mode")
+	genLocal := genCommand.Bool("local", false, "tag the spec and generate the test plans locally, without using api.meqa.io")
+	genOptions := mqplan.DefaultGenerateOptions()
+	genCommand.IntVar(&genOptions.Walks, "walks", genOptions.Walks, "the number of test suites the random algorithm generates, with -local")
+	genCommand.IntVar(&genOptions.WalkSteps, "steps", genOptions.WalkSteps, "the number of operations in each test suite of the random algorithm, with -local")
+	genCommand.Int64Var(&genOptions.Seed, "seed", 0, "the seed of the random algorithm, to generate the same test plan again, with -local (default a new seed every time)")
+
+	opts := &runOptions{}
+	runCommand.StringVar(&opts.meqaPath, "d", meqaDataDir, "the directory where meqa config, log and output files reside")
+	runCommand.StringVar(&opts.swaggerFile, "s", "", "the meqa generated OpenAPI (Swagger) spec file path")
+	runCommand.StringVar(&opts.testPlanFile, "p", "", "the test plan file name")
+	runCommand.StringVar(&opts.resultPath, "r", "", "the test result file name (default result.yml in meqa_data dir)")
+	runCommand.StringVar(&opts.testToRun, "t", "all", "the test to run")
+	runCommand.StringVar(&opts.username, "u", "", "the username for basic HTTP authentication")
+	runCommand.StringVar(&opts.password, "w", "", "the password for basic HTTP authentication")
+	runCommand.StringVar(&opts.apitoken, "a", "", "the api token for bearer HTTP authentication")
+	runCommand.BoolVar(&opts.verbose, "v", false, "turn on verbose mode")
+	runCommand.StringVar(&opts.junitPath, "junit", "", "also write the test results to this file in JUnit XML format")
+	runCommand.StringVar(&opts.jsonPath, "json", "", "also write a summary of the test results to this file in JSON format")
+	runCommand.StringVar(&opts.htmlPath, "html", "", "also write a test report to this file as a static HTML page")
+	runCommand.IntVar(&opts.parallel, "parallel", 1, "the number of test suites to run at the same time")
+	runCommand.StringVar(&opts.baseURL, "base-url", "", "send the requests to this URL instead of the one in the spec (e.g. http://localhost:8080/v2)")
+	runCommand.StringVar(&opts.recordPath, "record", "", "record the requests and responses to this file")
+	runCommand.StringVar(&opts.replayPath, "replay", "", "send back the responses recorded in this file instead of calling the server")
+	runCommand.StringVar(&opts.credentialsPath, "credentials", "", "the file with the credentials of the security schemes in the spec")
+	runCommand.StringVar(&opts.secretsPath, "secrets", "", "the file with the values of the ${secret:name} placeholders in the test plan")
+	runCommand.StringVar(&opts.profileName, "profile", "", "the profile in .config.yml to use (base URL, authentication, headers and parameters)")
+	runCommand.Int64Var(&opts.seed, "seed", 0, "the seed of the random parameter values, to send the same requests as an earlier run (default a new seed every run)")
+	runCommand.BoolVar(&opts.cleanup, "cleanup", false, "delete the objects the tests created at the end of the run, latest first")
+	includeSuite := runCommand.String("include-suite", "", "only run the test suites whose names match this regular expression")
+	excludeSuite := runCommand.String("exclude-suite", "", "skip the test suites whose names match this regular expression")
+	includeTest := runCommand.String("include-test", "", "only run the tests whose names match this regular expression")
+	excludeTest := runCommand.String("exclude-test", "", "skip the tests whose names match this regular expression")
+	includeMethod := runCommand.String("include-method", "", "only run the tests of these HTTP methods, separated by commas")
+	excludeMethod := runCommand.String("exclude-method", "", "skip the tests of these HTTP methods, separated by commas")
+	includePath := runCommand.String("include-path", "", "only run the tests of the paths matching these globs, separated by commas (e.g. /pet/**)")
+	excludePath := runCommand.String("exclude-path", "", "skip the tests of the paths matching these globs, separated by commas")
+	includeTag := runCommand.String("include-tag", "", "only run the tests of the operations with these tags in the spec, separated by commas")
+	excludeTag := runCommand.String("exclude-tag", "", "skip the tests of the operations with these tags in the spec, separated by commas")
+
+	mockMeqaPath := mockCommand.String("d", meqaDataDir, "the directory where meqa config, log and output files reside")
+	mockSwaggerFile := mockCommand.String("s", "", "the meqa generated OpenAPI (Swagger) spec file path")
+	mockPort := mockCommand.Int("port", 8080, "the port to serve the mock API on")
+
+	fuzzOpts := &fuzzOptions{}
+	fuzzCommand.StringVar(&fuzzOpts.meqaPath, "d", meqaDataDir, "the directory where meqa config, log and output files reside")
+	fuzzCommand.StringVar(&fuzzOpts.swaggerFile, "s", "", "the meqa generated OpenAPI (Swagger) spec file path")
+	fuzzCommand.DurationVar(&fuzzOpts.duration, "duration", time.Minute, "how long to fuzz the API for (e.g. 10m)")
+	fuzzCommand.DurationVar(&fuzzOpts.timeout, "timeout", 10*time.Second, "how long to wait for a response before reporting a timeout")
+	fuzzCommand.Int64Var(&fuzzOpts.seed, "seed", 0, "the seed of the random requests, to send the same requests as an earlier run (default a new seed every run)")
+	fuzzCommand.StringVar(&fuzzOpts.baseURL, "base-url", "", "send the requests to this URL instead of the one in the spec (e.g. http://localhost:8080/v2)")
+	fuzzCommand.StringVar(&fuzzOpts.credentialsPath, "credentials", "", "the file with the credentials of the security schemes in the spec")
+	fuzzCommand.StringVar(&fuzzOpts.username, "u", "", "the username for basic HTTP authentication")
+	fuzzCommand.StringVar(&fuzzOpts.password, "w", "", "the password for basic HTTP authentication")
+	fuzzCommand.StringVar(&fuzzOpts.apitoken, "a", "", "the api token for bearer HTTP authentication")
+	fuzzCommand.StringVar(&fuzzOpts.outputPath, "o", "", "the directory to save the test plans that reproduce the problems found (default crashes in meqa_data dir)")
 
 	flag.Usage = func() {
-		fmt.Println("Usage: mqgo {generate|run} [options]")
+		fmt.Println("Usage: mqgo {generate|run|mock|fuzz} [options]")
 		fmt.Println("generate: generate test plans to be used by run command")
 		genCommand.PrintDefaults()
 
 		fmt.Println("\nrun: run the tests the in a test plan file")
 		runCommand.PrintDefaults()
+
+		fmt.Println("\nmock: serve a mock of the API in the spec")
+		mockCommand.PrintDefaults()
+
+		fmt.Println("\nfuzz: send malformed requests to the API to find the ones it can't handle")
+		fuzzCommand.PrintDefaults()
 	}
 
 	if len(os.Args) < 2 {
@@ -243,31 +380,38 @@ func main() {
 		swaggerFile = genSwaggerFile
 	case "run":
 		runCommand.Parse(os.Args[2:])
-		meqaPath = runMeqaPath
-		swaggerFile = runSwaggerFile
+		meqaPath = &opts.meqaPath
+		swaggerFile = &opts.swaggerFile
+	case "mock":
+		mockCommand.Parse(os.Args[2:])
+		meqaPath = mockMeqaPath
+		swaggerFile = mockSwaggerFile
+	case "fuzz":
+		fuzzCommand.Parse(os.Args[2:])
+		meqaPath = &fuzzOpts.meqaPath
+		swaggerFile = &fuzzOpts.swaggerFile
 	default:
 		flag.Usage()
 		os.Exit(1)
 	}
 	if len(*swaggerFile) == 0 {
 		fmt.Println("You must use -s option to provide a swagger/openapi yaml spec file. Use -h to see the options")
-		os.Exit(1)
+		os.Exit(exitSetupError)
 	}
 
 	fi, err := os.Stat(*meqaPath)
 	if os.IsNotExist(err) {
 		fmt.Printf("Meqa directory %s doesn't exist.", *meqaPath)
-		os.Exit(1)
+		os.Exit(exitSetupError)
 	}
 	if !fi.Mode().IsDir() {
 		fmt.Printf("Meqa directory %s is not a directory.", *meqaPath)
-		os.Exit(1)
+		os.Exit(exitSetupError)
 	}
 
 	if os.Args[1] == "run" {
-		if len(*resultPath) == 0 {
-			rf := filepath.Join(*meqaPath, resultFile)
-			resultPath = &rf
+		if len(opts.resultPath) == 0 {
+			opts.resultPath = filepath.Join(*meqaPath, resultFile)
 		}
 	}
 
@@ -276,11 +420,15 @@ func main() {
 
 	if _, err := os.Stat(*swaggerFile); os.IsNotExist(err) {
 		fmt.Printf("can't load swagger file at the following location %s", *swaggerFile)
-		os.Exit(1)
+		os.Exit(exitSetupError)
 	}
 
 	if genCommand.Parsed() {
-		err = generateMeqa(*meqaPath, *swaggerFile)
+		if *genLocal {
+			err = generateMeqaLocal(*meqaPath, *swaggerFile, genOptions)
+		} else {
+			err = generateMeqa(*meqaPath, *swaggerFile)
+		}
 		if err != nil {
 			fmt.Printf("got an err:\n%s", err.Error())
 			os.Exit(1)
@@ -288,66 +436,372 @@ func main() {
 		return
 	}
 
-	runMeqa(meqaPath, swaggerFile, testPlanFile, resultPath, testToRun, username, password, apitoken, verbose)
+	if mockCommand.Parsed() {
+		os.Exit(runMock(meqaPath, swaggerFile, mockPort))
+	}
+
+	if fuzzCommand.Parsed() {
+		if len(fuzzOpts.outputPath) == 0 {
+			fuzzOpts.outputPath = filepath.Join(*meqaPath, "crashes")
+		}
+		os.Exit(runFuzz(fuzzOpts))
+	}
+
+	opts.filter = &mqplan.Filter{
+		IncludeSuite:   *includeSuite,
+		ExcludeSuite:   *excludeSuite,
+		IncludeTest:    *includeTest,
+		ExcludeTest:    *excludeTest,
+		IncludeMethods: splitList(*includeMethod),
+		ExcludeMethods: splitList(*excludeMethod),
+		IncludePaths:   splitList(*includePath),
+		ExcludePaths:   splitList(*excludePath),
+		IncludeTags:    splitList(*includeTag),
+		ExcludeTags:    splitList(*excludeTag),
+	}
+	os.Exit(runMeqa(opts))
+}
+
+// splitList splits the comma separated list of an option.
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); len(e) > 0 {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// getExitCode returns the exit code of the run command from the result counts.
+func getExitCode(counts map[string]int) int {
+	if counts[mqutil.Failed] > 0 {
+		return exitFailed
+	}
+	if counts[mqutil.TeardownFailed] > 0 {
+		return exitTeardownFailed
+	}
+	if counts[mqutil.SchemaMismatch] > 0 {
+		return exitSchemaMismatch
+	}
+	return exitOK
+}
+
+// runMock serves the mock API until it's stopped, returns the exit code if it fails to start.
+func runMock(meqaPath *string, swaggerFile *string, port *int) int {
+	swagger, err := mqswag.CreateSwaggerFromURL(*swaggerFile, *meqaPath)
+	if err != nil {
+		mqutil.Logger.Printf("Error: %s", err.Error())
+		fmt.Printf("can't load the swagger spec %s: %s\n", *swaggerFile, mqutil.ErrorMessage(err))
+		return exitSetupError
+	}
+	server := mqmock.NewServer(swagger)
+	fmt.Printf("Serving the mock API on port %d\n", *port)
+	err = server.ListenAndServe(fmt.Sprintf(":%d", *port))
+	fmt.Printf("can't serve the mock API: %s\n", err.Error())
+	return 1
+}
+
+// fuzzOptions are the options of the fuzz command.
+type fuzzOptions struct {
+	meqaPath        string
+	swaggerFile     string
+	duration        time.Duration
+	timeout         time.Duration // how long to wait for a response
+	seed            int64         // 0 for a new seed every run
+	baseURL         string
+	credentialsPath string
+	username        string
+	password        string
+	apitoken        string
+	outputPath      string // the directory of the test plans that reproduce the problems
 }
 
-func runMeqa(meqaPath *string, swaggerFile *string, testPlanFile *string, resultPath *string,
-	testToRun *string, username *string, password *string, apitoken *string, verbose *bool) {
+// runFuzz fuzzes the API in the spec for the duration. Returns exitFailed if it found any problem.
+func runFuzz(opts *fuzzOptions) int {
+	swagger, err := mqswag.CreateSwaggerFromURL(opts.swaggerFile, opts.meqaPath)
+	if err != nil {
+		mqutil.Logger.Printf("Error: %s", err.Error())
+		fmt.Printf("can't load the swagger spec %s: %s\n", opts.swaggerFile, mqutil.ErrorMessage(err))
+		return exitSetupError
+	}
+	mqswag.ObjDB.Init(swagger)
+	dag := mqswag.NewDAG()
+	err = swagger.AddToDAG(dag)
+	if err != nil {
+		fmt.Printf("can't find the dependencies in the swagger spec %s: %s\n", opts.swaggerFile, mqutil.ErrorMessage(err))
+		return exitSetupError
+	}
+	dag.Sort()
+	dag.CheckWeight()
+
+	mqplan.Current.Init(swagger, &mqswag.ObjDB)
+	mqplan.Current.Username = opts.username
+	mqplan.Current.Password = opts.password
+	mqplan.Current.ApiToken = opts.apitoken
+	if len(opts.credentialsPath) > 0 {
+		err = mqplan.Current.LoadCredentialsFromFile(opts.credentialsPath)
+		if err != nil {
+			fmt.Printf("can't load the credentials: %s\n", mqutil.ErrorMessage(err))
+			return exitSetupError
+		}
+	}
+	if len(opts.baseURL) > 0 {
+		mqplan.Current.BaseURL = strings.TrimSuffix(opts.baseURL, "/")
+	}
+
+	resty.SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
+	resty.SetRedirectPolicy(resty.FlexibleRedirectPolicy(15))
+	resty.SetTimeout(opts.timeout)
+
+	randSeed := opts.seed
+	if randSeed == 0 {
+		randSeed = time.Now().UnixNano()
+	}
+	mqplan.Current.SetSeed(randSeed)
+	mqutil.Logger.Printf("seed: %d", randSeed)
+	fmt.Printf("Seed: %d (use -seed %d to send the same requests again)\n", randSeed, randSeed)
 
-	mqutil.Verbose = *verbose
+	findings, err := mqplan.Current.Fuzz(dag, opts.duration, opts.timeout, opts.outputPath)
+	if err != nil {
+		fmt.Printf("can't fuzz the API: %s\n", mqutil.ErrorMessage(err))
+		return exitSetupError
+	}
 
-	if len(*testPlanFile) == 0 {
+	fmt.Print(mqutil.AQUA)
+	fmt.Printf("-----------------------------Findings--------------------------------\n")
+	fmt.Print(mqutil.END)
+	for _, finding := range findings {
+		fmt.Print(mqutil.RED)
+		fmt.Printf("%s: %s %s", finding.Kind, strings.ToUpper(finding.Method), finding.Path)
+		if finding.Status > 0 {
+			fmt.Printf(" status %d", finding.Status)
+		}
+		fmt.Printf(" (%d requests)\n", finding.Count)
+		fmt.Print(mqutil.END)
+		if len(finding.PlanFile) > 0 {
+			fmt.Printf("    reproduce with: mqgo run -s %s -p %s\n", opts.swaggerFile, finding.PlanFile)
+		}
+	}
+	fmt.Print(mqutil.AQUA)
+	fmt.Printf("%d problems found\n", len(findings))
+	fmt.Print(mqutil.END)
+	if len(findings) > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// runOptions are the options of the run command.
+type runOptions struct {
+	meqaPath        string
+	swaggerFile     string
+	testPlanFile    string
+	resultPath      string
+	testToRun       string
+	username        string
+	password        string
+	apitoken        string
+	verbose         bool
+	junitPath       string // the JUnit XML report, none if empty
+	jsonPath        string // the JSON summary, none if empty
+	htmlPath        string // the HTML report, none if empty
+	parallel        int    // the number of test suites run at the same time
+	baseURL         string
+	profileName     string
+	credentialsPath string
+	secretsPath     string
+	recordPath      string
+	replayPath      string
+	seed            int64 // 0 for a new seed every run
+	cleanup         bool
+	filter          *mqplan.Filter
+}
+
+// runMeqa runs the tests and returns the exit code.
+func runMeqa(opts *runOptions) int {
+
+	mqutil.Verbose = opts.verbose
+
+	if len(opts.testPlanFile) == 0 {
 		fmt.Println("You must use -p to specify a test plan file. Use -h to see more options.")
-		return
+		return exitSetupError
 	}
 
-	if _, err := os.Stat(*testPlanFile); os.IsNotExist(err) {
-		fmt.Printf("can't load test plan file at the following location %s", *testPlanFile)
-		return
+	if _, err := os.Stat(opts.testPlanFile); os.IsNotExist(err) {
+		fmt.Printf("can't load test plan file at the following location %s", opts.testPlanFile)
+		return exitSetupError
 	}
 
 	// load swagger.yml
-	swagger, err := mqswag.CreateSwaggerFromURL(*swaggerFile, *meqaPath)
+	swagger, err := mqswag.CreateSwaggerFromURL(opts.swaggerFile, opts.meqaPath)
 	if err != nil {
 		mqutil.Logger.Printf("Error: %s", err.Error())
+		fmt.Printf("can't load the swagger spec %s: %s\n", opts.swaggerFile, mqutil.ErrorMessage(err))
+		return exitSetupError
 	}
 	mqswag.ObjDB.Init(swagger)
+	var dag *mqswag.DAG
+	if opts.cleanup {
+		// The DAG has the operations that delete the objects created.
+		dag = mqswag.NewDAG()
+		err = swagger.AddToDAG(dag)
+		if err != nil {
+			fmt.Printf("can't find the dependencies in the swagger spec %s: %s\n", opts.swaggerFile, mqutil.ErrorMessage(err))
+			return exitSetupError
+		}
+		dag.Sort()
+		dag.CheckWeight()
+	}
 
 	// load test plan
-	mqplan.Current.Username = *username
-	mqplan.Current.Password = *password
-	mqplan.Current.ApiToken = *apitoken
-	err = mqplan.Current.InitFromFile(*testPlanFile, &mqswag.ObjDB)
+	mqplan.Current.Username = opts.username
+	mqplan.Current.Password = opts.password
+	mqplan.Current.ApiToken = opts.apitoken
+	// The profile has the files when the command line doesn't.
+	credentialsPath, secretsPath := opts.credentialsPath, opts.secretsPath
+	if len(opts.profileName) > 0 {
+		p, err := getProfile(opts.meqaPath, opts.profileName)
+		if err != nil {
+			fmt.Printf("can't load the profile %s: %s\n", opts.profileName, mqutil.ErrorMessage(err))
+			return exitSetupError
+		}
+		p.apply(&mqplan.Current)
+		if len(credentialsPath) == 0 && len(p.Credentials) > 0 {
+			cp := p.Credentials
+			if !filepath.IsAbs(cp) {
+				cp = filepath.Join(opts.meqaPath, cp)
+			}
+			credentialsPath = cp
+		}
+		if len(secretsPath) == 0 && len(p.Secrets) > 0 {
+			sp := p.Secrets
+			if !filepath.IsAbs(sp) {
+				sp = filepath.Join(opts.meqaPath, sp)
+			}
+			secretsPath = sp
+		}
+	}
+	if len(credentialsPath) > 0 {
+		err = mqplan.Current.LoadCredentialsFromFile(credentialsPath)
+		if err != nil {
+			fmt.Printf("can't load the credentials: %s\n", mqutil.ErrorMessage(err))
+			return exitSetupError
+		}
+	}
+	if len(secretsPath) > 0 {
+		err = mqplan.Current.LoadSecretsFromFile(secretsPath)
+		if err != nil {
+			fmt.Printf("can't load the secrets: %s\n", mqutil.ErrorMessage(err))
+			return exitSetupError
+		}
+	}
+	if len(opts.baseURL) > 0 {
+		mqplan.Current.BaseURL = strings.TrimSuffix(opts.baseURL, "/")
+	}
+	err = mqplan.Current.InitFromFile(opts.testPlanFile, &mqswag.ObjDB)
 	if err != nil {
 		mqutil.Logger.Printf("Error loading test plan: %s", err.Error())
+		fmt.Printf("can't load the test plan %s: %s\n", opts.testPlanFile, mqutil.ErrorMessage(err))
+		return exitSetupError
+	}
+
+	var cassette *mqplan.Cassette
+	if len(opts.recordPath) > 0 && len(opts.replayPath) > 0 {
+		fmt.Println("-record and -replay can't be used together.")
+		return exitSetupError
+	} else if len(opts.recordPath) > 0 {
+		cassette = mqplan.Current.StartRecording()
+	} else if len(opts.replayPath) > 0 {
+		cassette, err = mqplan.LoadCassette(opts.replayPath)
+		if err == nil {
+			err = mqplan.Current.StartReplay(cassette)
+		}
+		if err != nil {
+			fmt.Printf("can't replay %s: %s\n", opts.replayPath, mqutil.ErrorMessage(err))
+			return exitSetupError
+		}
+		defer mqplan.Current.StopReplay()
 	}
 
 	// for testing, set the config to skip verifying https certificates
 	resty.SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
 	resty.SetRedirectPolicy(resty.FlexibleRedirectPolicy(15))
 
+	randSeed := opts.seed
+	if randSeed == 0 {
+		randSeed = time.Now().UnixNano()
+	}
+	mqplan.Current.SetSeed(randSeed)
+	mqutil.Logger.Printf("seed: %d", randSeed)
+	fmt.Printf("Seed: %d (use -seed %d to generate the same parameters again)\n", randSeed, randSeed)
+
+	if opts.filter != nil {
+		err = mqplan.Current.SetFilter(opts.filter)
+		if err != nil {
+			fmt.Printf("can't filter the tests: %s\n", mqutil.ErrorMessage(err))
+			return exitSetupError
+		}
+	}
+	if opts.cleanup {
+		mqplan.Current.StartCleanup()
+	}
 	mqplan.Current.ResultCounts = make(map[string]int)
-	if *testToRun == "all" {
+	setupFailed := false
+	var suiteNames []string
+	if opts.testToRun == "all" {
 		for _, testSuite := range mqplan.Current.SuiteList {
-			mqutil.Logger.Printf("\n---\nTest suite: %s\n", testSuite.Name)
-			fmt.Printf("\n---\nTest suite: %s\n", testSuite.Name)
-			counts, err := mqplan.Current.Run(testSuite.Name, nil)
-			mqutil.Logger.Printf("err:\n%v", err)
-			for k := range counts {
-				mqplan.Current.ResultCounts[k] += counts[k]
-			}
+			suiteNames = append(suiteNames, testSuite.Name)
 		}
 	} else {
-		mqutil.Logger.Printf("\n---\nTest suite: %s\n", *testToRun)
-		fmt.Printf("\n---\nTest suite: %s\n", *testToRun)
-		counts, err := mqplan.Current.Run(*testToRun, nil)
+		suiteNames = append(suiteNames, opts.testToRun)
+	}
+	suiteCounts, suiteErrs := mqplan.Current.RunSuites(suiteNames, opts.parallel)
+	for i, counts := range suiteCounts {
+		err := suiteErrs[i]
 		mqutil.Logger.Printf("err:\n%v", err)
+		if err != nil && counts[mqutil.Total] == 0 {
+			// The suite doesn't exist or has nothing to run.
+			setupFailed = true
+		}
 		for k := range counts {
 			mqplan.Current.ResultCounts[k] += counts[k]
 		}
 	}
+	if opts.cleanup {
+		mqplan.Current.CleanUp(dag)
+	}
 	mqplan.Current.LogErrors()
 	mqplan.Current.PrintSummary()
-	os.Remove(*resultPath)
-	mqplan.Current.WriteResultToFile(*resultPath)
+	os.Remove(opts.resultPath)
+	mqplan.Current.WriteResultToFile(opts.resultPath)
+	if len(opts.recordPath) > 0 {
+		err = cassette.WriteToFile(opts.recordPath)
+		if err != nil {
+			fmt.Printf("Failed to write the recording to %s: %s\n", opts.recordPath, err.Error())
+		}
+	}
+	if len(opts.junitPath) > 0 {
+		err = mqplan.Current.WriteJUnitToFile(opts.junitPath)
+		if err != nil {
+			fmt.Printf("Failed to write the JUnit report to %s: %s\n", opts.junitPath, err.Error())
+		}
+	}
+	if len(opts.jsonPath) > 0 {
+		err = mqplan.Current.WriteJSONSummaryToFile(opts.jsonPath)
+		if err != nil {
+			fmt.Printf("Failed to write the JSON summary to %s: %s\n", opts.jsonPath, err.Error())
+		}
+	}
+	if len(opts.htmlPath) > 0 {
+		err = mqplan.Current.WriteHTMLToFile(opts.htmlPath)
+		if err != nil {
+			fmt.Printf("Failed to write the HTML report to %s: %s\n", opts.htmlPath, err.Error())
+		}
+	}
+
+	if setupFailed {
+		return exitSetupError
+	}
+	return getExitCode(mqplan.Current.ResultCounts)
 }
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"io/ioutil"
+	"meqa/mqplan"
+	"meqa/mqswag"
 	"meqa/mqutil"
 	"os"
 	"path/filepath"
@@ -10,17 +13,111 @@ import (
 func TestMqgo(t *testing.T) {
 	wd, _ := os.Getwd()
 	meqaPath := filepath.Join(wd, "../../../testdata")
-	swaggerPath := filepath.Join(meqaPath, "petstore_meqa.yml")
-	planPath := filepath.Join(meqaPath, "object.yml")
-	resultPath := filepath.Join(meqaPath, "result.yml")
-	testToRun := "all"
-	username := ""
-	password := ""
-	apitoken := ""
-	verbose := false
+	opts := &runOptions{
+		meqaPath:     meqaPath,
+		swaggerFile:  filepath.Join(meqaPath, "petstore_meqa.yml"),
+		testPlanFile: filepath.Join(meqaPath, "object.yml"),
+		resultPath:   filepath.Join(meqaPath, "result.yml"),
+		testToRun:    "all",
+		parallel:     1,
+	}
 
 	mqutil.Logger = mqutil.NewFileLogger(filepath.Join(meqaPath, "mqgo.log"))
-	runMeqa(&meqaPath, &swaggerPath, &planPath, &resultPath, &testToRun, &username, &password, &apitoken, &verbose)
+	runMeqa(opts)
+}
+
+func TestGenerateLocal(t *testing.T) {
+	wd, _ := os.Getwd()
+	swaggerPath := filepath.Join(wd, "../../../testdata", "petstore.yml")
+	meqaPath, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(meqaPath)
+
+	mqutil.Logger = mqutil.NewStdLogger()
+	err = generateMeqaLocal(meqaPath, swaggerPath, mqplan.DefaultGenerateOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	swagger, err := mqswag.CreateSwaggerFromURL(filepath.Join(meqaPath, "petstore_meqa.yml"), meqaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := swagger.Paths.Paths["/pet/{petId}"].Post
+	if tag := mqswag.GetMeqaTag(op.Description); tag == nil || tag.Class != "Pet" || tag.Operation != mqswag.MethodPut {
+		t.Errorf("unexpected tag on post /pet/{petId}: %v", tag)
+	}
+	if tag := mqswag.GetMeqaTag(op.Parameters[0].Description); tag == nil || tag.Class != "Pet" || tag.Property != "id" {
+		t.Errorf("unexpected tag on petId: %v", tag)
+	}
+	for _, plan := range []string{"simple.yml", "object.yml", "path.yml", "negative.yml", "random.yml"} {
+		if _, err := os.Stat(filepath.Join(meqaPath, plan)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	wd, _ := os.Getwd()
+	meqaPath := filepath.Join(wd, "../../../testdata")
+	resultDir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(resultDir)
+	opts := &runOptions{
+		meqaPath:     meqaPath,
+		swaggerFile:  filepath.Join(meqaPath, "petstore_meqa.yml"),
+		testPlanFile: filepath.Join(meqaPath, "replay.yml"),
+		resultPath:   filepath.Join(resultDir, "result.yml"),
+		testToRun:    "all",
+		parallel:     1,
+		replayPath:   filepath.Join(meqaPath, "replay_cassette.json"),
+	}
+
+	mqutil.Logger = mqutil.NewStdLogger()
+	exitCode := runMeqa(opts)
+	if exitCode != exitFailed {
+		t.Errorf("expected exit code %d, got %d", exitFailed, exitCode)
+	}
+	// The same as when the responses were recorded.
+	counts := mqplan.Current.ResultCounts
+	if counts[mqutil.Total] != 23 || counts[mqutil.Passed] != 20 || counts[mqutil.Failed] != 2 || counts[mqutil.SchemaMismatch] != 2 {
+		t.Errorf("unexpected result counts: %v", counts)
+	}
+}
+
+func TestGetExitCode(t *testing.T) {
+	cases := []struct {
+		counts map[string]int
+		code   int
+	}{
+		{map[string]int{mqutil.Total: 3, mqutil.Passed: 3}, exitOK},
+		{map[string]int{mqutil.Total: 3, mqutil.Passed: 2, mqutil.Skipped: 1}, exitOK},
+		{map[string]int{mqutil.Total: 3, mqutil.Passed: 2, mqutil.SchemaMismatch: 1}, exitSchemaMismatch},
+		{map[string]int{mqutil.Total: 3, mqutil.Passed: 3, mqutil.TeardownFailed: 1, mqutil.SchemaMismatch: 1}, exitTeardownFailed},
+		{map[string]int{mqutil.Total: 3, mqutil.Failed: 1, mqutil.TeardownFailed: 1, mqutil.SchemaMismatch: 1}, exitFailed},
+	}
+	for _, c := range cases {
+		if code := getExitCode(c.counts); code != c.code {
+			t.Errorf("%v: expected exit code %d, got %d", c.counts, c.code, code)
+		}
+	}
+}
+
+func TestRunSetupError(t *testing.T) {
+	wd, _ := os.Getwd()
+	meqaPath := filepath.Join(wd, "../../../testdata")
+	mqutil.Logger = mqutil.NewStdLogger()
+	opts := &runOptions{meqaPath: meqaPath, swaggerFile: filepath.Join(meqaPath, "petstore_meqa.yml"), testToRun: "all", parallel: 1}
+	if code := runMeqa(opts); code != exitSetupError {
+		t.Errorf("without a test plan: expected exit code %d, got %d", exitSetupError, code)
+	}
+	opts.testPlanFile = filepath.Join(meqaPath, "missing.yml")
+	if code := runMeqa(opts); code != exitSetupError {
+		t.Errorf("with a missing test plan: expected exit code %d, got %d", exitSetupError, code)
+	}
 }
 
 func TestMain(m *testing.M) {
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"meqa/mqplan"
+	"meqa/mqutil"
+)
+
+const configProfiles = "profiles"
+
+// profile describes an environment the tests can be run against, e.g.
+//
+//	profiles:
+//	  staging:
+//	    baseURL: https://staging.example.com/v2
+//	    apiToken: abcd
+//	    credentials: staging_credentials.yml
+//	    secrets: staging_secrets.yml
+//	    headers:
+//	      X-Tenant: test
+//	    meqa_init:
+//	      queryParams:
+//	        region: us-west
+type profile struct {
+	BaseURL  string            `yaml:"baseURL,omitempty"`
+	Username string            `yaml:"username,omitempty"`
+	Password string            `yaml:"password,omitempty"`
+	ApiToken string            `yaml:"apiToken,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	MeqaInit mqplan.TestParams `yaml:"meqa_init,omitempty"`
+
+	// The credentials file of the security schemes, relative to the meqa directory.
+	Credentials string `yaml:"credentials,omitempty"`
+	// The secrets file with the values of the ${secret:name} placeholders, relative to the meqa directory.
+	Secrets string `yaml:"secrets,omitempty"`
+}
+
+// getProfile reads the named profile from the config file in the meqa directory.
+func getProfile(meqaPath string, name string) (*profile, error) {
+	configPath := filepath.Join(meqaPath, configFile)
+	configBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("can't read the profiles in %s: %s", configPath, err.Error()))
+	}
+	var config struct {
+		Profiles map[string]*profile `yaml:"profiles"`
+	}
+	err = yaml.Unmarshal(configBytes, &config)
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid %s in %s: %s", configProfiles, configPath, err.Error()))
+	}
+	p := config.Profiles[name]
+	if p == nil {
+		return nil, mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("profile %s not found in %s", name, configPath))
+	}
+	// The body is unmarshaled with map[interface{}]interface{}, make it json like the test plan does.
+	p.MeqaInit.BodyParams, err = mqutil.YamlObjToJsonObj(p.MeqaInit.BodyParams)
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid bodyParams in profile %s: %s", name, err.Error()))
+	}
+	return p, nil
+}
+
+// apply sets the profile on the test plan. The profile only provides the defaults, the authentication
+// options on the command line and the parameters in the test plan take precedence. Like the ones in
+// the test plan, the meqa_init parameters are only used by the operations that take them, while the
+// headers are sent with every request.
+func (p *profile) apply(plan *mqplan.TestPlan) {
+	plan.BaseURL = strings.TrimSuffix(p.BaseURL, "/")
+	if len(plan.Username) == 0 && len(plan.ApiToken) == 0 {
+		plan.Username = p.Username
+		plan.Password = p.Password
+		plan.ApiToken = p.ApiToken
+	}
+	plan.Headers = p.Headers
+	(&plan.TestParams).Copy(&p.MeqaInit)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"meqa/mqplan"
+	"meqa/mqutil"
+)
+
+const testProfiles = `
+profiles:
+  staging:
+    baseURL: %s/v2/
+    apiToken: profile-token
+    headers:
+      X-Tenant: test
+    meqa_init:
+      queryParams:
+        status: sold
+  basic:
+    username: alice
+    password: alice-password
+`
+
+func writeProfiles(t *testing.T, baseURL string) string {
+	meqaPath, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := []byte(fmt.Sprintf(testProfiles, baseURL))
+	if err = ioutil.WriteFile(filepath.Join(meqaPath, configFile), config, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return meqaPath
+}
+
+func TestGetProfile(t *testing.T) {
+	meqaPath := writeProfiles(t, "https://staging.example.com")
+	defer os.RemoveAll(meqaPath)
+
+	p, err := getProfile(meqaPath, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &mqplan.TestPlan{}
+	p.apply(plan)
+	if plan.BaseURL != "https://staging.example.com/v2" {
+		t.Errorf("unexpected base URL %s", plan.BaseURL)
+	}
+	if plan.ApiToken != "profile-token" || plan.Headers["X-Tenant"] != "test" || plan.QueryParams["status"] != "sold" {
+		t.Errorf("the profile isn't applied: %+v", plan)
+	}
+
+	// The authentication on the command line takes precedence.
+	p, err = getProfile(meqaPath, "basic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan = &mqplan.TestPlan{ApiToken: "command-line-token"}
+	p.apply(plan)
+	if plan.ApiToken != "command-line-token" || len(plan.Username) > 0 {
+		t.Errorf("the profile overrode the command line: %+v", plan)
+	}
+
+	if _, err = getProfile(meqaPath, "production"); err == nil {
+		t.Error("expected an error for a missing profile")
+	}
+	if _, err = getProfile(filepath.Join(meqaPath, "missing"), "staging"); err == nil {
+		t.Error("expected an error for a missing config file")
+	}
+}
+
+func TestRunProfile(t *testing.T) {
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	meqaPath := writeProfiles(t, server.URL)
+	defer os.RemoveAll(meqaPath)
+	planPath := filepath.Join(meqaPath, "find.yml")
+	plan := []byte("pets:\n- name: find\n  method: get\n  path: /pet/findByStatus\n")
+	if err := ioutil.WriteFile(planPath, plan, 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+
+	mqutil.Logger = mqutil.NewStdLogger()
+	mqplan.Current = mqplan.TestPlan{}
+	defer func() { mqplan.Current = mqplan.TestPlan{} }()
+	opts := &runOptions{
+		meqaPath:     meqaPath,
+		swaggerFile:  filepath.Join(wd, "../../../testdata/petstore_meqa.yml"),
+		testPlanFile: planPath,
+		resultPath:   filepath.Join(meqaPath, "result.yml"),
+		testToRun:    "all",
+		parallel:     1,
+		profileName:  "staging",
+	}
+	if code := runMeqa(opts); code != exitOK {
+		t.Fatalf("expected exit code %d, got %d", exitOK, code)
+	}
+	if received == nil {
+		t.Fatal("the request wasn't sent to the base URL of the profile")
+	}
+	if received.URL.Path != "/v2/pet/findByStatus" || received.URL.Query().Get("status") != "sold" {
+		t.Errorf("unexpected request %s", received.URL)
+	}
+	if received.Header.Get("X-Tenant") != "test" {
+		t.Errorf("the profile header isn't sent: %v", received.Header)
+	}
+	// findByStatus has its own security scheme, but there are no credentials for it.
+	if received.Header.Get("Authorization") != "Bearer profile-token" {
+		t.Errorf("the profile token isn't sent: %v", received.Header)
+	}
+
+	opts.profileName = "production"
+	if code := runMeqa(opts); code != exitSetupError {
+		t.Errorf("with a missing profile: expected exit code %d, got %d", exitSetupError, code)
+	}
+}
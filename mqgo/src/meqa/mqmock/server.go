@@ -0,0 +1,425 @@
+// Package mqmock serves a mock of the API described by a meqa tagged spec. The objects that are
+// created through the API are kept in a mqswag.DB, so they can be read, updated and deleted later.
+package mqmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-openapi/spec"
+	"github.com/xeipuuv/gojsonschema"
+
+	"meqa/mqplan"
+	"meqa/mqswag"
+	"meqa/mqutil"
+)
+
+type route struct {
+	path     string   // e.g. /pet/{petId}
+	segments []string // the path split by "/"
+	params   int      // the number of path parameters
+	item     *spec.PathItem
+}
+
+// match returns the path parameters if the url path matches the route.
+func (r *route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, s := range r.segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			params[s[1:len(s)-1]] = segments[i]
+		} else if s != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// Server is a http.Handler that serves every path in the spec. The operations are mapped to the DB
+// through the meqa tags: e.g. a post <meqa Pet> stores the Pet in the body, and a get <meqa Pet>
+// returns the Pets that match the parameters tagged with Pet properties. Responses that aren't objects
+// in the DB are made up from the response schemas.
+type Server struct {
+	Swagger *mqswag.Swagger
+
+	db     *mqswag.DB
+	routes []*route
+	mutex  sync.Mutex
+	nextID int64
+}
+
+func NewServer(swagger *mqswag.Swagger) *Server {
+	s := &Server{Swagger: swagger, db: &mqswag.DB{}, nextID: 1}
+	s.db.Init(swagger)
+	for path, item := range swagger.Paths.Paths {
+		itemCopy := item
+		r := &route{path: path, segments: strings.Split(strings.Trim(path, "/"), "/"), item: &itemCopy}
+		r.params = strings.Count(path, "{")
+		s.routes = append(s.routes, r)
+	}
+	// The paths without parameters first, so /pet/findByStatus isn't taken as /pet/{petId}.
+	sort.Slice(s.routes, func(i, j int) bool {
+		if s.routes[i].params != s.routes[j].params {
+			return s.routes[i].params < s.routes[j].params
+		}
+		return s.routes[i].path < s.routes[j].path
+	})
+	return s
+}
+
+// ListenAndServe serves the mock on the address, e.g. :8080.
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s)
+}
+
+// request is what we got from the client.
+type request struct {
+	method   string // the tagged operation, e.g. a post can be tagged as put
+	class    string
+	criteria map[string]interface{} // the path, query and header parameters tagged with the class properties
+	updates  map[string]interface{} // the form parameters tagged with the class properties
+	body     interface{}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// The requests are served one at a time, so an object isn't changed while it's being sent.
+	s.mutex.Lock()
+	status, body := s.serve(req)
+	var bodyBytes []byte
+	var err error
+	if body != nil {
+		bodyBytes, err = json.Marshal(body)
+		if err != nil {
+			status = http.StatusInternalServerError
+			bodyBytes, _ = json.Marshal(errorBody(status, err.Error()))
+		}
+	}
+	s.mutex.Unlock()
+
+	mqutil.Logger.Printf("%s %s - %d", req.Method, req.URL.String(), status)
+	fmt.Printf("%s %s - %d\n", req.Method, req.URL.String(), status)
+	if bodyBytes == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bodyBytes)
+}
+
+func errorBody(status int, message string) map[string]interface{} {
+	return map[string]interface{}{"code": status, "message": message}
+}
+
+func (s *Server) serve(req *http.Request) (int, interface{}) {
+	path := strings.TrimPrefix(req.URL.Path, strings.TrimSuffix(s.Swagger.BasePath, "/"))
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var r *route
+	var pathParams map[string]string
+	for _, candidate := range s.routes {
+		if params, ok := candidate.match(segments); ok {
+			r, pathParams = candidate, params
+			break
+		}
+	}
+	if r == nil {
+		return http.StatusNotFound, errorBody(http.StatusNotFound, fmt.Sprintf("path %s not found", req.URL.Path))
+	}
+	op := mqplan.GetOperationByMethod(r.item, strings.ToLower(req.Method))
+	if op == nil {
+		return http.StatusMethodNotAllowed, errorBody(http.StatusMethodNotAllowed, fmt.Sprintf("%s is not allowed on %s", req.Method, r.path))
+	}
+
+	mr, err := s.parseRequest(req, r, op, pathParams)
+	if err != nil {
+		return http.StatusBadRequest, errorBody(http.StatusBadRequest, mqutil.ErrorMessage(err))
+	}
+	if len(mr.class) == 0 || s.db.GetSchema(mr.class) == nil {
+		return s.respond(op, "", nil)
+	}
+
+	var objects []interface{}
+	switch mr.method {
+	case mqswag.MethodPost:
+		objects = s.create(mr)
+	case mqswag.MethodGet:
+		objects = s.db.Find(mr.class, mr.criteria, nil, matches, -1)
+		if len(objects) == 0 && len(pathParams) > 0 {
+			return http.StatusNotFound, errorBody(http.StatusNotFound, fmt.Sprintf("%s not found", mr.class))
+		}
+	case mqswag.MethodPut, mqswag.MethodPatch:
+		objects = s.update(mr)
+		if len(objects) == 0 {
+			return http.StatusNotFound, errorBody(http.StatusNotFound, fmt.Sprintf("%s not found", mr.class))
+		}
+	case mqswag.MethodDelete:
+		// We never delete everything because the parameters are missing.
+		if len(mr.criteria) == 0 || s.db.Delete(mr.class, mr.criteria, nil, matches, -1) == 0 {
+			return http.StatusNotFound, errorBody(http.StatusNotFound, fmt.Sprintf("%s not found", mr.class))
+		}
+	}
+	return s.respond(op, mr.class, objects)
+}
+
+func (s *Server) parseRequest(req *http.Request, r *route, op *spec.Operation, pathParams map[string]string) (*request, error) {
+	mr := &request{method: strings.ToLower(req.Method), criteria: make(map[string]interface{}), updates: make(map[string]interface{})}
+	params := mqplan.ParamsAdd(append([]spec.Parameter{}, op.Parameters...), r.item.Parameters)
+	if tag := mqswag.GetMeqaTag(op.Description); tag != nil {
+		mr.class = tag.Class
+		if len(tag.Operation) > 0 {
+			mr.method = tag.Operation
+		}
+	}
+	if len(mr.class) == 0 {
+		// Without a tag on the operation, the class is what's in the body, e.g. a list of Users.
+		for _, p := range params {
+			if p.In == "body" && p.Schema != nil {
+				if tag, _ := s.Swagger.GetSchemaRootType((*mqswag.Schema)(p.Schema), mqswag.GetMeqaTag(p.Description)); tag != nil {
+					mr.class = tag.Class
+				}
+			}
+		}
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		req.ParseMultipartForm(32 << 20)
+	} else if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		req.ParseForm()
+	} else {
+		bodyBytes, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if len(bodyBytes) > 0 {
+			err = json.Unmarshal(bodyBytes, &mr.body)
+			if err != nil {
+				return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the body is not valid json: %s", err.Error()))
+			}
+		}
+	}
+
+	for _, p := range params {
+		var value interface{}
+		switch p.In {
+		case "path":
+			value = pathParams[p.Name]
+		case "query":
+			if values, ok := req.URL.Query()[p.Name]; ok {
+				value = paramValue(&p, values)
+			}
+		case "header":
+			if v := req.Header.Get(p.Name); len(v) > 0 {
+				value = v
+			}
+		case "formData":
+			if req.MultipartForm != nil && len(req.MultipartForm.File[p.Name]) > 0 {
+				value = req.MultipartForm.File[p.Name][0].Filename
+			} else if values, ok := req.PostForm[p.Name]; ok {
+				value = paramValue(&p, values)
+			}
+		case "body":
+			value = mr.body
+		}
+		if value == nil {
+			if p.Required {
+				return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the %s parameter %s is missing", p.In, p.Name))
+			}
+			continue
+		}
+		tag := mqswag.GetMeqaTag(p.Description)
+		if tag == nil || tag.Class != mr.class || len(tag.Property) == 0 {
+			continue
+		}
+		if p.In == "formData" {
+			mr.updates[tag.Property] = toType(&p, value)
+		} else if p.In != "body" {
+			mr.criteria[tag.Property] = value
+		}
+	}
+	return mr, nil
+}
+
+// paramValue returns the values of an array parameter as a list, and the value of the others as is.
+func paramValue(p *spec.Parameter, values []string) interface{} {
+	if p.Type != gojsonschema.TYPE_ARRAY {
+		return values[0]
+	}
+	var list []string
+	for _, v := range values {
+		if p.CollectionFormat == "multi" {
+			list = append(list, v)
+		} else {
+			list = append(list, strings.Split(v, ",")...)
+		}
+	}
+	return list
+}
+
+// toType converts the string parameter to the parameter type, so it can be stored with the json objects.
+func toType(p *spec.Parameter, value interface{}) interface{} {
+	str, ok := value.(string)
+	if !ok {
+		return value
+	}
+	switch p.Type {
+	case gojsonschema.TYPE_INTEGER, gojsonschema.TYPE_NUMBER:
+		if f, err := strconv.ParseFloat(str, 64); err == nil {
+			return f
+		}
+	case gojsonschema.TYPE_BOOLEAN:
+		if b, err := strconv.ParseBool(str); err == nil {
+			return b
+		}
+	}
+	return str
+}
+
+// matches checks whether the object has the values in the criteria. The parameters are strings (or lists
+// of strings, any of which can match), so the values are compared as strings.
+func matches(criteria interface{}, existing interface{}) bool {
+	criteriaMap, _ := criteria.(map[string]interface{})
+	existingMap, ok := existing.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for k, v := range criteriaMap {
+		existingValue := fmt.Sprint(existingMap[k])
+		if list, isList := v.([]string); isList {
+			found := false
+			for _, item := range list {
+				if item == existingValue {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		} else if fmt.Sprint(v) != existingValue {
+			return false
+		}
+	}
+	return true
+}
+
+// create stores the objects in the body.
+func (s *Server) create(mr *request) []interface{} {
+	var objects []interface{}
+	if list, ok := mr.body.([]interface{}); ok {
+		objects = list
+	} else if mr.body != nil {
+		objects = []interface{}{mr.body}
+	} else if len(mr.updates) > 0 {
+		objects = []interface{}{mr.updates}
+	}
+	var created []interface{}
+	for _, o := range objects {
+		obj, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		obj = mqutil.MapCombine(obj, mr.updates)
+		s.setID(mr.class, obj)
+		s.db.Insert(mr.class, obj, nil)
+		created = append(created, obj)
+	}
+	return created
+}
+
+// setID gives the object an id if the class has one and the client didn't set it.
+func (s *Server) setID(class string, obj map[string]interface{}) {
+	schema := s.db.GetSchema(class)
+	if schema == nil {
+		return
+	}
+	prop, ok := schema.GetProperties(s.Swagger)["id"]
+	if _, exist := obj["id"]; !ok || exist || len(prop.Type) == 0 {
+		return
+	}
+	if prop.Type[0] == gojsonschema.TYPE_STRING {
+		obj["id"] = strconv.FormatInt(s.nextID, 10)
+	} else {
+		obj["id"] = float64(s.nextID)
+	}
+	s.nextID++
+}
+
+// update updates the objects that match the parameters with the body and the form parameters. Without
+// a parameter to look up the object, we use the id in the body.
+func (s *Server) update(mr *request) []interface{} {
+	newObj, _ := mr.body.(map[string]interface{})
+	patch := mr.method == mqswag.MethodPatch || newObj == nil
+	newObj = mqutil.MapCombine(newObj, mr.updates)
+	criteria := mr.criteria
+	if len(criteria) == 0 {
+		if id, ok := newObj["id"]; ok {
+			criteria = map[string]interface{}{"id": id}
+		} else {
+			return nil
+		}
+	}
+	// Find the objects first, the update can change what they are looked up by.
+	found := s.db.Find(mr.class, criteria, nil, matches, -1)
+	if len(found) == 0 {
+		return nil
+	}
+	s.db.Update(mr.class, criteria, nil, matches, newObj, -1, patch)
+	if patch {
+		return found
+	}
+	return []interface{}{newObj}
+}
+
+// respond sends the success response of the operation. If the response schema is the class, the objects
+// are sent back. Otherwise the response is made up from the schema.
+func (s *Server) respond(op *spec.Operation, class string, objects []interface{}) (int, interface{}) {
+	status := http.StatusOK
+	var schema *spec.Schema
+	if op.Responses != nil {
+		var codes []int
+		for code := range op.Responses.StatusCodeResponses {
+			if code >= 200 && code < 300 {
+				codes = append(codes, code)
+			}
+		}
+		sort.Ints(codes)
+		if len(codes) > 0 {
+			status = codes[0]
+			schema = op.Responses.StatusCodeResponses[status].Schema
+		} else if op.Responses.Default != nil {
+			schema = op.Responses.Default.Schema
+		}
+	}
+	if schema == nil || status == http.StatusNoContent {
+		return status, nil
+	}
+
+	if len(class) > 0 {
+		if referenceName, _, _ := s.Swagger.GetReferredSchema((*mqswag.Schema)(schema)); referenceName == class {
+			if len(objects) > 0 {
+				return status, objects[0]
+			}
+		} else if schema.Items != nil && schema.Items.Schema != nil {
+			if referenceName, _, _ := s.Swagger.GetReferredSchema((*mqswag.Schema)(schema.Items.Schema)); referenceName == class {
+				if objects == nil {
+					objects = []interface{}{}
+				}
+				return status, objects
+			}
+		}
+	}
+	example, err := mqplan.GenerateExample(schema, s.db)
+	if err != nil {
+		return http.StatusInternalServerError, errorBody(http.StatusInternalServerError, mqutil.ErrorMessage(err))
+	}
+	return status, example
+}
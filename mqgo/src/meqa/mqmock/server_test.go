@@ -0,0 +1,108 @@
+package mqmock
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"meqa/mqswag"
+	"meqa/mqutil"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	mqutil.Logger = mqutil.NewStdLogger()
+	dir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	swagger, err := mqswag.CreateSwaggerFromURL(filepath.Join(wd, "../../../testdata/petstore_meqa.yml"), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(NewServer(swagger))
+}
+
+// call sends the request and returns the status and the json body.
+func call(t *testing.T, method string, url string, body string) (int, interface{}) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result interface{}
+	if len(respBytes) > 0 {
+		if err = json.Unmarshal(respBytes, &result); err != nil {
+			t.Fatalf("%s %s: the response is not json: %s", method, url, string(respBytes))
+		}
+	}
+	return resp.StatusCode, result
+}
+
+func TestServer(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	petURL := server.URL + "/v2/pet"
+
+	status, _ := call(t, http.MethodPost, petURL, `{"id": 7, "name": "doggie", "photoUrls": [], "status": "available"}`)
+	if status != http.StatusOK {
+		t.Fatalf("post /pet: expected 200, got %d", status)
+	}
+
+	status, body := call(t, http.MethodGet, petURL+"/7", "")
+	pet, _ := body.(map[string]interface{})
+	if status != http.StatusOK || pet["name"] != "doggie" || pet["id"] != float64(7) {
+		t.Fatalf("get /pet/7: unexpected response %d %v", status, body)
+	}
+
+	status, _ = call(t, http.MethodDelete, petURL+"/7", "")
+	if status != http.StatusOK {
+		t.Fatalf("delete /pet/7: expected 200, got %d", status)
+	}
+	if status, body = call(t, http.MethodGet, petURL+"/7", ""); status != http.StatusNotFound {
+		t.Errorf("get /pet/7 after the delete: expected 404, got %d %v", status, body)
+	}
+	if status, _ = call(t, http.MethodDelete, petURL+"/7", ""); status != http.StatusNotFound {
+		t.Errorf("delete /pet/7 again: expected 404, got %d", status)
+	}
+}
+
+func TestServerInvalidRequest(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	status, body := call(t, http.MethodPost, server.URL+"/v2/pet", `{"name": "doggie",`)
+	if status < 400 || status >= 500 {
+		t.Errorf("post /pet with a broken body: expected a 4xx, got %d", status)
+	}
+	if m, _ := body.(map[string]interface{}); m["code"] != float64(status) || m["message"] == nil {
+		t.Errorf("unexpected error body: %v", body)
+	}
+	// The body is required.
+	if status, _ = call(t, http.MethodPost, server.URL+"/v2/pet", ""); status != http.StatusBadRequest {
+		t.Errorf("post /pet without a body: expected 400, got %d", status)
+	}
+	if status, _ = call(t, http.MethodGet, server.URL+"/v2/unknown", ""); status != http.StatusNotFound {
+		t.Errorf("get /unknown: expected 404, got %d", status)
+	}
+	if status, _ = call(t, http.MethodPatch, server.URL+"/v2/pet", `{}`); status != http.StatusMethodNotAllowed {
+		t.Errorf("patch /pet: expected 405, got %d", status)
+	}
+}
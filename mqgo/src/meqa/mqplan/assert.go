@@ -0,0 +1,354 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/resty.v0"
+
+	"meqa/mqutil"
+)
+
+// The operators of the header and json assertions.
+const (
+	OpEquals   = "equals"
+	OpContains = "contains"
+	OpMatches  = "matches"
+	OpLength   = "length"
+	OpGt       = "gt"
+	OpGte      = "gte"
+	OpLt       = "lt"
+	OpLte      = "lte"
+	OpExists   = "exists"
+)
+
+var assertOps = map[string]bool{OpEquals: true, OpContains: true, OpMatches: true, OpLength: true, OpGt: true,
+	OpGte: true, OpLt: true, OpLte: true, OpExists: true}
+
+// Assertion is the result of checking one of the expect values against the response.
+type Assertion struct {
+	Name     string `json:"name" yaml:"name"` // e.g. header Location matches
+	Expected string `json:"expected" yaml:"expected"`
+	Actual   string `json:"actual" yaml:"actual"`
+	Passed   bool   `json:"passed" yaml:"passed"`
+}
+
+func (a *Assertion) String() string {
+	return fmt.Sprintf("%s %s: got %s", a.Name, a.Expected, a.Actual)
+}
+
+// assertionKeys are the expect keys checked by checkAssertions. They are kept in result.yml.
+var assertionKeys = []string{ExpectHeaders, ExpectMaxLatency, ExpectContentType, ExpectJSON}
+
+// missing is the value of a header or a json path that isn't in the response.
+type missing struct{}
+
+func valueString(v interface{}) string {
+	if _, ok := v.(missing); ok {
+		return "<missing>"
+	}
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	case int, int32, int64, uint, uint32, uint64, float32, float64:
+		return reflect.ValueOf(n).Convert(reflect.TypeOf(float64(0))).Float(), true
+	}
+	return 0, false
+}
+
+// valuesEqual compares the numbers by value, and everything else by their json.
+func valuesEqual(expected interface{}, actual interface{}) bool {
+	if _, ok := actual.(missing); ok {
+		return false
+	}
+	_, expectedIsString := expected.(string)
+	_, actualIsString := actual.(string)
+	if !expectedIsString && !actualIsString {
+		if e, ok := toFloat(expected); ok {
+			a, ok := toFloat(actual)
+			return ok && a == e
+		}
+	}
+	if expectedIsString || actualIsString {
+		return fmt.Sprint(expected) == fmt.Sprint(actual)
+	}
+	eb, _ := json.Marshal(expected)
+	ab, _ := json.Marshal(actual)
+	return string(eb) == string(ab)
+}
+
+// checkOp checks the actual value with the operator. It returns false and the reason if it can't.
+func checkOp(op string, expected interface{}, actual interface{}) (bool, error) {
+	_, isMissing := actual.(missing)
+	if op == OpExists {
+		want, ok := expected.(bool)
+		if !ok {
+			return false, fmt.Errorf("exists takes true or false, not %v", expected)
+		}
+		return want != isMissing, nil
+	}
+	if isMissing {
+		return false, nil
+	}
+	switch op {
+	case OpEquals:
+		return valuesEqual(expected, actual), nil
+	case OpContains:
+		switch a := actual.(type) {
+		case string:
+			return strings.Contains(a, fmt.Sprint(expected)), nil
+		case []interface{}:
+			for _, v := range a {
+				if valuesEqual(expected, v) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			_, ok := a[fmt.Sprint(expected)]
+			return ok, nil
+		}
+		return false, nil
+	case OpMatches:
+		re, err := regexp.Compile(fmt.Sprint(expected))
+		if err != nil {
+			return false, err
+		}
+		if s, ok := actual.(string); ok {
+			return re.MatchString(s), nil
+		}
+		return re.MatchString(valueString(actual)), nil
+	case OpLength:
+		length := -1
+		switch a := actual.(type) {
+		case string:
+			length = len([]rune(a))
+		case []interface{}:
+			length = len(a)
+		case map[string]interface{}:
+			length = len(a)
+		}
+		return length >= 0 && valuesEqual(expected, length), nil
+	case OpGt, OpGte, OpLt, OpLte:
+		e, ok := toFloat(expected)
+		if !ok {
+			return false, fmt.Errorf("%s takes a number, not %v", op, expected)
+		}
+		a, ok := toFloat(actual)
+		if !ok {
+			return false, nil
+		}
+		switch op {
+		case OpGt:
+			return a > e, nil
+		case OpGte:
+			return a >= e, nil
+		case OpLt:
+			return a < e, nil
+		}
+		return a <= e, nil
+	}
+	return false, fmt.Errorf("unknown operator %s", op)
+}
+
+// checkValue checks the actual value against the expected value, which is either a value to be equal
+// to, or a map of operators (e.g. {gt: 0, lt: 100}). It returns an assertion for each operator.
+func checkValue(name string, expected interface{}, actual interface{}) []*Assertion {
+	ops, isMap := expected.(map[string]interface{})
+	if isMap {
+		for op := range ops {
+			if !assertOps[op] {
+				// An object to compare with.
+				isMap = false
+				break
+			}
+		}
+	}
+	if !isMap || len(ops) == 0 {
+		ops = map[string]interface{}{OpEquals: expected}
+	}
+	var names []string
+	for op := range ops {
+		names = append(names, op)
+	}
+	sort.Strings(names)
+
+	var assertions []*Assertion
+	for _, op := range names {
+		a := &Assertion{Name: name + " " + op, Expected: valueString(ops[op]), Actual: valueString(actual)}
+		var err error
+		a.Passed, err = checkOp(op, ops[op], actual)
+		if err != nil {
+			a.Actual = err.Error()
+		}
+		assertions = append(assertions, a)
+	}
+	return assertions
+}
+
+var jsonPathRegex = regexp.MustCompile(`^(\.[^.\[\]]+|\[\d+\]|\[\*\]|\['[^']*'\]|\["[^"]*"\])`)
+
+// JSONPathSelect returns the value at the JSONPath-style path, e.g. $.tags[0].name, or $.items[*].id for
+// the ids of all the items. It returns false if the path isn't in the object.
+func JSONPathSelect(obj interface{}, path string) (interface{}, bool, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	if len(rest) > 0 && rest[0] != '.' && rest[0] != '[' {
+		// e.g. "id" for "$.id"
+		rest = "." + rest
+	}
+	values := []interface{}{obj}
+	projected := false
+	for len(rest) > 0 {
+		token := jsonPathRegex.FindString(rest)
+		if len(token) == 0 {
+			return nil, false, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid json path %s at %s", path, rest))
+		}
+		rest = rest[len(token):]
+		var next []interface{}
+		for _, v := range values {
+			switch {
+			case token == "[*]":
+				projected = true
+				if a, ok := v.([]interface{}); ok {
+					next = append(next, a...)
+				} else if m, ok := v.(map[string]interface{}); ok {
+					var keys []string
+					for k := range m {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+					for _, k := range keys {
+						next = append(next, m[k])
+					}
+				}
+			case token[0] == '[' && token[1] != '\'' && token[1] != '"':
+				i, _ := strconv.Atoi(token[1 : len(token)-1])
+				if a, ok := v.([]interface{}); ok && i < len(a) {
+					next = append(next, a[i])
+				}
+			default:
+				key := strings.TrimPrefix(token, ".")
+				if token[0] == '[' {
+					key = token[2 : len(token)-2]
+				}
+				if m, ok := v.(map[string]interface{}); ok {
+					if value, ok := m[key]; ok {
+						next = append(next, value)
+					}
+				}
+			}
+		}
+		values = next
+	}
+	if projected {
+		if values == nil {
+			values = []interface{}{}
+		}
+		return values, true, nil
+	}
+	if len(values) == 0 {
+		return nil, false, nil
+	}
+	return values[0], true, nil
+}
+
+// evalAssertions checks the response against the headers, maxLatencyMs, contentType and json values of
+// the expect block.
+func (t *Test) evalAssertions(expect map[string]interface{}, resp *resty.Response, resultObj interface{}) []*Assertion {
+	var assertions []*Assertion
+	if headers, ok := expect[ExpectHeaders].(map[string]interface{}); ok {
+		var names []string
+		for name := range headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			var actual interface{} = missing{}
+			if values, ok := resp.Header()[http.CanonicalHeaderKey(name)]; ok {
+				actual = strings.Join(values, ", ")
+			}
+			assertions = append(assertions, checkValue("header "+name, headers[name], actual)...)
+		}
+	}
+	if max := expect[ExpectMaxLatency]; max != nil {
+		latency := float64(t.duration().Nanoseconds()) / 1e6
+		a := &Assertion{Name: ExpectMaxLatency, Expected: valueString(max), Actual: fmt.Sprintf("%.0f", latency)}
+		if m, ok := toFloat(max); ok {
+			a.Passed = latency <= m
+		} else {
+			a.Actual = fmt.Sprintf("%s takes a number, not %v", ExpectMaxLatency, max)
+		}
+		assertions = append(assertions, a)
+	}
+	if contentType := expect[ExpectContentType]; contentType != nil {
+		actual := resp.Header().Get("Content-Type")
+		a := &Assertion{Name: ExpectContentType, Expected: valueString(contentType), Actual: valueString(actual)}
+		expectedType, _, err := mime.ParseMediaType(fmt.Sprint(contentType))
+		actualType, _, _ := mime.ParseMediaType(actual)
+		a.Passed = err == nil && strings.EqualFold(expectedType, actualType)
+		assertions = append(assertions, a)
+	}
+	if paths, ok := expect[ExpectJSON].(map[string]interface{}); ok {
+		var names []string
+		for path := range paths {
+			names = append(names, path)
+		}
+		sort.Strings(names)
+		for _, path := range names {
+			value, found, err := JSONPathSelect(resultObj, path)
+			if err != nil {
+				assertions = append(assertions, &Assertion{Name: "json " + path, Expected: valueString(paths[path]),
+					Actual: mqutil.ErrorMessage(err)})
+				continue
+			}
+			if !found {
+				value = missing{}
+			}
+			assertions = append(assertions, checkValue("json "+path, paths[path], value)...)
+		}
+	}
+	return assertions
+}
+
+// checkAssertions checks the response against the expect values of the test other than the status and
+// the body. Each check is recorded as an assertion. It returns an error if any fails.
+func (t *Test) checkAssertions(resp *resty.Response, resultObj interface{}) error {
+	assertions := t.evalAssertions(t.Expect, resp, resultObj)
+	t.assertions = assertions
+	var failed []string
+	for _, a := range assertions {
+		if a.Passed {
+			fmt.Printf("... checking %s. %vSuccess%v\n", mqutil.MaskSecrets(a.String()), mqutil.GREEN, mqutil.END)
+		} else {
+			fmt.Printf("... checking %s. %vFail%v\n", mqutil.MaskSecrets(a.String()), mqutil.RED, mqutil.END)
+			failed = append(failed, a.Name+" "+a.Expected+", got "+a.Actual)
+		}
+	}
+	if len(failed) > 0 {
+		return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("=== test failed, %d of %d assertions failed:\n%s\n===",
+			len(failed), len(assertions), strings.Join(failed, "\n")))
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"meqa/mqutil"
+)
+
+func TestCheckOp(t *testing.T) {
+	tags := []interface{}{"urgent", json.Number("3")}
+	pet := map[string]interface{}{"name": "doggie"}
+	cases := []struct {
+		op       string
+		expected interface{}
+		actual   interface{}
+		passed   bool
+	}{
+		{OpEquals, 5, json.Number("5.0"), true},
+		{OpEquals, "5", json.Number("5"), true},
+		{OpEquals, "doggie", "kitty", false},
+		{OpEquals, map[string]interface{}{"name": "doggie"}, pet, true},
+		{OpEquals, 1, missing{}, false},
+		{OpContains, "dog", "doggie", true},
+		{OpContains, 3, tags, true},
+		{OpContains, "sold", tags, false},
+		{OpContains, "name", pet, true},
+		{OpMatches, "^dog", "doggie", true},
+		{OpMatches, "^[0-9]+$", json.Number("42"), true},
+		{OpLength, 2, tags, true},
+		{OpLength, 3, "été", true},
+		{OpLength, 1, json.Number("1"), false},
+		{OpGt, 0, json.Number("1"), true},
+		{OpGt, 1, 1, false},
+		{OpGte, 1, "1", true},
+		{OpLt, 1.5, 1, true},
+		{OpLte, 1, json.Number("2"), false},
+		{OpGt, 0, "not a number", false},
+		{OpExists, true, "", true},
+		{OpExists, true, missing{}, false},
+		{OpExists, false, missing{}, true},
+	}
+	for _, c := range cases {
+		if passed, err := checkOp(c.op, c.expected, c.actual); err != nil || passed != c.passed {
+			t.Errorf("%v %s %v: expected %v, got %v %v", c.actual, c.op, c.expected, c.passed, passed, err)
+		}
+	}
+	for _, c := range []struct {
+		op       string
+		expected interface{}
+	}{{OpExists, "yes"}, {OpGt, "many"}, {OpMatches, "("}, {"between", 1}} {
+		if _, err := checkOp(c.op, c.expected, "1"); err == nil {
+			t.Errorf("%s %v: expected an error", c.op, c.expected)
+		}
+	}
+}
+
+func TestCheckValue(t *testing.T) {
+	assertions := checkValue("json $.id", map[string]interface{}{OpGt: 0, OpLt: 10}, json.Number("12"))
+	if len(assertions) != 2 {
+		t.Fatalf("expected 2 assertions, got %v", assertions)
+	}
+	if a := assertions[0]; a.Name != "json $.id gt" || !a.Passed || a.Expected != "0" || a.Actual != "12" {
+		t.Errorf("unexpected assertion %+v", a)
+	}
+	if a := assertions[1]; a.Name != "json $.id lt" || a.Passed {
+		t.Errorf("unexpected assertion %+v", a)
+	}
+
+	// A map that isn't all operators is a value to be equal to.
+	obj := map[string]interface{}{"name": "doggie", "length": 3}
+	assertions = checkValue("json $", obj, obj)
+	if len(assertions) != 1 || assertions[0].Name != "json $ equals" || !assertions[0].Passed {
+		t.Errorf("expected the object to be compared, got %+v", assertions)
+	}
+	if a := checkValue("header Location", "/pet/1", missing{})[0]; a.Passed || a.Actual != "<missing>" {
+		t.Errorf("expected a missing header, got %+v", a)
+	}
+}
+
+func TestJSONPathSelect(t *testing.T) {
+	var obj interface{}
+	json.Unmarshal([]byte(`{"id": 1, "tags": [{"name": "a"}, {"name": "b"}, {"id": 3}],
+		"the name": "doggie", "category": {"id": 2, "name": "dogs"}, "empty": []}`), &obj)
+	cases := []struct {
+		path     string
+		expected interface{}
+		found    bool
+	}{
+		{"$.id", 1.0, true},
+		{"id", 1.0, true},
+		{"$", obj, true},
+		{"$.tags[1].name", "b", true},
+		{"$['the name']", "doggie", true},
+		{`$.category["name"]`, "dogs", true},
+		{"$.tags[*].name", []interface{}{"a", "b"}, true},
+		{"$.category[*]", []interface{}{2.0, "dogs"}, true},
+		{"$.empty[*].id", []interface{}{}, true},
+		{"$.tags[5]", nil, false},
+		{"$.name", nil, false},
+		{"$.id.name", nil, false},
+	}
+	for _, c := range cases {
+		value, found, err := JSONPathSelect(obj, c.path)
+		if err != nil || found != c.found || !reflect.DeepEqual(value, c.expected) {
+			t.Errorf("%s: expected %v %v, got %v %v %v", c.path, c.expected, c.found, value, found, err)
+		}
+	}
+	for _, path := range []string{"$..id", "$.tags[-1]", "$.tags["} {
+		if _, _, err := JSONPathSelect(obj, path); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Rate-Limit", "100")
+		w.Write([]byte(`[{"id": 1, "name": "doggie", "photoUrls": [], "tags": [{"id": 1, "name": "urgent"}]},
+			{"id": 2, "name": "kitty", "photoUrls": []}]`))
+	}))
+	defer server.Close()
+	plan := newTestPlan(t, loadPetstore(t), `
+pets:
+- name: find
+  method: get
+  path: /pet/findByStatus
+  queryParams:
+    status: available
+  expect:
+    status: 200
+    maxLatencyMs: 5000
+    contentType: application/json
+    headers:
+      X-Rate-Limit: "100"
+      Location: {exists: false}
+    json:
+      $[0].id: {gt: 0, lte: 1}
+      $[*].name: {contains: kitty, length: 2}
+      $[0].tags[*].name: {contains: urgent}
+- name: wrong
+  method: get
+  path: /pet/findByStatus
+  queryParams:
+    status: sold
+  expect:
+    contentType: application/xml
+    json:
+      $[1].name: doggie
+      $[2]: {exists: true}
+`, server.URL)
+	plan.SuiteMap["pets"].OnFailure = OnFailureContinue
+	counts, _ := plan.Run("pets", nil)
+	if counts[mqutil.Passed] != 1 || counts[mqutil.Failed] != 1 {
+		t.Fatalf("expected a pass and a failure, got %v", counts)
+	}
+
+	results := make(map[string]*Test)
+	for _, test := range plan.resultList {
+		results[test.Name] = test
+	}
+	find := results["find"]
+	if len(find.assertions) != 9 {
+		t.Errorf("find: expected 9 assertions, got %d", len(find.assertions))
+	}
+	for _, a := range find.assertions {
+		if !a.Passed {
+			t.Errorf("find: %s failed", a)
+		}
+	}
+
+	wrong := results["wrong"]
+	if len(wrong.assertions) != 3 {
+		t.Fatalf("wrong: expected 3 assertions, got %d", len(wrong.assertions))
+	}
+	for _, a := range wrong.assertions {
+		if a.Passed {
+			t.Errorf("wrong: %s passed", a)
+		}
+	}
+	message := mqutil.ErrorMessage(wrong.err)
+	if !strings.Contains(message, "3 of 3 assertions failed") || !strings.Contains(message, `json $[1].name equals "doggie", got "kitty"`) {
+		t.Errorf("wrong: unexpected error %s", message)
+	}
+}
@@ -0,0 +1,160 @@
+package mqplan
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"gopkg.in/resty.v0"
+	"gopkg.in/yaml.v2"
+
+	"meqa/mqswag"
+	"meqa/mqutil"
+)
+
+// The securityDefinitions types.
+const (
+	SecurityBasic  = "basic"
+	SecurityApiKey = "apiKey"
+	SecurityOAuth2 = "oauth2"
+)
+
+// Credential is what's used to authenticate with a security scheme in the spec. Which fields are
+// needed depends on the scheme type:
+//   - basic: username and password
+//   - apiKey: apiKey, which is sent in the header or query parameter named by the scheme. If the
+//     scheme is a bearer token (x-http-scheme: bearer), token can be used instead.
+//   - oauth2: token, the access token. Or clientId and clientSecret to get the tokens from the token
+//     endpoint, plus username and password for the password flow. tokenUrl overrides the one in the spec.
+type Credential struct {
+	Username     string `yaml:"username,omitempty"`
+	Password     string `yaml:"password,omitempty"`
+	ApiKey       string `yaml:"apiKey,omitempty"`
+	Token        string `yaml:"token,omitempty"`
+	ClientID     string `yaml:"clientId,omitempty"`
+	ClientSecret string `yaml:"clientSecret,omitempty"`
+	TokenURL     string `yaml:"tokenUrl,omitempty"`
+}
+
+// LoadCredentialsFromFile reads the credentials file. The file maps the security scheme names in the
+// spec to the credentials, e.g.
+//
+//	api_key:
+//	  apiKey: special-key
+//	petstore_auth:
+//	  token: abcd
+func (plan *TestPlan) LoadCredentialsFromFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("can't read the credentials file %s: %s", path, err.Error()))
+	}
+	credentials := make(map[string]*Credential)
+	err = yaml.Unmarshal(data, &credentials)
+	if err != nil {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid credentials file %s: %s", path, err.Error()))
+	}
+	plan.Credentials = credentials
+	return nil
+}
+
+// securityRequirements returns the security requirements of the operation. Any one of the requirements
+// can be met, and all the schemes in a requirement have to be used.
+func securityRequirements(swagger *mqswag.Swagger, op *spec.Operation) []map[string][]string {
+	// An empty list on the operation means it doesn't need authentication. It's only when the operation
+	// doesn't have the security field that the global one applies.
+	if op != nil && op.Security != nil {
+		return op.Security
+	}
+	return swagger.Security
+}
+
+// findRequirement returns the first requirement that we have the credentials for.
+func (plan *TestPlan) findRequirement(requirements []map[string][]string) map[string][]string {
+	for _, requirement := range requirements {
+		found := true
+		for name := range requirement {
+			if plan.Credentials[name] == nil {
+				found = false
+				break
+			}
+		}
+		if found {
+			return requirement
+		}
+	}
+	return nil
+}
+
+// setSecurity authenticates the request with the security schemes the operation asks for. Returns
+// true if it did, or if the operation doesn't need authentication (security: []). Returns false if the
+// operation doesn't use any of the schemes we have the credentials for.
+func (t *Test) setSecurity(req *resty.Request, plan *TestPlan) (bool, error) {
+	swagger := t.db.Swagger
+	requirements := securityRequirements(swagger, t.op)
+	if requirements != nil && len(requirements) == 0 {
+		return true, nil
+	}
+	if len(plan.Credentials) == 0 {
+		return false, nil
+	}
+	requirement := plan.findRequirement(requirements)
+	if len(requirement) == 0 {
+		return false, nil
+	}
+	var err error
+	for name := range requirement {
+		scheme, ok := swagger.SecurityDefinitions[name]
+		if !ok || scheme == nil {
+			return false, mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("security scheme %s not found in securityDefinitions", name))
+		}
+		cred := plan.Credentials[name]
+		switch scheme.Type {
+		case SecurityBasic:
+			req.SetBasicAuth(cred.Username, cred.Password)
+		case SecurityApiKey:
+			value := cred.ApiKey
+			if httpScheme, _ := scheme.Extensions.GetString(mqswag.ExtHttpScheme); len(httpScheme) > 0 {
+				if len(value) == 0 {
+					value = cred.Token
+				}
+				// e.g. Authorization: Bearer xxx
+				value = strings.Title(httpScheme) + " " + value
+			}
+			// The parameters set by the test take precedence.
+			if scheme.In == "query" {
+				if _, exist := t.QueryParams[scheme.Name]; !exist {
+					req.SetQueryParam(scheme.Name, value)
+				}
+			} else if len(req.Header.Get(scheme.Name)) == 0 {
+				req.SetHeader(scheme.Name, value)
+			}
+		case SecurityOAuth2:
+			token := cred.Token
+			if len(token) == 0 {
+				scopes := requirement[name]
+				token, err = plan.oauth2Tokens.get(name, scheme, cred, scopes)
+				if err != nil {
+					return false, err
+				}
+				if t.oauth2Scopes == nil {
+					t.oauth2Scopes = make(map[string][]string)
+				}
+				t.oauth2Scopes[name] = scopes
+			}
+			req.SetAuthToken(token)
+		default:
+			return false, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("unknown type %s of security scheme %s", scheme.Type, name))
+		}
+	}
+	return true, nil
+}
+
+// invalidateTokens drops the OAuth2 tokens the test got, so the next setSecurity gets new ones.
+// Returns false if the test doesn't use any.
+func (t *Test) invalidateTokens(plan *TestPlan) bool {
+	for name, scopes := range t.oauth2Scopes {
+		plan.oauth2Tokens.invalidate(name, scopes)
+	}
+	return len(t.oauth2Scopes) > 0
+}
@@ -0,0 +1,118 @@
+package mqplan
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-openapi/spec"
+
+	"meqa/mqswag"
+)
+
+// The operations of the petstore use petstore_auth (oauth2) and api_key (apiKey in the header).
+const authSuites = `
+pets:
+- name: find
+  method: get
+  path: /pet/findByStatus
+  queryParams:
+    status: available
+- name: get
+  method: get
+  path: /pet/{petId}
+  pathParams:
+    petId: 1
+`
+
+// sendAuthenticated runs the tests and returns the requests the server got, by path.
+func sendAuthenticated(t *testing.T, swagger *mqswag.Swagger, credentials map[string]*Credential, apiToken string) map[string]*http.Request {
+	received := make(map[string]*http.Request)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received[r.URL.Path] = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	plan := newTestPlan(t, swagger, authSuites, server.URL)
+	plan.Credentials = credentials
+	plan.SuiteMap["pets"].ApiToken = apiToken
+	plan.SuiteMap["pets"].OnFailure = OnFailureContinue
+	plan.Run("pets", nil)
+	if len(received) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(received))
+	}
+	return received
+}
+
+func TestSecurityCredentials(t *testing.T) {
+	swagger := loadPetstore(t)
+	received := sendAuthenticated(t, swagger, map[string]*Credential{
+		"petstore_auth": {Token: "oauth-token"},
+		"api_key":       {ApiKey: "special-key"},
+	}, "")
+	if auth := received["/pet/findByStatus"].Header.Get("Authorization"); auth != "Bearer oauth-token" {
+		t.Errorf("oauth2: unexpected Authorization %s", auth)
+	}
+	get := received["/pet/1"]
+	if key := get.Header.Get("api_key"); key != "special-key" {
+		t.Errorf("apiKey: unexpected api_key header %s", key)
+	}
+	if auth := get.Header.Get("Authorization"); len(auth) > 0 {
+		t.Errorf("apiKey: the oauth2 token is sent too: %s", auth)
+	}
+}
+
+func TestSecurityQueryAndBearer(t *testing.T) {
+	swagger := loadPetstore(t)
+	swagger.SecurityDefinitions["api_key"].In = "query"
+	swagger.SecurityDefinitions["petstore_auth"] = &spec.SecurityScheme{SecuritySchemeProps: spec.SecuritySchemeProps{
+		Type: SecurityApiKey,
+		Name: "Authorization",
+		In:   "header",
+	}}
+	swagger.SecurityDefinitions["petstore_auth"].AddExtension(mqswag.ExtHttpScheme, "bearer")
+	received := sendAuthenticated(t, swagger, map[string]*Credential{
+		"petstore_auth": {Token: "jwt"},
+		"api_key":       {ApiKey: "special-key"},
+	}, "")
+	if auth := received["/pet/findByStatus"].Header.Get("Authorization"); auth != "Bearer jwt" {
+		t.Errorf("bearer: unexpected Authorization %s", auth)
+	}
+	get := received["/pet/1"]
+	if key := get.URL.Query().Get("api_key"); key != "special-key" || len(get.Header.Get("api_key")) > 0 {
+		t.Errorf("apiKey in the query: unexpected request %s %v", get.URL, get.Header)
+	}
+}
+
+func TestSecurityBasic(t *testing.T) {
+	swagger := loadPetstore(t)
+	swagger.SecurityDefinitions["petstore_auth"] = &spec.SecurityScheme{SecuritySchemeProps: spec.SecuritySchemeProps{Type: SecurityBasic}}
+	received := sendAuthenticated(t, swagger, map[string]*Credential{
+		"petstore_auth": {Username: "alice", Password: "alice-password"},
+	}, "")
+	if user, password, ok := received["/pet/findByStatus"].BasicAuth(); !ok || user != "alice" || password != "alice-password" {
+		t.Errorf("basic: unexpected credentials %s %s", user, password)
+	}
+	// There are no credentials for api_key, and none on the command line.
+	if get := received["/pet/1"]; len(get.Header.Get("Authorization")) > 0 || len(get.Header.Get("api_key")) > 0 {
+		t.Errorf("unexpected authentication without credentials: %v", get.Header)
+	}
+}
+
+func TestSecurityFallback(t *testing.T) {
+	swagger := loadPetstore(t)
+	// get /pet/{petId} doesn't need authentication.
+	item := swagger.Paths.Paths["/pet/{petId}"]
+	item.Get.Security = []map[string][]string{}
+	swagger.Paths.Paths["/pet/{petId}"] = item
+
+	// The token on the command line is used when there are no credentials for the operation.
+	received := sendAuthenticated(t, swagger, map[string]*Credential{"api_key": {ApiKey: "special-key"}}, "command-line-token")
+	if auth := received["/pet/findByStatus"].Header.Get("Authorization"); auth != "Bearer command-line-token" {
+		t.Errorf("unexpected Authorization %s", auth)
+	}
+	if get := received["/pet/1"]; len(get.Header.Get("Authorization")) > 0 || len(get.Header.Get("api_key")) > 0 {
+		t.Errorf("security: [] got authentication: %v", get.Header)
+	}
+}
@@ -0,0 +1,256 @@
+package mqplan
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/go-openapi/spec"
+	"github.com/xeipuuv/gojsonschema"
+
+	"meqa/mqutil"
+)
+
+// The ways to generate the parameter values.
+const (
+	GeneratorRandom   = "random"   // random values within the constraints, the default
+	GeneratorBoundary = "boundary" // the values at, just inside and just outside the bounds of the constraints
+)
+
+// boundaryCounts counts the values generated for each parameter, so that the tests go through all the
+// boundary values of a parameter in turn.
+type boundaryCounts struct {
+	counts map[string]int
+	mutex  sync.Mutex
+}
+
+// next returns the index of the next of the n boundary values of the key.
+func (c *boundaryCounts) next(key string, n int) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	i := c.counts[key] % n
+	c.counts[key]++
+	return i
+}
+
+// useBoundary returns whether the test generates the boundary values.
+func (t *Test) useBoundary() bool {
+	return t.Generator == GeneratorBoundary
+}
+
+// nextBoundary picks the next of the values generated for the parameter or property name.
+func (t *Test) nextBoundary(name string, n int) int {
+	key := t.Method + " " + t.Path + " " + name
+	if t.suite != nil && t.suite.plan != nil {
+		return t.suite.plan.boundaryCounts.next(key, n)
+	}
+	return 0
+}
+
+// boundaries returns the values at the bounds, then the ones just inside them, then the ones just
+// outside them. The bounds are moved to the multiples of step when round is true.
+func boundaries(min *float64, max *float64, exclusiveMin bool, exclusiveMax bool, step float64, round bool) []float64 {
+	var low, high []float64
+	if min != nil {
+		v := *min
+		if round {
+			v = math.Ceil(v/step) * step
+		}
+		if exclusiveMin && v <= *min {
+			v += step
+		}
+		low = []float64{v, v + step, v - step}
+	}
+	if max != nil {
+		v := *max
+		if round {
+			v = math.Floor(v/step) * step
+		}
+		if exclusiveMax && v >= *max {
+			v -= step
+		}
+		high = []float64{v, v - step, v + step}
+	}
+	var values []float64
+	seen := make(map[float64]bool)
+	add := func(v float64) {
+		if !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if low != nil {
+			add(low[i])
+		}
+		if high != nil {
+			add(high[i])
+		}
+	}
+	return values
+}
+
+// lengthBoundaries returns the boundary lengths for the min and max length or items.
+func lengthBoundaries(min *int64, max *int64) []int {
+	var minf, maxf *float64
+	if min != nil {
+		f := float64(*min)
+		minf = &f
+	}
+	if max != nil {
+		f := float64(*max)
+		maxf = &f
+	}
+	var lengths []int
+	for _, v := range boundaries(minf, maxf, false, false, 1, true) {
+		if v >= 0 {
+			lengths = append(lengths, int(v))
+		}
+	}
+	return lengths
+}
+
+// boundaryNumber returns the next boundary value of an integer or number schema. It returns false if the
+// schema has no bounds.
+func (t *Test) boundaryNumber(s *spec.Schema, name string) (interface{}, bool) {
+	isInteger := s.Type[0] == gojsonschema.TYPE_INTEGER
+	step := 0.01
+	if isInteger {
+		step = 1
+	}
+	round := isInteger
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		step = *s.MultipleOf
+		round = true
+	}
+	values := boundaries(s.Minimum, s.Maximum, s.ExclusiveMinimum, s.ExclusiveMaximum, step, round)
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		// A multiple if there are no bounds, then a value that isn't a multiple.
+		if len(values) == 0 {
+			values = append(values, step)
+		}
+		if off := notMultipleOffset(step, isInteger); off != 0 {
+			values = append(values, values[0]+off)
+		}
+	}
+	if len(values) == 0 {
+		return nil, false
+	}
+	v := values[t.nextBoundary(name, len(values))]
+	if isInteger {
+		return int64(v), true
+	}
+	return v, true
+}
+
+// notMultipleOffset returns what to add to a multiple of step to get a value that isn't a multiple, or 0
+// if every integer is a multiple.
+func notMultipleOffset(step float64, isInteger bool) float64 {
+	if !isInteger {
+		return step / 2
+	}
+	if step >= 2 {
+		return 1
+	}
+	return 0
+}
+
+// boundaryString returns a string of the next boundary length. It returns false if the schema has no
+// length constraints. The strings with a pattern or a format are left to the random generator, as cutting
+// them to length would break the pattern or the format instead of testing the length.
+func (t *Test) boundaryString(s *spec.Schema, name string) (interface{}, bool, error) {
+	if len(s.Pattern) > 0 || (len(s.Format) > 0 && s.Format != "password") {
+		return nil, false, nil
+	}
+	lengths := lengthBoundaries(s.MinLength, s.MaxLength)
+	if len(lengths) == 0 {
+		return nil, false, nil
+	}
+	length := lengths[t.nextBoundary(name, len(lengths))]
+	str, err := generateString(s, name, t.baseTime(), t.random())
+	if err != nil {
+		return nil, true, err
+	}
+	if len(str) == 0 {
+		str = "a"
+	}
+	for len(str) < length {
+		str += str
+	}
+	return str[:length], true, nil
+}
+
+// boundaryEnum returns the first, the last, then a value that isn't in the enum.
+func (t *Test) boundaryEnum(e []interface{}, name string) interface{} {
+	values := []interface{}{e[0]}
+	if len(e) > 1 {
+		values = append(values, e[len(e)-1])
+	}
+	if _, isString := e[0].(string); isString {
+		values = append(values, stringNotInEnum(e))
+	} else {
+		values = append(values, largestNumber(e)+1)
+	}
+	return values[t.nextBoundary(name, len(values))]
+}
+
+// boundaryValue generates the next boundary value for the primitive schema, if the test uses the
+// boundary generator and the schema has constraints. The other values are generated randomly.
+func (t *Test) boundaryValue(s *spec.Schema, name string) (interface{}, bool, error) {
+	if !t.useBoundary() {
+		return nil, false, nil
+	}
+	switch s.Type[0] {
+	case gojsonschema.TYPE_INTEGER, gojsonschema.TYPE_NUMBER:
+		v, ok := t.boundaryNumber(s, name)
+		return v, ok, nil
+	case gojsonschema.TYPE_STRING:
+		return t.boundaryString(s, name)
+	}
+	return nil, false, nil
+}
+
+// generateEnum picks one of the enum values, or the next boundary one when the test uses the boundary
+// generator.
+func (t *Test) generateEnum(e []interface{}, name string) (interface{}, error) {
+	if t.useBoundary() {
+		return t.boundaryEnum(e, name), nil
+	}
+	return generateEnum(e, t.random())
+}
+
+// boundaryItems returns the next boundary number of items of the array. It returns false if the test
+// doesn't use the boundary generator or the array has no min or max items.
+func (t *Test) boundaryItems(s *spec.Schema, name string) (int, bool) {
+	if !t.useBoundary() {
+		return 0, false
+	}
+	lengths := lengthBoundaries(s.MinItems, s.MaxItems)
+	if len(lengths) == 0 {
+		return 0, false
+	}
+	return lengths[t.nextBoundary(name+"[]", len(lengths))], true
+}
+
+// boundaryDuplicate breaks the uniqueItems constraint every other time, by adding a copy of the first
+// item to the array.
+func (t *Test) boundaryDuplicate(s *spec.Schema, name string, ar []interface{}) []interface{} {
+	if !t.useBoundary() || !s.UniqueItems || len(ar) == 0 {
+		return ar
+	}
+	if t.nextBoundary(name+"[unique]", 2) == 1 {
+		return append(ar, ar[0])
+	}
+	return ar
+}
+
+// validGenerator checks the name of the generator.
+func validGenerator(name string) error {
+	if len(name) == 0 || name == GeneratorRandom || name == GeneratorBoundary {
+		return nil
+	}
+	return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("unknown generator %s, it can be %s or %s", name, GeneratorRandom, GeneratorBoundary))
+}
@@ -0,0 +1,167 @@
+package mqplan
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+// newBoundaryTest returns a test of post /pet that uses the boundary generator.
+func newBoundaryTest() *Test {
+	return &Test{Name: "boundary", Method: "post", Path: "/pet", Generator: GeneratorBoundary, suite: &TestSuite{plan: &TestPlan{}}}
+}
+
+// boundarySequence returns the next n values the generator picks for the schema.
+func boundarySequence(t *testing.T, test *Test, s *spec.Schema, n int) []interface{} {
+	var values []interface{}
+	for i := 0; i < n; i++ {
+		v, found, err := test.boundaryValue(s, "count")
+		if err != nil || !found {
+			t.Fatalf("no boundary value: %v", err)
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+func TestBoundaryNumber(t *testing.T) {
+	test := newBoundaryTest()
+	s := spec.Int32Property().WithMinimum(1, false).WithMaximum(10, true)
+	// At, just inside and just outside the bounds, then around again.
+	expected := []interface{}{int64(1), int64(9), int64(2), int64(8), int64(0), int64(10), int64(1)}
+	if values := boundarySequence(t, test, s, 7); !reflect.DeepEqual(values, expected) {
+		t.Errorf("integer: expected %v, got %v", expected, values)
+	}
+
+	// The numbers move by a hundredth.
+	s = spec.Float64Property().WithMinimum(0.5, true)
+	expected = []interface{}{0.51, 0.52, 0.5}
+	if values := boundarySequence(t, newBoundaryTest(), s, 3); !reflect.DeepEqual(values, expected) {
+		t.Errorf("number: expected %v, got %v", expected, values)
+	}
+
+	// Without bounds the values are random.
+	if _, found, _ := test.boundaryValue(spec.Int64Property(), "count"); found {
+		t.Error("expected no boundary value without bounds")
+	}
+	test.Generator = GeneratorRandom
+	if _, found, _ := test.boundaryValue(s, "count"); found {
+		t.Error("the random generator picked a boundary value")
+	}
+}
+
+func TestBoundaryMultipleOf(t *testing.T) {
+	// The bounds move to the multiples, then a value that isn't a multiple.
+	s := spec.Int32Property().WithMinimum(1, false).WithMaximum(20, false).WithMultipleOf(5)
+	expected := []interface{}{int64(5), int64(20), int64(10), int64(15), int64(0), int64(25), int64(6)}
+	if values := boundarySequence(t, newBoundaryTest(), s, 7); !reflect.DeepEqual(values, expected) {
+		t.Errorf("integer: expected %v, got %v", expected, values)
+	}
+
+	// Without bounds, a multiple and a value that isn't one.
+	s = spec.Float64Property().WithMultipleOf(0.5)
+	expected = []interface{}{0.5, 0.75}
+	if values := boundarySequence(t, newBoundaryTest(), s, 2); !reflect.DeepEqual(values, expected) {
+		t.Errorf("number: expected %v, got %v", expected, values)
+	}
+
+	// Every integer is a multiple of 1.
+	s = spec.Int32Property().WithMultipleOf(1)
+	expected = []interface{}{int64(1), int64(1)}
+	if values := boundarySequence(t, newBoundaryTest(), s, 2); !reflect.DeepEqual(values, expected) {
+		t.Errorf("multiple of 1: expected %v, got %v", expected, values)
+	}
+}
+
+func TestBoundaryString(t *testing.T) {
+	test := newBoundaryTest()
+	s := spec.StringProperty().WithMinLength(2).WithMaxLength(4)
+	var lengths []int
+	for i := 0; i < 6; i++ {
+		v, found, err := test.boundaryValue(s, "name")
+		if err != nil || !found {
+			t.Fatalf("no boundary value: %v", err)
+		}
+		lengths = append(lengths, len(v.(string)))
+	}
+	if expected := []int{2, 4, 3, 1, 5, 2}; !reflect.DeepEqual(lengths, expected) {
+		t.Errorf("expected the lengths %v, got %v", expected, lengths)
+	}
+
+	// The strings with a pattern or a format are generated randomly.
+	pattern := spec.StringProperty().WithMinLength(2).WithPattern("^[a-z]+$")
+	email := spec.StringProperty().WithMinLength(2)
+	email.Format = "email"
+	for _, s := range []*spec.Schema{pattern, email} {
+		if _, found, err := test.boundaryValue(s, "name"); found || err != nil {
+			t.Errorf("expected no boundary value for %v, got %v", s, err)
+		}
+	}
+	password := spec.StringProperty().WithMaxLength(8)
+	password.Format = "password"
+	if _, found, _ := test.boundaryValue(password, "name"); !found {
+		t.Error("expected a boundary value for a password")
+	}
+}
+
+func TestBoundaryEnum(t *testing.T) {
+	test := newBoundaryTest()
+	var values []interface{}
+	for i := 0; i < 3; i++ {
+		v, _ := test.generateEnum([]interface{}{"available", "pending", "sold"}, "status")
+		values = append(values, v)
+	}
+	if expected := []interface{}{"available", "sold", "not_in_enum"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("string: expected %v, got %v", expected, values)
+	}
+	values = nil
+	for i := 0; i < 2; i++ {
+		v, _ := test.generateEnum([]interface{}{3}, "level")
+		values = append(values, v)
+	}
+	if expected := []interface{}{3, 4.0}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("number: expected %v, got %v", expected, values)
+	}
+}
+
+func TestBoundaryItems(t *testing.T) {
+	test := newBoundaryTest()
+	s := spec.ArrayProperty(spec.StringProperty()).WithMinItems(1).WithMaxItems(3)
+	var lengths []int
+	for i := 0; i < 6; i++ {
+		n, found := test.boundaryItems(s, "tags")
+		if !found {
+			t.Fatal("no boundary item count")
+		}
+		lengths = append(lengths, n)
+	}
+	if expected := []int{1, 3, 2, 0, 4, 1}; !reflect.DeepEqual(lengths, expected) {
+		t.Errorf("expected the item counts %v, got %v", expected, lengths)
+	}
+
+	// uniqueItems is broken every other time.
+	s = spec.ArrayProperty(spec.StringProperty()).UniqueValues()
+	ar := []interface{}{"a", "b"}
+	if got := test.boundaryDuplicate(s, "tags", ar); len(got) != 2 {
+		t.Errorf("expected the items unchanged first, got %v", got)
+	}
+	if got := test.boundaryDuplicate(s, "tags", ar); !reflect.DeepEqual(got, []interface{}{"a", "b", "a"}) {
+		t.Errorf("expected a duplicate the second time, got %v", got)
+	}
+	test.Generator = ""
+	if got := test.boundaryDuplicate(s, "tags", ar); len(got) != 2 {
+		t.Errorf("the random generator added a duplicate: %v", got)
+	}
+}
+
+func TestValidGenerator(t *testing.T) {
+	for _, name := range []string{"", GeneratorRandom, GeneratorBoundary} {
+		if err := validGenerator(name); err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+	if err := validGenerator("fuzz"); err == nil {
+		t.Error("expected an error for an unknown generator")
+	}
+}
@@ -0,0 +1,165 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"gopkg.in/resty.v0"
+
+	"meqa/mqutil"
+)
+
+// The header that tells the replay server which recorded response to send back.
+const replayHeader = "X-Meqa-Replay"
+
+type RecordedResponse struct {
+	StatusCode int                 `json:"statusCode"`
+	Status     string              `json:"status"`
+	Header     map[string][]string `json:"header,omitempty"`
+	Body       string              `json:"body"`
+}
+
+// Interaction is a request sent by a test and the response the server sent back. The parameters are the
+// ones the test resolved, so when replaying the test uses them again instead of generating new ones.
+type Interaction struct {
+	Suite    string            `json:"suite"`
+	Test     string            `json:"test"`
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	URL      string            `json:"url"`
+	Params   TestParams        `json:"params"`
+	Response *RecordedResponse `json:"response,omitempty"`
+	Error    string            `json:"error,omitempty"` // the test failed without a response
+}
+
+func (i *Interaction) key() string {
+	return i.Suite + " " + i.Test + " " + i.Method + " " + i.Path
+}
+
+// Cassette holds the interactions of a run, in the order they happened.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+
+	mutex    sync.Mutex
+	replayed map[string]int // for each key, how many of the interactions have been replayed
+	listener net.Listener
+}
+
+func testKey(t *Test) string {
+	return (&Interaction{Suite: t.suiteName(), Test: t.Name, Method: t.Method, Path: t.Path}).key()
+}
+
+// record adds the request the test sent and the response it got.
+func (c *Cassette) record(t *Test, resp *resty.Response, err error) {
+	i := &Interaction{Suite: t.suiteName(), Test: t.Name, Method: t.Method, Path: t.Path, URL: t.url}
+	i.Params.Copy(&t.TestParams)
+	if err != nil {
+		i.Error = mqutil.ErrorMessage(err)
+	} else {
+		i.Response = &RecordedResponse{resp.StatusCode(), resp.Status(), resp.Header(), string(resp.Body())}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Interactions = append(c.Interactions, i)
+}
+
+// next returns the index of the next recorded interaction of the test. The tests are matched by the
+// suite, the name, the method and the path, in the order they were recorded.
+func (c *Cassette) next(t *Test) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := testKey(t)
+	skip := c.replayed[key]
+	for index, i := range c.Interactions {
+		if i.key() != key {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		c.replayed[key]++
+		return index, nil
+	}
+	return -1, mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("no recorded response left for test %s: %s %s", t.Name, t.Method, t.Path))
+}
+
+// ServeHTTP sends back the recorded response of the interaction in the replay header.
+func (c *Cassette) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	index, err := strconv.Atoi(req.Header.Get(replayHeader))
+	if err != nil || index < 0 || index >= len(c.Interactions) || c.Interactions[index].Response == nil {
+		http.Error(w, fmt.Sprintf("invalid %s header: %s", replayHeader, req.Header.Get(replayHeader)), http.StatusInternalServerError)
+		return
+	}
+	resp := c.Interactions[index].Response
+	for k, v := range resp.Header {
+		if k != "Content-Length" && k != "Transfer-Encoding" {
+			w.Header()[k] = v
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write([]byte(resp.Body))
+}
+
+// LoadCassette reads the interactions recorded in the file.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("can't read the cassette %s: %s", path, err.Error()))
+	}
+	c := &Cassette{}
+	err = json.Unmarshal(data, c)
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid cassette %s: %s", path, err.Error()))
+	}
+	return c, nil
+}
+
+// WriteToFile writes the interactions to the file in JSON.
+func (c *Cassette) WriteToFile(path string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(mqutil.MaskSecrets(string(data))), 0644)
+}
+
+// StartRecording makes the plan record the requests and responses of the tests that are run.
+func (plan *TestPlan) StartRecording() *Cassette {
+	plan.recording = &Cassette{}
+	return plan.recording
+}
+
+// StartReplay makes the tests get the responses from the cassette instead of the server. The responses
+// are served on a local port, so that they go through the same client code as the real ones.
+func (plan *TestPlan) StartReplay(c *Cassette) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return mqutil.NewError(mqutil.ErrInternal, fmt.Sprintf("can't start the replay server: %s", err.Error()))
+	}
+	c.listener = listener
+	c.replayed = make(map[string]int)
+	go http.Serve(listener, c)
+
+	plan.replaying = c
+	plan.BaseURL = "http://" + listener.Addr().String()
+	if plan.swagger != nil {
+		plan.BaseURL += plan.swagger.BasePath
+	}
+	return nil
+}
+
+// StopReplay stops serving the recorded responses.
+func (plan *TestPlan) StopReplay() {
+	if plan.replaying != nil {
+		plan.replaying.listener.Close()
+		plan.replaying = nil
+	}
+}
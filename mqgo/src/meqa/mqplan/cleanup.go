@@ -0,0 +1,133 @@
+package mqplan
+
+import (
+	"fmt"
+	"sync"
+
+	"meqa/mqswag"
+	"meqa/mqutil"
+)
+
+// MeqaCleanup is the test suite of the deletes run after all the others to clean up the objects created.
+const MeqaCleanup = "meqa_cleanup"
+
+// createdObject is an object the tests created on the server.
+type createdObject struct {
+	className    string
+	object       map[string]interface{}
+	associations map[string]map[string]interface{}
+}
+
+// cleanupList has the objects created during the run that are still on the server, in the order
+// they were created.
+type cleanupList struct {
+	objects []*createdObject
+	mutex   sync.Mutex
+}
+
+func (c *cleanupList) add(className string, obj interface{}, associations map[string]map[string]interface{}) {
+	objMap, ok := obj.(map[string]interface{})
+	if !ok {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.objects = append(c.objects, &createdObject{className, objMap, associations})
+}
+
+// matches returns whether the object has the values of the criteria. Unlike mqutil.InterfaceEquals, the
+// numbers are compared by value, so that deleting one object doesn't forget the others of its class.
+func matches(criteria interface{}, obj map[string]interface{}) bool {
+	m, ok := criteria.(map[string]interface{})
+	if !ok {
+		return mqutil.InterfaceEquals(criteria, obj)
+	}
+	for k, v := range m {
+		n, isNumber := exprNumber(v)
+		existing, existingIsNumber := exprNumber(obj[k])
+		if isNumber && existingIsNumber {
+			f, _ := toFloat(n)
+			e, _ := toFloat(existing)
+			if f != e {
+				return false
+			}
+			continue
+		}
+		if !mqutil.InterfaceEquals(v, obj[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// remove forgets the objects of the class that match the criteria, as the tests deleted them.
+func (c *cleanupList) remove(className string, criteria interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var objects []*createdObject
+	for _, o := range c.objects {
+		if o.className != className || !matches(criteria, o.object) {
+			objects = append(objects, o)
+		}
+	}
+	c.objects = objects
+}
+
+func (c *cleanupList) list() []*createdObject {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]*createdObject{}, c.objects...)
+}
+
+// StartCleanup makes the test plan keep track of the objects the tests create, so that CleanUp can
+// delete them at the end.
+func (plan *TestPlan) StartCleanup() {
+	plan.cleanup = &cleanupList{}
+}
+
+// CleanUp deletes the objects created during the run that are still on the server, latest first. Each
+// object is deleted with the operation that deletes its class in the DAG. The deletes are run as the
+// teardown tests of the meqa_cleanup suite, so their failures are counted as TeardownFailed.
+func (plan *TestPlan) CleanUp(dag *mqswag.DAG) {
+	if plan.cleanup == nil {
+		return
+	}
+	objects := plan.cleanup.list()
+	if len(objects) == 0 {
+		return
+	}
+	mqutil.Logger.Printf("\n--- Cleanup: %d objects\n", len(objects))
+	fmt.Printf("\n--- Cleanup: %d objects\n", len(objects))
+
+	deletes := deleteOperations(walkOperations(dag))
+	tc := CreateTestSuite(MeqaCleanup, nil, plan)
+	defer func() {
+		tc.db = nil
+	}()
+	r := &suiteRun{history: &TestHistory{}}
+	counts := make(map[string]int)
+	for i := len(objects) - 1; i >= 0; i-- {
+		o := objects[i]
+		op := deletes[o.className]
+		if op == nil {
+			mqutil.Logger.Printf("no operation deletes %s, the object is left on the server: %v", o.className, o.object)
+			fmt.Printf("... no operation deletes %s, the object is left on the server\n", o.className)
+			continue
+		}
+		// The delete picks its parameters from the objects the client DB has, so only leave this object
+		// of its class there. The objects of the other classes are for the parameters of its parents.
+		tc.db = plan.db.CloneSchema()
+		for _, other := range objects[:i+1] {
+			if other == o || other.className != o.className {
+				tc.db.Insert(other.className, other.object, other.associations)
+			}
+		}
+		test := CreateTestFromOp(op.node, len(objects)-i)
+		test.Init(tc)
+		if _, err := plan.runTest(tc, test, nil, PhaseTeardown, r); err != nil {
+			counts[mqutil.TeardownFailed]++
+		}
+	}
+	plan.addResults(r.results)
+	plan.addCounts(counts)
+}
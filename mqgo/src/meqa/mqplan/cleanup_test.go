@@ -0,0 +1,110 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"meqa/mqswag"
+	"meqa/mqutil"
+)
+
+const cleanupSuites = `
+pets:
+- name: createDoggie
+  method: post
+  path: /pet
+  bodyParams:
+    id: 7
+    name: doggie
+    photoUrls: []
+- name: createKitty
+  method: post
+  path: /pet
+  bodyParams:
+    id: 8
+    name: kitty
+    photoUrls: []
+- name: order
+  method: post
+  path: /store/order
+  bodyParams:
+    id: 3
+    petId: 8
+    quantity: 1
+- name: deleteDoggie
+  method: delete
+  path: /pet/{petId}
+  pathParams:
+    petId: 7
+`
+
+// runCleanup runs the suite that leaves a pet and an order on the server, then cleans up.
+func runCleanup(t *testing.T, statuses map[string]int, cleanup bool) ([]string, *TestPlan) {
+	swagger := loadPetstore(t)
+	dag := mqswag.NewDAG()
+	if err := swagger.AddToDAG(dag); err != nil {
+		t.Fatal(err)
+	}
+	dag.Sort()
+	dag.CheckWeight()
+	server := newStatusServer(nil)
+	defer server.Close()
+	plan := newTestPlan(t, swagger, cleanupSuites, server.URL)
+	if cleanup {
+		plan.StartCleanup()
+	}
+	if counts, _ := plan.Run("pets", nil); counts[mqutil.Passed] != 4 {
+		t.Fatalf("expected the tests to pass, got %v", counts)
+	}
+	server.setStatuses(statuses)
+	plan.CleanUp(dag)
+	return server.paths()[4:], plan
+}
+
+func TestCleanUp(t *testing.T) {
+	// The order is deleted before the pet it refers to, and the pet the tests deleted is left alone.
+	requests, plan := runCleanup(t, nil, true)
+	if expected := []string{"DELETE /store/order/3", "DELETE /pet/8"}; !equalStrings(requests, expected) {
+		t.Errorf("expected the requests %v, got %v", expected, requests)
+	}
+	var cleanups []string
+	for _, test := range plan.resultList {
+		if test.suiteName() == MeqaCleanup {
+			cleanups = append(cleanups, test.Method+" "+test.phase)
+		}
+	}
+	if !equalStrings(cleanups, []string{"delete " + PhaseTeardown, "delete " + PhaseTeardown}) {
+		t.Errorf("expected 2 teardown deletes in %s, got %v", MeqaCleanup, cleanups)
+	}
+	if plan.ResultCounts[mqutil.TeardownFailed] != 0 {
+		t.Errorf("unexpected counts %v", plan.ResultCounts)
+	}
+}
+
+func TestCleanUpFailure(t *testing.T) {
+	// All the deletes are tried, and their failures counted as TeardownFailed.
+	requests, plan := runCleanup(t, map[string]int{http.MethodDelete: http.StatusInternalServerError}, true)
+	if len(requests) != 2 || plan.ResultCounts[mqutil.TeardownFailed] != 2 {
+		t.Errorf("expected 2 failed deletes, got %v %v", requests, plan.ResultCounts)
+	}
+}
+
+func TestNoCleanUp(t *testing.T) {
+	if requests, _ := runCleanup(t, nil, false); len(requests) != 0 {
+		t.Errorf("expected no cleanup, got %v", requests)
+	}
+}
+
+func TestCleanupListRemove(t *testing.T) {
+	c := &cleanupList{}
+	c.add("Pet", map[string]interface{}{"id": json.Number("7"), "name": "doggie"}, nil)
+	c.add("Pet", map[string]interface{}{"id": json.Number("8"), "name": "kitty"}, nil)
+	c.add("Order", map[string]interface{}{"id": json.Number("7")}, nil)
+	c.add("Pet", "not an object", nil)
+	c.remove("Pet", map[string]interface{}{"id": 7})
+	objects := c.list()
+	if len(objects) != 2 || objects[0].object["name"] != "kitty" || objects[1].className != "Order" {
+		t.Errorf("expected only the pet 7 to be removed, got %v", objects)
+	}
+}
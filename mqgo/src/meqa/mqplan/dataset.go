@@ -0,0 +1,264 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/go-openapi/swag"
+	"gopkg.in/yaml.v2"
+
+	"meqa/mqutil"
+)
+
+// The sections a dataset column can name, e.g. queryParams.status.
+const (
+	DatasetPath   = "pathParams"
+	DatasetQuery  = "queryParams"
+	DatasetHeader = "headerParams"
+	DatasetForm   = "formParams"
+	DatasetBody   = "bodyParams"
+	DatasetExpect = "expect"
+)
+
+// parseCell turns a csv cell into a value. Numbers, true, false, null and json objects and arrays are
+// parsed, everything else is a string.
+func parseCell(cell string) interface{} {
+	d := json.NewDecoder(strings.NewReader(cell))
+	d.UseNumber()
+	var value interface{}
+	if err := d.Decode(&value); err != nil || d.More() {
+		return cell
+	}
+	return numbersToValues(value)
+}
+
+// readCSVDataset reads the rows of a csv file. The first line has the column names. The empty cells
+// are left out of the rows.
+func readCSVDataset(data []byte) ([]interface{}, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	var rows []interface{}
+	for _, record := range records[1:] {
+		row := make(map[string]interface{})
+		for i, cell := range record {
+			if i < len(records[0]) && len(cell) > 0 {
+				row[strings.TrimSpace(records[0][i])] = parseCell(cell)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readDataset reads the rows of a csv, json or yaml file. A relative path is relative to dir.
+func readDataset(path string, dir string) ([]interface{}, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("can't read the dataset %s: %s", path, err.Error()))
+	}
+	var rows []interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		rows, err = readCSVDataset(data)
+	case ".json":
+		err = json.Unmarshal(data, &rows)
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(data, &rows)
+	default:
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the dataset %s is not a csv, json or yaml file", path))
+	}
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("can't parse the dataset %s: %s", path, err.Error()))
+	}
+	return rows, nil
+}
+
+// datasetRows returns the rows of the dataset of the test, which is either a list or the path of a file.
+func (t *Test) datasetRows(dir string) ([]map[string]interface{}, error) {
+	var rows []interface{}
+	switch dataset := t.Dataset.(type) {
+	case string:
+		var err error
+		rows, err = readDataset(dataset, dir)
+		if err != nil {
+			return nil, err
+		}
+	case []interface{}:
+		rows = dataset
+	default:
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("the dataset of test %s is not a list or a file", t.Name))
+	}
+	// Like mqutil.YamlObjToJsonObj, but the numbers are kept as ints.
+	jsonRaw, err := swag.YAMLToJSON(rows)
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid dataset in test %s: %s", t.Name, err.Error()))
+	}
+	d := json.NewDecoder(bytes.NewReader(jsonRaw))
+	d.UseNumber()
+	var converted []interface{}
+	if err = d.Decode(&converted); err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid dataset in test %s: %s", t.Name, err.Error()))
+	}
+	numbersToValues(converted)
+	var result []map[string]interface{}
+	for i, row := range converted {
+		m, ok := row.(map[string]interface{})
+		if !ok {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("row %d of the dataset of test %s is not a map", i, t.Name))
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// setField sets the value in the map at the dotted path, e.g. category.name, creating the maps on the way.
+func setField(m map[string]interface{}, path string, value interface{}) map[string]interface{} {
+	if m == nil {
+		m = make(map[string]interface{})
+	}
+	keys := strings.Split(path, ".")
+	current := m
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[key] = next
+		}
+		current = next
+	}
+	current[keys[len(keys)-1]] = value
+	return m
+}
+
+// setParam sets the parameter in the map, creating the map if needed.
+func setParam(m map[string]interface{}, name string, value interface{}) map[string]interface{} {
+	if m == nil {
+		m = make(map[string]interface{})
+	}
+	m[name] = value
+	return m
+}
+
+// setBodyField sets a field of the body, or the whole body if the path is empty.
+func (t *Test) setBodyField(path string, value interface{}) {
+	if len(path) == 0 {
+		t.BodyParams = value
+		return
+	}
+	body, _ := t.BodyParams.(map[string]interface{})
+	t.BodyParams = setField(body, path, value)
+}
+
+// bindRow sets the parameters of the test to the values in the row. A column is either the name of a
+// parameter of the operation, or a section and a name, e.g. queryParams.status or bodyParams.category.name.
+// The other names are the fields of the body.
+func (t *Test) bindRow(row map[string]interface{}, params []spec.Parameter) {
+	var columns []string
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		value := row[column]
+		section, name := "", column
+		if i := strings.Index(column, "."); i >= 0 {
+			section, name = column[:i], column[i+1:]
+		}
+		switch section {
+		case DatasetPath:
+			t.PathParams = setParam(t.PathParams, name, value)
+			continue
+		case DatasetQuery:
+			t.QueryParams = setParam(t.QueryParams, name, value)
+			continue
+		case DatasetHeader:
+			t.HeaderParams = setParam(t.HeaderParams, name, value)
+			continue
+		case DatasetForm:
+			t.FormParams = setParam(t.FormParams, name, value)
+			continue
+		case DatasetBody:
+			t.setBodyField(name, value)
+			continue
+		case DatasetExpect:
+			t.Expect = setParam(t.Expect, name, value)
+			continue
+		}
+		if column == DatasetBody {
+			t.setBodyField("", value)
+			continue
+		}
+		found := false
+		for _, p := range params {
+			if p.Name != column {
+				continue
+			}
+			found = true
+			switch p.In {
+			case "path":
+				t.PathParams = setParam(t.PathParams, column, value)
+			case "query":
+				t.QueryParams = setParam(t.QueryParams, column, value)
+			case "header":
+				t.HeaderParams = setParam(t.HeaderParams, column, value)
+			case "formData":
+				t.FormParams = setParam(t.FormParams, column, value)
+			case "body":
+				t.setBodyField("", value)
+			}
+			break
+		}
+		if !found {
+			t.setBodyField(column, value)
+		}
+	}
+}
+
+// expandDataset returns a test for each row of the dataset, named name[row], with the values of the row
+// bound to the parameters. Tests without a dataset are returned as they are.
+func (t *Test) expandDataset(plan *TestPlan) []*Test {
+	if t.Dataset == nil {
+		return []*Test{t}
+	}
+	rows, err := t.datasetRows(plan.dir)
+	if err != nil {
+		t.datasetError = err
+		mqutil.Logger.Print(err)
+		fmt.Printf("test %s: %s\n", t.Name, mqutil.ErrorMessage(err))
+		return []*Test{t}
+	}
+	var params []spec.Parameter
+	if plan.swagger != nil && plan.swagger.Paths != nil {
+		pathItem := plan.swagger.Paths.Paths[t.Path]
+		if op := GetOperationByMethod(&pathItem, t.Method); op != nil {
+			params = ParamsAdd(append([]spec.Parameter{}, op.Parameters...), pathItem.Parameters)
+		}
+	}
+	if len(rows) == 0 {
+		fmt.Printf("test %s: the dataset has no rows\n", t.Name)
+	}
+	var tests []*Test
+	for i, row := range rows {
+		test := t.Duplicate()
+		test.Name = fmt.Sprintf("%s[%d]", t.Name, i)
+		test.Dataset = nil
+		test.bindRow(row, params)
+		tests = append(tests, test)
+	}
+	return tests
+}
@@ -0,0 +1,213 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"meqa/mqswag"
+	"meqa/mqutil"
+)
+
+// The same rows in each format.
+var datasetFiles = map[string]string{
+	"pets.csv": `name,status,category.name,expect.status
+doggie,available,dogs,200
+kitty,sold,,404
+`,
+	"pets.json": `[
+  {"name": "doggie", "status": "available", "category.name": "dogs", "expect.status": 200},
+  {"name": "kitty", "status": "sold", "expect.status": 404}
+]`,
+	"pets.yml": `
+- name: doggie
+  status: available
+  category.name: dogs
+  expect.status: 200
+- name: kitty
+  status: sold
+  expect.status: 404
+`,
+}
+
+// writeDatasets writes the datasets to a temp dir, and returns the dir.
+func writeDatasets(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range datasetFiles {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestParseCell(t *testing.T) {
+	cases := map[string]interface{}{
+		"12":         int64(12),
+		"1.5":        1.5,
+		"true":       true,
+		"null":       nil,
+		`{"id": 1}`:  map[string]interface{}{"id": int64(1)},
+		`[1, "a"]`:   []interface{}{int64(1), "a"},
+		"available":  "available",
+		"1 2":        "1 2",
+		`"quoted"`:   "quoted",
+		"2017-01-01": "2017-01-01",
+	}
+	for cell, expected := range cases {
+		if value := parseCell(cell); !reflect.DeepEqual(value, expected) {
+			t.Errorf("%s: expected %#v, got %#v", cell, expected, value)
+		}
+	}
+}
+
+func TestDatasetRows(t *testing.T) {
+	mqutil.Logger = mqutil.NewStdLogger()
+	dir := writeDatasets(t)
+	defer os.RemoveAll(dir)
+	expected := []map[string]interface{}{
+		{"name": "doggie", "status": "available", "category.name": "dogs", "expect.status": int64(200)},
+		{"name": "kitty", "status": "sold", "expect.status": int64(404)},
+	}
+	for name := range datasetFiles {
+		test := &Test{Name: "create", Dataset: name}
+		rows, err := test.datasetRows(dir)
+		if err != nil || !reflect.DeepEqual(rows, expected) {
+			t.Errorf("%s: expected %v, got %v %v", name, expected, rows, err)
+		}
+	}
+
+	for _, dataset := range []interface{}{"missing.csv", "pets.txt", []interface{}{"not a map"}, 5} {
+		if _, err := (&Test{Name: "create", Dataset: dataset}).datasetRows(dir); err == nil {
+			t.Errorf("%v: expected an error", dataset)
+		}
+	}
+	ioutil.WriteFile(filepath.Join(dir, "broken.json"), []byte(`[{"name": `), 0644)
+	if _, err := (&Test{Name: "create", Dataset: "broken.json"}).datasetRows(dir); err == nil || !strings.Contains(err.Error(), "can't parse") {
+		t.Errorf("broken.json: expected a parse error, got %v", err)
+	}
+}
+
+func TestBindRow(t *testing.T) {
+	swagger := loadPetstore(t)
+	item := swagger.Paths.Paths["/pet/{petId}"]
+	test := &Test{Name: "update", Method: "post", Path: "/pet/{petId}"}
+	test.bindRow(map[string]interface{}{
+		"petId":                 int64(1),
+		"name":                  "doggie",
+		"queryParams.debug":     true,
+		"headerParams.api_key":  "key",
+		"bodyParams.tags":       []interface{}{"a"},
+		"bodyParams.owner.name": "alice",
+		"color":                 "brown",
+		"expect.status":         int64(200),
+	}, item.Post.Parameters)
+	if test.PathParams["petId"] != int64(1) || test.FormParams["name"] != "doggie" {
+		t.Errorf("the parameters of the operation: %v %v", test.PathParams, test.FormParams)
+	}
+	if test.QueryParams["debug"] != true || test.HeaderParams["api_key"] != "key" || test.Expect[ExpectStatus] != int64(200) {
+		t.Errorf("the sections: %v %v %v", test.QueryParams, test.HeaderParams, test.Expect)
+	}
+	expectedBody := map[string]interface{}{
+		"tags":  []interface{}{"a"},
+		"owner": map[string]interface{}{"name": "alice"},
+		"color": "brown",
+	}
+	if !reflect.DeepEqual(test.BodyParams, expectedBody) {
+		t.Errorf("expected the body %v, got %v", expectedBody, test.BodyParams)
+	}
+
+	// The body parameter of the operation takes the whole value.
+	item = swagger.Paths.Paths["/pet"]
+	test = &Test{Name: "create", Method: "post", Path: "/pet"}
+	test.bindRow(map[string]interface{}{"body": map[string]interface{}{"name": "doggie"}}, item.Post.Parameters)
+	if !reflect.DeepEqual(test.BodyParams, map[string]interface{}{"name": "doggie"}) {
+		t.Errorf("unexpected body %v", test.BodyParams)
+	}
+}
+
+func TestDataset(t *testing.T) {
+	swagger := loadPetstore(t)
+	dir := writeDatasets(t)
+	defer os.RemoveAll(dir)
+	server := newRecordingServer()
+	defer server.Close()
+
+	// A test for each row of each file, and of the rows in the test plan.
+	var suites []string
+	for _, name := range []string{"pets.csv", "pets.json", "pets.yml"} {
+		suites = append(suites, `
+`+strings.Replace(name, ".", "_", 1)+`:
+- name: create
+  method: post
+  path: /pet
+  bodyParams:
+    photoUrls: []
+  dataset: `+name)
+	}
+	suites = append(suites, `
+inline:
+- name: find
+  method: get
+  path: /pet/findByStatus
+  dataset:
+  - status: available
+  - status: sold
+    expect.status: 200
+`)
+	planPath := filepath.Join(dir, "plan.yml")
+	if err := ioutil.WriteFile(planPath, []byte(strings.Join(suites, "\n---")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	plan := &TestPlan{BaseURL: server.URL}
+	if err := plan.InitFromFile(planPath, db); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"pets_csv", "pets_json", "pets_yml"} {
+		tests := plan.SuiteMap[name].Tests
+		if len(tests) != 2 || tests[0].Name != "create[0]" || tests[1].Name != "create[1]" {
+			t.Fatalf("%s: expected a test for each row, got %v", name, tests)
+		}
+		if tests[1].Expect[ExpectStatus] != int64(404) {
+			t.Errorf("%s: expected the status from the row, got %v", name, tests[1].Expect)
+		}
+		if counts, _ := plan.Run(name, nil); counts[mqutil.Passed] != 1 || counts[mqutil.Failed] != 1 {
+			t.Errorf("%s: expected the second row to fail on the status, got %v", name, counts)
+		}
+	}
+	if counts, _ := plan.Run("inline", nil); counts[mqutil.Passed] != 2 {
+		t.Errorf("inline: expected 2 passes, got %v", counts)
+	}
+
+	requests := server.requests(false)
+	if len(requests) != 8 {
+		t.Fatalf("expected 8 requests, got %v", requests)
+	}
+	for i := 0; i < 6; i += 2 {
+		var doggie, kitty map[string]interface{}
+		json.Unmarshal([]byte(strings.SplitN(requests[i], " ", 3)[2]), &doggie)
+		json.Unmarshal([]byte(strings.SplitN(requests[i+1], " ", 3)[2]), &kitty)
+		category, _ := doggie["category"].(map[string]interface{})
+		if doggie["name"] != "doggie" || doggie["status"] != "available" || category["name"] != "dogs" {
+			t.Errorf("unexpected body for the first row: %v", doggie)
+		}
+		if kitty["name"] != "kitty" || kitty["status"] != "sold" {
+			t.Errorf("unexpected body for the second row: %v", kitty)
+		}
+	}
+	for i, status := range []string{"available", "sold"} {
+		if request := requests[6+i]; !strings.Contains(request, "status="+status) {
+			t.Errorf("expected the status %s in the query, got %s", status, request)
+		}
+	}
+}
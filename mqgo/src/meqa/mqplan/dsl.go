@@ -8,6 +8,9 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,8 +29,12 @@ import (
 )
 
 const (
-	ExpectStatus = "status"
-	ExpectBody   = "body"
+	ExpectStatus      = "status"
+	ExpectBody        = "body"
+	ExpectHeaders     = "headers"      // the response headers, e.g. Location: {matches: ^/pet/}
+	ExpectMaxLatency  = "maxLatencyMs" // how long the call can take
+	ExpectContentType = "contentType"  // the media type of the response
+	ExpectJSON        = "json"         // the values at the json paths of the response body, e.g. $.id: {gt: 0}
 )
 
 func GetBaseURL(swagger *mqswag.Swagger) string {
@@ -103,10 +110,16 @@ type Test struct {
 	Ref        string                 `yaml:"ref,omitempty"`
 	Expect     map[string]interface{} `yaml:"expect,omitempty"`
 	Strict     bool                   `yaml:"strict,omitempty"`
+	Generator  string                 `yaml:"generator,omitempty"` // how the parameter values are generated
+	OnFailure  string                 `yaml:"onFailure,omitempty"` // what the suite does after a test fails, set in meqa_init
+	Retry      *Retry                 `yaml:"retry,omitempty"`
+	Dataset    interface{}            `yaml:"dataset,omitempty"`  // the rows the test is run with, or the file they are in
+	Attempts   []*Attempt             `yaml:"attempts,omitempty"` // the requests sent by a test that retries
 	TestParams `yaml:",inline,omitempty" json:",inline,omitempty"`
 
 	startTime time.Time
 	stopTime  time.Time
+	url       string // the URL of the REST call, without the query parameters
 
 	// Map of Object name (matching definitions) to the Comparison object.
 	// This tracks what objects we need to add to DB at the end of test.
@@ -121,6 +134,14 @@ type Test struct {
 
 	responseError interface{}
 	schemaError   error
+	assertions    []*Assertion // the results of the expect checks other than status and body
+	datasetError  error        // why the dataset can't be read
+	phase         string       // PhaseSetup or PhaseTeardown for the tests run before or after the others
+	references    []string     // the tests the templates refer to
+	skipReason    string       // why the test was skipped instead of run
+	rand          *rand.Rand   // the random source of the suite run, when it has its own
+
+	oauth2Scopes map[string][]string // the OAuth2 tokens used, by the security scheme name
 }
 
 func (t *Test) Init(suite *TestSuite) {
@@ -131,6 +152,14 @@ func (t *Test) Init(suite *TestSuite) {
 	if len(t.Method) != 0 {
 		t.Method = strings.ToLower(t.Method)
 	}
+	if err := validGenerator(t.Generator); err != nil {
+		mqutil.Logger.Print(err)
+		fmt.Printf("test %s: %s\n", t.Name, mqutil.ErrorMessage(err))
+	}
+	if err := validOnFailure(t.OnFailure); err != nil {
+		mqutil.Logger.Print(err)
+		fmt.Printf("test %s: %s\n", t.Name, mqutil.ErrorMessage(err))
+	}
 	// if BodyParams is map, after unmarshal it is map[interface{}]
 	var err error
 	if t.BodyParams != nil {
@@ -139,10 +168,18 @@ func (t *Test) Init(suite *TestSuite) {
 			mqutil.Logger.Print(err)
 		}
 	}
-	if len(t.Expect) > 0 && t.Expect[ExpectBody] != nil {
-		t.Expect[ExpectBody], err = mqutil.YamlObjToJsonObj(t.Expect[ExpectBody])
-		if err != nil {
-			mqutil.Logger.Print(err)
+	expects := []map[string]interface{}{t.Expect}
+	if t.Retry != nil {
+		expects = append(expects, t.Retry.Until)
+	}
+	for _, expect := range expects {
+		for _, key := range []string{ExpectBody, ExpectHeaders, ExpectJSON} {
+			if len(expect) > 0 && expect[key] != nil {
+				expect[key], err = mqutil.YamlObjToJsonObj(expect[key])
+				if err != nil {
+					mqutil.Logger.Print(err)
+				}
+			}
 		}
 	}
 }
@@ -154,6 +191,11 @@ func (t *Test) Duplicate() *Test {
 	test.FormParams = mqutil.MapCopy(test.FormParams)
 	test.PathParams = mqutil.MapCopy(test.PathParams)
 	test.HeaderParams = mqutil.MapCopy(test.HeaderParams)
+	if test.Retry != nil {
+		retry := *test.Retry
+		retry.Until = mqutil.MapCopy(retry.Until)
+		test.Retry = &retry
+	}
 	if m, ok := test.BodyParams.(map[string]interface{}); ok {
 		test.BodyParams = mqutil.MapCopy(m)
 	} else if a, ok := test.BodyParams.([]interface{}); ok {
@@ -164,12 +206,23 @@ func (t *Test) Duplicate() *Test {
 	test.op = nil
 	test.resp = nil
 	test.comparisons = make(map[string]([]*Comparison))
+	test.assertions = nil
+	test.Attempts = nil
 	test.err = nil
 	test.db = test.suite.db
 
 	return &test
 }
 
+// duration returns how long the REST call of the test took. Tests that failed before making the
+// call take no time.
+func (t *Test) duration() time.Duration {
+	if t.startTime.IsZero() || t.stopTime.IsZero() {
+		return 0
+	}
+	return t.stopTime.Sub(t.startTime)
+}
+
 func (t *Test) AddBasicComparison(tag *mqswag.MeqaTag, paramSpec *spec.Parameter, data interface{}) {
 	if paramSpec == nil {
 		return
@@ -285,7 +338,7 @@ func (t *Test) CompareGetResult(className string, associations map[string]map[st
 				}
 			}
 			if !compFound {
-				b, _ := json.Marshal(comp)
+				b, _ := json.Marshal(comp.oldUsed)
 				c, _ := json.Marshal(resultArray[0].(map[string]interface{}))
 				fmt.Printf("... checking GET result against client DB. Result doesn't match query. Fail\n")
 				t.responseError = fmt.Sprintf("Expected:\n%v\nFound:\n%v\n", string(b), string(c))
@@ -338,8 +391,14 @@ func (t *Test) ProcessOneComparison(className string, method string, comp *Compa
 		fmt.Printf("... deleting entry from client DB. Success\n")
 		t.suite.db.Delete(className, comp.oldUsed, associations, mqutil.InterfaceEquals, -1)
 		t.db.Delete(className, comp.oldUsed, associations, mqutil.InterfaceEquals, -1)
+		if t.suite.plan.cleanup != nil {
+			t.suite.plan.cleanup.remove(className, comp.oldUsed)
+		}
 	} else if method == mqswag.MethodPost && comp.new != nil {
 		fmt.Printf("... adding entry to client DB. Success\n")
+		if t.suite.plan.cleanup != nil {
+			t.suite.plan.cleanup.add(className, comp.new, associations)
+		}
 		t.suite.db.Insert(className, comp.new, associations)
 		return t.db.Insert(className, comp.new, associations)
 	} else if (method == mqswag.MethodPatch || method == mqswag.MethodPut) && comp.new != nil {
@@ -408,22 +467,13 @@ func (t *Test) GetParam(path []string) interface{} {
 	return nil
 }
 
-// ProcessResult decodes the response from the server into a result array
-func (t *Test) ProcessResult(resp *resty.Response) error {
-	if t.err != nil {
-		fmt.Printf("REST call hit the following error: %s\n", t.err.Error())
-		return t.err
-	}
-
-	// useDefaultSpec := true
-	t.resp = resp
-	status := resp.StatusCode()
+// responseSpec returns the response in the spec for the status code, or the default one.
+func (t *Test) responseSpec(status int) *spec.Response {
 	var respSpec *spec.Response
 	if t.op.Responses != nil {
 		respObject, ok := t.op.Responses.StatusCodeResponses[status]
 		if ok {
 			respSpec = &respObject
-			// useDefaultSpec = false
 		} else {
 			respSpec = t.op.Responses.Default
 		}
@@ -432,6 +482,42 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 		// Nothing specified in the swagger.json. Same as an empty spec.
 		respSpec = &spec.Response{}
 	}
+	return respSpec
+}
+
+// statusPasses returns whether the status is the expected one: "success" for a 2xx status that the spec
+// doesn't mark as a failure, "fail" for the others, a status code or a class of status codes.
+func (t *Test) statusPasses(expectedStatus interface{}, status int) bool {
+	success := (status >= 200 && status < 300)
+	tag := mqswag.GetMeqaTag(t.responseSpec(status).Description)
+	if tag != nil && tag.Flags&mqswag.FlagFail != 0 {
+		success = false
+	}
+
+	if expectedStatus == "fail" {
+		return !success
+	} else if _, isString := expectedStatus.(string); !isString {
+		if expectedStatusNum, ok := toFloat(expectedStatus); ok {
+			return int(expectedStatusNum) == status
+		}
+	} else if statusClass, ok := expectedStatus.(string); ok && len(statusClass) == 3 && strings.HasSuffix(statusClass, "xx") {
+		// e.g. 4xx for any client error
+		return strconv.Itoa(status/100) == statusClass[:1]
+	}
+	return success
+}
+
+// ProcessResult decodes the response from the server into a result array
+func (t *Test) ProcessResult(resp *resty.Response) error {
+	if t.err != nil {
+		fmt.Printf("REST call hit the following error: %s\n", mqutil.MaskSecrets(t.err.Error()))
+		return t.err
+	}
+
+	// useDefaultSpec := true
+	t.resp = resp
+	status := resp.StatusCode()
+	respSpec := t.responseSpec(status)
 
 	respBody := resp.Body()
 	respSchema := (*mqswag.Schema)(respSpec.Schema)
@@ -446,33 +532,28 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 	// of actual result. This allows us to print out a result report that is the same format
 	// as the test plan file, but with the expect value that reflects the current ground truth.
 	setExpect := func() {
-		t.Expect = make(map[string]interface{})
-		t.Expect[ExpectStatus] = status
+		expect := make(map[string]interface{})
+		expect[ExpectStatus] = status
 		if resultObj != nil {
-			t.Expect[ExpectBody] = resultObj
+			expect[ExpectBody] = resultObj
+		}
+		// The assertions are kept, so the result can be run again.
+		for _, key := range assertionKeys {
+			if t.Expect[key] != nil {
+				expect[key] = t.Expect[key]
+			}
 		}
+		t.Expect = expect
 	}
 
 	if mqutil.Verbose {
 		fmt.Println("Verifying REST response")
 	}
-	// success based on return status
-	success := (status >= 200 && status < 300)
-	tag := mqswag.GetMeqaTag(respSpec.Description)
-	if tag != nil && tag.Flags&mqswag.FlagFail != 0 {
-		success = false
-	}
-
-	testSuccess := success
 	var expectedStatus interface{} = "success"
 	if t.Expect != nil && t.Expect[ExpectStatus] != nil {
 		expectedStatus = t.Expect[ExpectStatus]
-		if expectedStatus == "fail" {
-			testSuccess = !success
-		} else if expectedStatusNum, ok := expectedStatus.(int); ok {
-			testSuccess = (expectedStatusNum == status)
-		}
 	}
+	testSuccess := t.statusPasses(expectedStatus, status)
 
 	greenSuccess := fmt.Sprintf("%vSuccess%v", mqutil.GREEN, mqutil.END)
 	redFail := fmt.Sprintf("%vFail%v", mqutil.RED, mqutil.END)
@@ -485,7 +566,7 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 				fmt.Printf("... checking body against test's expect value. Success\n")
 			} else {
 				mqutil.InterfacePrint(map[string]interface{}{"... expecting body": t.Expect[ExpectBody]}, true)
-				fmt.Printf("... actual response body: %s\n", respBody)
+				fmt.Printf("... actual response body: %s\n", mqutil.MaskSecrets(string(respBody)))
 				fmt.Printf("... checking body against test's expect value. Fail\n")
 				ejson, _ := json.Marshal(t.Expect[ExpectBody])
 				setExpect()
@@ -493,6 +574,11 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 					"=== test failed, expecting body: \n%s\ngot body:\n%s\n===", string(ejson), respBody))
 			}
 		}
+		if err := t.checkAssertions(resp, resultObj); err != nil {
+			t.responseError = resp
+			setExpect()
+			return err
+		}
 	} else {
 		t.responseError = resp
 		fmt.Printf("... expecting status: %v got status: %d. %v\n", expectedStatus, status, redFail)
@@ -515,7 +601,7 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 			if mqutil.Verbose {
 				// fmt.Printf("... openapi response schema: %s\n", string(specBytes))
 				// fmt.Printf("... response body: %s\n", string(respBody))
-				fmt.Println(err.Error())
+				fmt.Println(mqutil.MaskSecrets(err.Error()))
 			}
 
 			// We ignore this if the response is success, and the spec we used is the default. This is a strong
@@ -731,6 +817,9 @@ func (t *Test) SetRequestParameters(req *resty.Request) string {
 func (t *Test) CopyParent(parentTest *Test) {
 	if parentTest != nil {
 		t.Strict = parentTest.Strict
+		if len(parentTest.Generator) > 0 {
+			t.Generator = parentTest.Generator
+		}
 		t.Expect = mqutil.MapCopy(parentTest.Expect)
 		t.QueryParams = mqutil.MapAdd(t.QueryParams, parentTest.QueryParams)
 		t.PathParams = mqutil.MapAdd(t.PathParams, parentTest.PathParams)
@@ -762,40 +851,91 @@ func (t *Test) Run(tc *TestSuite) error {
 
 	mqutil.Logger.Print("\n--- " + t.Name)
 	fmt.Printf("\nRunning test case: %s\n", t.Name)
+	if t.datasetError != nil {
+		fmt.Printf("... Fail\n... %s\n", mqutil.ErrorMessage(t.datasetError))
+		return t.datasetError
+	}
+	var replay *Interaction
+	replayIndex := -1
+	if tc.plan.replaying != nil {
+		// Use the recorded parameters, so the client DB ends up the same as when recording.
+		var err error
+		replayIndex, err = tc.plan.replaying.next(t)
+		if err != nil {
+			fmt.Printf("... Fail\n... %s\n", mqutil.MaskSecrets(err.Error()))
+			return err
+		}
+		replay = tc.plan.replaying.Interactions[replayIndex]
+		(&t.TestParams).Copy(&replay.Params)
+	}
 	err := t.ResolveParameters(tc)
 	if err != nil {
-		fmt.Printf("... Fail\n... %s\n", err.Error())
+		fmt.Printf("... Fail\n... %s\n", mqutil.MaskSecrets(err.Error()))
+		if tc.plan.recording != nil {
+			tc.plan.recording.record(t, nil, err)
+		}
 		return err
 	}
 
 	req := resty.R()
-	if len(tc.ApiToken) > 0 {
-		req.SetAuthToken(tc.ApiToken)
-	} else if len(tc.Username) > 0 {
-		req.SetBasicAuth(tc.Username, tc.Password)
+	baseURL := tc.plan.BaseURL
+	if len(baseURL) == 0 {
+		baseURL = GetBaseURL(t.db.Swagger)
+	}
+	path := baseURL + t.SetRequestParameters(req)
+	for k, v := range tc.plan.Headers {
+		if len(req.Header.Get(k)) == 0 {
+			req.SetHeader(k, v)
+		}
+	}
+	if replay != nil {
+		req.SetHeader(replayHeader, strconv.Itoa(replayIndex))
+	}
+	// Use the security schemes of the operation if we have the credentials, otherwise fall back to the
+	// token or username/password given on the command line. The operations with an empty security list
+	// get neither. The recorded responses don't need them.
+	if replay == nil {
+		authenticated, err := t.setSecurity(req, tc.plan)
+		if err != nil {
+			fmt.Printf("... Fail\n... %s\n", mqutil.MaskSecrets(err.Error()))
+			return err
+		}
+		if !authenticated {
+			if len(tc.ApiToken) > 0 {
+				req.SetAuthToken(tc.ApiToken)
+			} else if len(tc.Username) > 0 {
+				req.SetBasicAuth(tc.Username, tc.Password)
+			}
+		}
+	}
+	t.url = path
+	if replay != nil {
+		t.url = replay.URL
 	}
 
-	path := GetBaseURL(t.db.Swagger) + t.SetRequestParameters(req)
 	var resp *resty.Response
-
 	t.startTime = time.Now()
-	switch t.Method {
-	case mqswag.MethodGet:
-		resp, err = req.Get(path)
-	case mqswag.MethodPost:
-		resp, err = req.Post(path)
-	case mqswag.MethodPut:
-		resp, err = req.Put(path)
-	case mqswag.MethodDelete:
-		resp, err = req.Delete(path)
-	case mqswag.MethodPatch:
-		resp, err = req.Patch(path)
-	case mqswag.MethodHead:
-		resp, err = req.Head(path)
-	case mqswag.MethodOptions:
-		resp, err = req.Options(path)
-	default:
-		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Unknown method in test %s: %v", t.Name, t.Method))
+	if replay != nil && replay.Response == nil {
+		// The request failed when recording.
+		err = errors.New(replay.Error)
+	} else {
+		resp, err = t.send(req, path)
+	}
+	if err == nil && resp.StatusCode() == http.StatusUnauthorized && t.invalidateTokens(tc.plan) {
+		// The OAuth2 token may have been revoked or expired early. Try again with a new one.
+		mqutil.Logger.Printf("got %s, retrying with new tokens", resp.Status())
+		_, err = t.setSecurity(req, tc.plan)
+		if err != nil {
+			fmt.Printf("... Fail\n... %s\n", mqutil.MaskSecrets(err.Error()))
+			return err
+		}
+		resp, err = t.send(req, path)
+	}
+	if t.Retry != nil && replay == nil {
+		resp, err = t.retry(req, path, resp, err)
+	}
+	if tc.plan.recording != nil {
+		tc.plan.recording.record(t, resp, err)
 	}
 	t.stopTime = time.Now()
 	fmt.Printf("... call completed: %f seconds\n", t.stopTime.Sub(t.startTime).Seconds())
@@ -810,61 +950,57 @@ func (t *Test) Run(tc *TestSuite) error {
 	return err
 }
 
-func StringParamsResolveWithHistory(str string, h *TestHistory) interface{} {
-	begin := strings.Index(str, "{{")
-	end := strings.Index(str, "}}")
-	if end > begin {
-		ar := strings.Split(strings.Trim(str[begin+2:end], " "), ".")
-		if len(ar) < 3 {
-			mqutil.Logger.Printf("invalid parameter: {{%s}}, the format is {{testName.paramSection.paramName}}, e.g. {{test1.output.id}}",
-				str[begin+2:end])
-			return nil
-		}
-		t := h.GetTest(ar[0])
-		if t != nil {
-			return t.GetParam(ar[1:])
-		}
+// send sends the request using the method of the test.
+func (t *Test) send(req *resty.Request, path string) (*resty.Response, error) {
+	switch t.Method {
+	case mqswag.MethodGet:
+		return req.Get(path)
+	case mqswag.MethodPost:
+		return req.Post(path)
+	case mqswag.MethodPut:
+		return req.Put(path)
+	case mqswag.MethodDelete:
+		return req.Delete(path)
+	case mqswag.MethodPatch:
+		return req.Patch(path)
+	case mqswag.MethodHead:
+		return req.Head(path)
+	case mqswag.MethodOptions:
+		return req.Options(path)
 	}
-	return nil
+	return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Unknown method in test %s: %v", t.Name, t.Method))
+}
+
+// StringParamsResolveWithHistory evaluates the {{ }} templates in the string, e.g. {{test1.outputs.id}}.
+// It returns nil if there is nothing to resolve.
+func StringParamsResolveWithHistory(str string, h *TestHistory) interface{} {
+	return resolveTemplate(str, &exprContext{history: h, rand: globalRand})
 }
 
 func MapParamsResolveWithHistory(paramMap map[string]interface{}, h *TestHistory) {
-	for k, v := range paramMap {
-		if str, ok := v.(string); ok {
-			if result := StringParamsResolveWithHistory(str, h); result != nil {
-				paramMap[k] = result
-			}
-		}
-	}
+	resolveTemplates(paramMap, &exprContext{history: h, rand: globalRand})
 }
 
 func ArrayParamsResolveWithHistory(paramArray []interface{}, h *TestHistory) {
-	for i, param := range paramArray {
-		if paramMap, ok := param.(map[string]interface{}); ok {
-			MapParamsResolveWithHistory(paramMap, h)
-		} else if str, ok := param.(string); ok {
-			if result := StringParamsResolveWithHistory(str, h); result != nil {
-				paramArray[i] = result
-			}
-		}
-	}
+	resolveTemplates(paramArray, &exprContext{history: h, rand: globalRand})
 }
 
+// ResolveHistoryParameters evaluates the {{ }} templates in the parameters and the expect values of the test.
 func (t *Test) ResolveHistoryParameters(h *TestHistory) {
-	MapParamsResolveWithHistory(t.PathParams, h)
-	MapParamsResolveWithHistory(t.FormParams, h)
-	MapParamsResolveWithHistory(t.HeaderParams, h)
-	MapParamsResolveWithHistory(t.QueryParams, h)
-	if bodyMap, ok := t.BodyParams.(map[string]interface{}); ok {
-		MapParamsResolveWithHistory(bodyMap, h)
-	} else if bodyArray, ok := t.BodyParams.([]interface{}); ok {
-		ArrayParamsResolveWithHistory(bodyArray, h)
-	} else if bodyStr, ok := t.BodyParams.(string); ok {
-		result := StringParamsResolveWithHistory(bodyStr, h)
-		if result != nil {
-			t.BodyParams = result
-		}
+	ctx := &exprContext{history: h, rand: t.random(), references: make(map[string]bool)}
+	maps := []map[string]interface{}{t.PathParams, t.FormParams, t.HeaderParams, t.QueryParams, t.Expect}
+	if t.Retry != nil {
+		maps = append(maps, t.Retry.Until)
 	}
+	for _, m := range maps {
+		resolveTemplates(m, ctx)
+	}
+	t.BodyParams = resolveTemplates(t.BodyParams, ctx)
+	t.references = nil
+	for name := range ctx.references {
+		t.references = append(t.references, name)
+	}
+	sort.Strings(t.references)
 }
 
 // ParamsAdd adds the parameters from src to dst if the param doesn't already exist on dst.
@@ -892,14 +1028,17 @@ func ParamsAdd(dst []spec.Parameter, src []spec.Parameter) []spec.Parameter {
 // The resolved parameters will be added to test.Parameters map.
 func (t *Test) ResolveParameters(tc *TestSuite) error {
 	pathItem := t.db.Swagger.Paths.Paths[t.Path]
-	t.op = GetOperationByMethod(&pathItem, t.Method)
-	if t.op == nil {
+	op := GetOperationByMethod(&pathItem, t.Method)
+	if op == nil {
 		return mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("Path %s not found in swagger file", t.Path))
 	}
 	fmt.Printf("... resolving parameters.\n")
 
-	// There can be parameters at the path level. We merge these with the operation parameters.
-	t.op.Parameters = ParamsAdd(t.op.Parameters, pathItem.Parameters)
+	// There can be parameters at the path level. We merge these with the operation parameters. The
+	// operation is shared by the tests (which may run in parallel), so we work on a copy.
+	opCopy := *op
+	opCopy.Parameters = ParamsAdd(append([]spec.Parameter{}, op.Parameters...), pathItem.Parameters)
+	t.op = &opCopy
 
 	t.tag = mqswag.GetMeqaTag(t.op.Description)
 
@@ -993,8 +1132,8 @@ func (t *Test) ResolveParameters(tc *TestSuite) error {
 	for _, m := range paramMaps {
 		removeNulls(m)
 	}
-	if t.BodyParams != nil {
-		bodyMap := t.BodyParams.(map[string]interface{})
+	// The body can also be an array or a primitive type (e.g. an OpenAPI 3.0 requestBody of an array schema).
+	if bodyMap, ok := t.BodyParams.(map[string]interface{}); ok {
 		removeNulls(&bodyMap)
 		t.BodyParams = bodyMap
 	}
@@ -1039,7 +1178,7 @@ func (t *Test) GenerateParameter(paramSpec *spec.Parameter, db *mqswag.DB) (inte
 	}
 	if len(paramSpec.Enum) != 0 {
 		fmt.Print("enum\n")
-		return generateEnum(paramSpec.Enum)
+		return t.generateEnum(paramSpec.Enum, paramSpec.Name)
 	}
 	if len(paramSpec.Type) == 0 {
 		return nil, mqutil.NewError(mqutil.ErrInvalid, "Parameter doesn't have type")
@@ -1083,7 +1222,7 @@ func (t *Test) generateByType(s *spec.Schema, prefix string, parentTag *mqswag.M
 				ar = t.db.Find(tag.Class, nil, nil, mqswag.MatchAlways, 5)
 			}
 			if len(ar) > 0 {
-				obj := ar[rand.Intn(len(ar))].(map[string]interface{})
+				obj := ar[t.random().Intn(len(ar))].(map[string]interface{})
 				comp := &Comparison{obj, make(map[string]interface{}), nil, (*spec.Schema)(t.db.GetSchema(tag.Class))}
 				comp.oldUsed[tag.Property] = comp.old[tag.Property]
 				t.comparisons[tag.Class] = append(t.comparisons[tag.Class], comp)
@@ -1096,21 +1235,27 @@ func (t *Test) generateByType(s *spec.Schema, prefix string, parentTag *mqswag.M
 	}
 
 	if len(s.Type) != 0 {
-		if print {
+		result, found, err := t.boundaryValue(s, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if print && found {
+			fmt.Print("boundary\n")
+		} else if print {
 			fmt.Print("random\n")
 		}
-		var result interface{}
-		var err error
-		switch s.Type[0] {
-		case gojsonschema.TYPE_BOOLEAN:
-			result, err = generateBool(s)
-		case gojsonschema.TYPE_INTEGER:
-			result, err = generateInt(s)
-		case gojsonschema.TYPE_NUMBER:
-			result, err = generateFloat(s)
-		case gojsonschema.TYPE_STRING:
-			result, err = generateString(s, prefix)
-		case "file":
+		r := t.random()
+		switch {
+		case found:
+		case s.Type[0] == gojsonschema.TYPE_BOOLEAN:
+			result, err = generateBool(s, r)
+		case s.Type[0] == gojsonschema.TYPE_INTEGER:
+			result, err = generateInt(s, r)
+		case s.Type[0] == gojsonschema.TYPE_NUMBER:
+			result, err = generateFloat(s, r)
+		case s.Type[0] == gojsonschema.TYPE_STRING:
+			result, err = generateString(s, prefix, t.baseTime(), r)
+		case s.Type[0] == "file":
 			return nil, errors.New("can not automatically upload a file, parameter of file type must be manually set\n")
 		}
 		if result != nil && err == nil {
@@ -1124,24 +1269,73 @@ func (t *Test) generateByType(s *spec.Schema, prefix string, parentTag *mqswag.M
 
 // RandomTime generate a random time in the range of [t - r, t).
 func RandomTime(t time.Time, r time.Duration) time.Time {
-	return t.Add(-time.Duration(float64(r) * rand.Float64()))
+	return randomTime(t, r, globalRand)
+}
+
+func randomTime(t time.Time, r time.Duration, random *rand.Rand) time.Time {
+	return t.Add(-time.Duration(float64(r) * random.Float64()))
+}
+
+// generatePattern generates a string matching the pattern with the values drawn from r.
+func generatePattern(pattern string, length int, r *rand.Rand) (string, error) {
+	g, err := reggen.NewGenerator(pattern)
+	if err != nil {
+		return "", err
+	}
+	g.SetRand(r)
+	return g.Generate(length), nil
+}
+
+// seedTime is what the dates are generated before when there is a seed. It doesn't change between runs,
+// so that the same seed generates the same dates.
+var seedTime = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// baseTime returns the time the dates of the test are generated before.
+func (t *Test) baseTime() time.Time {
+	if t.random() == globalRand {
+		return time.Now()
+	}
+	return seedTime
+}
+
+// random returns the random source of the suite run or the test plan, so that the same seed generates
+// the same values.
+func (t *Test) random() *rand.Rand {
+	if t.rand != nil {
+		return t.rand
+	}
+	if t.suite != nil && t.suite.plan != nil && t.suite.plan.rand != nil {
+		return t.suite.plan.rand
+	}
+	return globalRand
+}
+
+// randomUUID returns a version 4 uuid from our random source instead of crypto/rand.
+func randomUUID(r *rand.Rand) (string, error) {
+	b := make([]byte, 16)
+	for i := range b {
+		b[i] = byte(r.Intn(256))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	u, err := uuid.FromBytes(b)
+	return u.String(), err
 }
 
 // TODO we need to make it context aware. Based on different contexts we should generate different
 // date ranges. Prefix is a prefix to use when generating strings. It's only used when there is
 // no specified pattern in the swagger.json
-func generateString(s *spec.Schema, prefix string) (string, error) {
+func generateString(s *spec.Schema, prefix string, base time.Time, r *rand.Rand) (string, error) {
 	if s.Format == "date-time" {
-		t := RandomTime(time.Now(), time.Hour*24*30)
+		t := randomTime(base, time.Hour*24*30, r)
 		return t.Format(time.RFC3339), nil
 	}
 	if s.Format == "date" {
-		t := RandomTime(time.Now(), time.Hour*24*30)
+		t := randomTime(base, time.Hour*24*30, r)
 		return t.Format("2006-01-02"), nil
 	}
 	if s.Format == "uuid" {
-		u, err := uuid.NewV4()
-		return u.String(), err
+		return randomUUID(r)
 	}
 	if s.Format == "email" {
 		s.Pattern = "^[a-z0-9]+@[a-z_]+?\\.[a-z]{2,3}$"
@@ -1157,7 +1351,7 @@ func generateString(s *spec.Schema, prefix string) (string, error) {
 		pattern = prefix + "\\d+"
 		length = len(prefix) + 5
 	}
-	str, err := reggen.Generate(pattern, length)
+	str, err := generatePattern(pattern, length, r)
 	if err != nil {
 		return "", mqutil.NewError(mqutil.ErrInvalid, err.Error())
 	}
@@ -1177,11 +1371,11 @@ func generateString(s *spec.Schema, prefix string) (string, error) {
 	return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Invalid format string: %s", s.Format))
 }
 
-func generateBool(s *spec.Schema) (interface{}, error) {
-	return rand.Intn(2) == 0, nil
+func generateBool(s *spec.Schema, r *rand.Rand) (interface{}, error) {
+	return r.Intn(2) == 0, nil
 }
 
-func generateFloat(s *spec.Schema) (float64, error) {
+func generateFloat(s *spec.Schema, r *rand.Rand) (float64, error) {
 	var realmin float64
 	if s.Minimum != nil {
 		realmin = *s.Minimum
@@ -1210,16 +1404,16 @@ func generateFloat(s *spec.Schema) (float64, error) {
 				*s.Minimum, *s.Maximum))
 		}
 	}
-	return rand.Float64()*(realmax-realmin) + realmin, nil
+	return r.Float64()*(realmax-realmin) + realmin, nil
 }
 
-func generateInt(s *spec.Schema) (int64, error) {
+func generateInt(s *spec.Schema, r *rand.Rand) (int64, error) {
 	// Give a default range if there isn't one
 	if s.Maximum == nil && s.Minimum == nil {
 		maxf := 1000000.0
 		s.Maximum = &maxf
 	}
-	f, err := generateFloat(s)
+	f, err := generateFloat(s, r)
 	if err != nil {
 		return 0, err
 	}
@@ -1251,13 +1445,21 @@ func (t *Test) generateArray(name string, parentTag *mqswag.MeqaTag, schema *spe
 		if maxDiff <= 0 {
 			maxDiff = 1
 		}
-		numItems = rand.Intn(int(maxDiff)) + minItems
+		numItems = t.random().Intn(int(maxDiff)) + minItems
 	} else {
-		numItems = rand.Intn(10)
+		numItems = t.random().Intn(10)
 	}
 	if numItems <= 0 {
 		numItems = 1
 	}
+	boundaryItems, useBoundary := t.boundaryItems(schema, name)
+	if useBoundary {
+		if boundaryItems == 0 {
+			return []interface{}{}, nil
+		}
+		// One entry is generated before the loop below.
+		numItems = boundaryItems - 1
+	}
 
 	var itemSchema *spec.Schema
 	if len(schema.Items.Schemas) != 0 {
@@ -1306,7 +1508,7 @@ func (t *Test) generateArray(name string, parentTag *mqswag.MeqaTag, schema *spe
 			return nil, err
 		}
 	}
-	return ar, nil
+	return t.boundaryDuplicate(schema, name, ar), nil
 }
 
 func (t *Test) generateObject(name string, parentTag *mqswag.MeqaTag, schema *spec.Schema, db *mqswag.DB, level int) (interface{}, error) {
@@ -1320,7 +1522,14 @@ func (t *Test) generateObject(name string, parentTag *mqswag.MeqaTag, schema *sp
 	if level != 0 {
 		fmt.Println("")
 	}
-	for k, v := range schema.Properties {
+	// In a fixed order, so that the same seed generates the same object.
+	var keys []string
+	for k := range schema.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := schema.Properties[k]
 		if level != 0 {
 			fmt.Printf("%s%s . ", spaces, k)
 		}
@@ -1390,7 +1599,7 @@ func (t *Test) GenerateSchema(name string, parentTag *mqswag.MeqaTag, schema *sp
 		if level != 0 {
 			fmt.Print("enum\n")
 		}
-		return generateEnum(schema.Enum)
+		return t.generateEnum(schema.Enum, name)
 	}
 
 	if len(schema.AllOf) > 0 {
@@ -1440,6 +1649,14 @@ func (t *Test) GenerateSchema(name string, parentTag *mqswag.MeqaTag, schema *sp
 	return t.generateByType(schema, name, tag, nil, level != 0)
 }
 
-func generateEnum(e []interface{}) (interface{}, error) {
-	return e[rand.Intn(len(e))], nil
+// GenerateExample generates an object that matches the schema. The fields that refer to other
+// objects use the ones in the db.
+func GenerateExample(schema *spec.Schema, db *mqswag.DB) (interface{}, error) {
+	t := &Test{Method: mqswag.MethodPost, db: db, suite: &TestSuite{db: db}}
+	t.comparisons = make(map[string]([]*Comparison))
+	return t.GenerateSchema("", nil, schema, db, 0)
+}
+
+func generateEnum(e []interface{}, r *rand.Rand) (interface{}, error) {
+	return e[r.Intn(len(e))], nil
 }
@@ -0,0 +1,591 @@
+package mqplan
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"meqa/mqutil"
+)
+
+// exprContext is what the expressions in the {{ }} templates are evaluated with.
+type exprContext struct {
+	history    *TestHistory // where the references to the parameters of other tests are looked up
+	rand       *rand.Rand
+	references map[string]bool // the tests referred to, if not nil
+}
+
+// exprFunc is a function that can be called in an expression, e.g. {{ randomInt(1, 10) }}.
+type exprFunc func(ctx *exprContext, args []interface{}) (interface{}, error)
+
+var exprFunctions map[string]exprFunc
+
+func init() {
+	exprFunctions = map[string]exprFunc{
+		"uuid": func(ctx *exprContext, args []interface{}) (interface{}, error) {
+			return randomUUID(ctx.rand)
+		},
+		"now": func(ctx *exprContext, args []interface{}) (interface{}, error) {
+			return formatTime(time.Now(), stringArg(args, 0, "")), nil
+		},
+		"dateAdd": exprDateAdd,
+		"formatDate": func(ctx *exprContext, args []interface{}) (interface{}, error) {
+			t, _, err := parseTime(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return formatTime(t, stringArg(args, 1, "")), nil
+		},
+		"randomInt": func(ctx *exprContext, args []interface{}) (interface{}, error) {
+			min, okMin := exprInt(args[0])
+			max, okMax := exprInt(args[1])
+			if !okMin || !okMax || max < min {
+				return nil, fmt.Errorf("randomInt takes two integers, the min and the max")
+			}
+			return min + ctx.rand.Int63n(max-min+1), nil
+		},
+		"randomString": func(ctx *exprContext, args []interface{}) (interface{}, error) {
+			n, ok := exprInt(args[0])
+			if !ok || n < 0 {
+				return nil, fmt.Errorf("randomString takes the length")
+			}
+			const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = letters[ctx.rand.Intn(len(letters))]
+			}
+			return string(b), nil
+		},
+		"base64": func(ctx *exprContext, args []interface{}) (interface{}, error) {
+			return base64.StdEncoding.EncodeToString([]byte(exprString(args[0]))), nil
+		},
+		"base64Decode": func(ctx *exprContext, args []interface{}) (interface{}, error) {
+			b, err := base64.StdEncoding.DecodeString(exprString(args[0]))
+			return string(b), err
+		},
+		"md5": func(ctx *exprContext, args []interface{}) (interface{}, error) {
+			sum := md5.Sum([]byte(exprString(args[0])))
+			return hex.EncodeToString(sum[:]), nil
+		},
+		"sha1": func(ctx *exprContext, args []interface{}) (interface{}, error) {
+			sum := sha1.Sum([]byte(exprString(args[0])))
+			return hex.EncodeToString(sum[:]), nil
+		},
+		"sha256": func(ctx *exprContext, args []interface{}) (interface{}, error) {
+			sum := sha256.Sum256([]byte(exprString(args[0])))
+			return hex.EncodeToString(sum[:]), nil
+		},
+		"env": func(ctx *exprContext, args []interface{}) (interface{}, error) {
+			value, ok := os.LookupEnv(exprString(args[0]))
+			if !ok {
+				if len(args) > 1 {
+					return args[1], nil
+				}
+				return nil, fmt.Errorf("environment variable %s is not set", exprString(args[0]))
+			}
+			return value, nil
+		},
+		"upper": func(ctx *exprContext, args []interface{}) (interface{}, error) {
+			return strings.ToUpper(exprString(args[0])), nil
+		},
+		"lower": func(ctx *exprContext, args []interface{}) (interface{}, error) {
+			return strings.ToLower(exprString(args[0])), nil
+		},
+	}
+}
+
+// The number of arguments the functions take, the min and the max.
+var exprFunctionArgs = map[string][2]int{
+	"uuid": {0, 0}, "now": {0, 1}, "dateAdd": {2, 3}, "formatDate": {2, 2}, "randomInt": {2, 2},
+	"randomString": {1, 1}, "base64": {1, 1}, "base64Decode": {1, 1}, "md5": {1, 1}, "sha1": {1, 1},
+	"sha256": {1, 1}, "env": {1, 2}, "upper": {1, 1}, "lower": {1, 1},
+}
+
+func stringArg(args []interface{}, i int, defaultValue string) string {
+	if i < len(args) {
+		return exprString(args[i])
+	}
+	return defaultValue
+}
+
+// formatTime formats the time with the go layout, or as "date" (2006-01-02), "unix" (seconds) or
+// "unixMs" (milliseconds). The default is RFC3339.
+func formatTime(t time.Time, layout string) interface{} {
+	switch layout {
+	case "":
+		return t.Format(time.RFC3339)
+	case "date":
+		return t.Format("2006-01-02")
+	case "unix":
+		return t.Unix()
+	case "unixMs":
+		return t.UnixNano() / int64(time.Millisecond)
+	}
+	return t.Format(layout)
+}
+
+// parseTime parses a RFC3339 time, a date or unix seconds. It also returns the layout to format the
+// result in.
+func parseTime(v interface{}) (time.Time, string, error) {
+	if seconds, ok := v.(int64); ok {
+		return time.Unix(seconds, 0), "unix", nil
+	}
+	s := exprString(v)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, "", nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, "date", nil
+	}
+	return time.Time{}, "", fmt.Errorf("%s is not a RFC3339 time or a date", s)
+}
+
+var dayDurationRegex = regexp.MustCompile(`^([+-]?)(\d+)d(.*)$`)
+
+// parseDuration parses a go duration, which can also start with the number of days, e.g. -7d or 1d12h.
+func parseDuration(s string) (time.Duration, error) {
+	var days time.Duration
+	if m := dayDurationRegex.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		days = time.Duration(n) * 24 * time.Hour
+		s = m[3]
+		if m[1] == "-" {
+			days = -days
+			if len(s) > 0 {
+				s = "-" + s
+			}
+		}
+		if len(s) == 0 {
+			return days, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	return days + d, err
+}
+
+// exprDateAdd adds the duration to the time, e.g. dateAdd(now(), "-7d"). The result has the format of
+// the time given, unless the layout is given.
+func exprDateAdd(ctx *exprContext, args []interface{}) (interface{}, error) {
+	t, layout, err := parseTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	d, err := parseDuration(exprString(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	return formatTime(t.Add(d), stringArg(args, 2, layout)), nil
+}
+
+// exprString returns the value as a string, the way it's put in a template. Maps and arrays are json.
+func exprString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(value), 'f', -1, 32)
+	case int, int32, int64, bool, json.Number:
+		return fmt.Sprint(value)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// exprNumber returns the value as an int64 or a float64.
+func exprNumber(v interface{}) (interface{}, bool) {
+	switch value := v.(type) {
+	case int:
+		return int64(value), true
+	case int32:
+		return int64(value), true
+	case int64:
+		return value, true
+	case float32:
+		return float64(value), true
+	case float64:
+		return value, true
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i, true
+		}
+		f, err := value.Float64()
+		return f, err == nil
+	}
+	return nil, false
+}
+
+// exprInt returns the value as an int64 if it's a whole number.
+func exprInt(v interface{}) (int64, bool) {
+	n, ok := exprNumber(v)
+	if !ok {
+		return 0, false
+	}
+	if f, isFloat := n.(float64); isFloat {
+		return int64(f), f == math.Trunc(f)
+	}
+	return n.(int64), true
+}
+
+// exprArithmetic applies the operator to the values. + concatenates strings. Integers stay integers,
+// unless they don't divide.
+func exprArithmetic(op byte, left interface{}, right interface{}) (interface{}, error) {
+	l, lok := exprNumber(left)
+	r, rok := exprNumber(right)
+	if !lok || !rok {
+		if op == '+' {
+			return exprString(left) + exprString(right), nil
+		}
+		return nil, fmt.Errorf("can't apply %c to %s and %s", op, exprString(left), exprString(right))
+	}
+	li, lIsInt := l.(int64)
+	ri, rIsInt := r.(int64)
+	if lIsInt && rIsInt {
+		switch op {
+		case '+':
+			return li + ri, nil
+		case '-':
+			return li - ri, nil
+		case '*':
+			return li * ri, nil
+		case '/', '%':
+			if ri == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			if op == '%' {
+				return li % ri, nil
+			}
+			if li%ri == 0 {
+				return li / ri, nil
+			}
+		}
+	}
+	lf, _ := toFloat(l)
+	rf, _ := toFloat(r)
+	switch op {
+	case '+':
+		return lf + rf, nil
+	case '-':
+		return lf - rf, nil
+	case '*':
+		return lf * rf, nil
+	case '/':
+		return lf / rf, nil
+	}
+	return math.Mod(lf, rf), nil
+}
+
+// exprParser evaluates an expression while parsing it. The grammar is
+//
+//	expr    = term {("+" | "-") term}
+//	term    = unary {("*" | "/" | "%") unary}
+//	unary   = "-" unary | primary
+//	primary = number | string | "(" expr ")" | name "(" [expr {"," expr}] ")" | reference
+//
+// A reference is a test name followed by the parameter section and the parameter name, separated by dots,
+// e.g. post_placeOrder_1.outputs.id. A "-" in a reference is part of the name, so put spaces around "-"
+// to subtract.
+type exprParser struct {
+	src string
+	pos int
+	ctx *exprContext
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at position %d of \"%s\"", fmt.Sprintf(format, args...), p.pos, p.src)
+}
+
+func (p *exprParser) expr() (interface{}, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = exprArithmetic(op, left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) term() (interface{}, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/' || op == '%'; op = p.peek() {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = exprArithmetic(op, left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) unary() (interface{}, error) {
+	if p.peek() == '-' {
+		p.pos++
+		v, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return exprArithmetic('-', int64(0), v)
+	}
+	return p.primary()
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '$' || c == '[' || c == ']' || c == '.' || (c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *exprParser) primary() (interface{}, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, p.errorf("unexpected end")
+	case c == '(':
+		p.pos++
+		v, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return v, nil
+	case c == '\'' || c == '"':
+		end := strings.IndexByte(p.src[p.pos+1:], c)
+		if end < 0 {
+			return nil, p.errorf("unterminated string")
+		}
+		s := p.src[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return s, nil
+	case c >= '0' && c <= '9':
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		number := p.src[start:p.pos]
+		if i, err := strconv.ParseInt(number, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", number)
+		}
+		return f, nil
+	case isNameChar(c):
+		start := p.pos
+		for p.pos < len(p.src) && (isNameChar(p.src[p.pos]) ||
+			p.src[p.pos] == '-' && p.pos+1 < len(p.src) && isNameChar(p.src[p.pos+1])) {
+			p.pos++
+		}
+		name := p.src[start:p.pos]
+		if p.peek() == '(' {
+			p.pos++
+			return p.call(name)
+		}
+		switch name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return p.reference(name)
+	}
+	return nil, p.errorf("unexpected %c", c)
+}
+
+func (p *exprParser) call(name string) (interface{}, error) {
+	f := exprFunctions[name]
+	if f == nil {
+		return nil, p.errorf("unknown function %s", name)
+	}
+	var args []interface{}
+	if p.peek() != ')' {
+		for {
+			arg, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+	}
+	if p.peek() != ')' {
+		return nil, p.errorf("missing ) after the arguments of %s", name)
+	}
+	p.pos++
+	if n := exprFunctionArgs[name]; len(args) < n[0] || len(args) > n[1] {
+		if n[0] == n[1] {
+			return nil, p.errorf("%s takes %d arguments, not %d", name, n[0], len(args))
+		}
+		return nil, p.errorf("%s takes %d to %d arguments, not %d", name, n[0], n[1], len(args))
+	}
+	v, err := f(p.ctx, args)
+	if err != nil {
+		return nil, p.errorf("%s: %s", name, err.Error())
+	}
+	return v, nil
+}
+
+func (p *exprParser) reference(name string) (interface{}, error) {
+	ar := strings.Split(name, ".")
+	if len(ar) < 3 {
+		return nil, p.errorf("invalid reference %s, the format is testName.paramSection.paramName, e.g. test1.outputs.id", name)
+	}
+	if p.ctx.references != nil {
+		p.ctx.references[ar[0]] = true
+	}
+	if p.ctx.history == nil {
+		return nil, p.errorf("can't refer to the tests here")
+	}
+	t := p.ctx.history.GetTest(ar[0])
+	if t == nil {
+		return nil, p.errorf("test %s is not found", ar[0])
+	}
+	v := t.GetParam(ar[1:])
+	if v == nil {
+		return nil, p.errorf("%s is not found", name)
+	}
+	return v, nil
+}
+
+// evalExpression evaluates the expression in a {{ }} template.
+func evalExpression(expr string, ctx *exprContext) (interface{}, error) {
+	p := &exprParser{src: expr, ctx: ctx}
+	v, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != 0 {
+		return nil, p.errorf("unexpected %c", p.peek())
+	}
+	return v, nil
+}
+
+// templateEnd returns the index of the }} that closes the expression starting at start, skipping the
+// quoted strings. It returns -1 if there is none.
+func templateEnd(str string, start int) int {
+	var quote byte
+	for i := start; i < len(str); i++ {
+		c := str[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '}' && i+1 < len(str) && str[i+1] == '}':
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveTemplate evaluates the {{ }} expressions in the string. A string that is just one expression
+// becomes its value, which can be e.g. a number or an object. Otherwise the values are put in the string.
+// It returns nil if the string has no expressions, or if one of them can't be evaluated.
+func resolveTemplate(str string, ctx *exprContext) interface{} {
+	begin := strings.Index(str, "{{")
+	if begin < 0 {
+		return nil
+	}
+	var parts []string
+	var value interface{}
+	single := true
+	rest := str
+	for begin >= 0 {
+		end := templateEnd(rest, begin+2)
+		if end < 0 {
+			break
+		}
+		v, err := evalExpression(rest[begin+2:end], ctx)
+		if err != nil {
+			mqutil.Logger.Printf("can't resolve %s: %s", rest[begin:end+2], err.Error())
+			return nil
+		}
+		if len(strings.TrimSpace(rest[:begin])) > 0 || len(parts) > 0 {
+			single = false
+		}
+		parts = append(parts, rest[:begin], exprString(v))
+		value = v
+		rest = rest[end+2:]
+		begin = strings.Index(rest, "{{")
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	if single && len(strings.TrimSpace(rest)) == 0 {
+		return value
+	}
+	return strings.Join(parts, "") + rest
+}
+
+// resolveTemplates evaluates the templates in the strings of the value, and in the maps and arrays in it.
+func resolveTemplates(v interface{}, ctx *exprContext) interface{} {
+	switch value := v.(type) {
+	case string:
+		if result := resolveTemplate(value, ctx); result != nil {
+			return result
+		}
+	case map[string]interface{}:
+		for k, e := range value {
+			value[k] = resolveTemplates(e, ctx)
+		}
+	case []interface{}:
+		for i, e := range value {
+			value[i] = resolveTemplates(e, ctx)
+		}
+	}
+	return v
+}
@@ -0,0 +1,175 @@
+package mqplan
+
+import (
+	"math/rand"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"meqa/mqutil"
+)
+
+// newExprContext returns a context with the history of a test that created a pet.
+func newExprContext() *exprContext {
+	create := &Test{Name: "post_addPet_1"}
+	create.BodyParams = map[string]interface{}{"name": "doggie", "tags": []interface{}{map[string]interface{}{"name": "a"}}}
+	create.Expect = map[string]interface{}{ExpectBody: map[string]interface{}{"id": int64(7), "name": "doggie"}}
+	h := &TestHistory{}
+	h.Append(create)
+	return &exprContext{history: h, rand: rand.New(rand.NewSource(1))}
+}
+
+func TestEvalExpression(t *testing.T) {
+	os.Setenv("MEQA_EXPR_TEST", "from env")
+	defer os.Unsetenv("MEQA_EXPR_TEST")
+	cases := map[string]interface{}{
+		"1 + 2 * 3":                         int64(7),
+		"(1 + 2) * 3":                       int64(9),
+		"7 / 2":                             3.5,
+		"8 / 2":                             int64(4),
+		"7 % 4":                             int64(3),
+		"-2 - -3":                           int64(1),
+		"1.5 * 2":                           3.0,
+		"'a' + 1":                           "a1",
+		`"a b" + 'c'`:                       "a bc",
+		"true":                              true,
+		"null":                              nil,
+		"post_addPet_1.outputs.id + 1":      int64(8),
+		"post_addPet_1.bodyParams.name":     "doggie",
+		"upper(post_addPet_1.outputs.name)": "DOGGIE",
+		"lower('ABC')":                      "abc",
+		"base64('user:pass')":               "dXNlcjpwYXNz",
+		"base64Decode('dXNlcjpwYXNz')":      "user:pass",
+		"md5('meqa')":                       "95dadad75bd6ef9da4ecd62d10b32e9d",
+		"sha1('meqa')":                      "7be422c390e2bd2baad39271222fde6be043651b",
+		"env('MEQA_EXPR_TEST')":             "from env",
+		"env('MEQA_EXPR_UNSET', 'default')": "default",
+		"randomInt(5, 5)":                   int64(5),
+		"dateAdd('2017-01-31', '1d')":       "2017-02-01",
+		"dateAdd('2017-01-31', '-1d12h', 'unix')":                int64(1485691200),
+		"dateAdd('2017-01-31T10:00:00Z', '2h')":                  "2017-01-31T12:00:00Z",
+		"formatDate('2017-01-31T10:00:00Z', 'date')":             "2017-01-31",
+		"formatDate('2017-01-31T10:00:00Z', '2006-01-02 15:04')": "2017-01-31 10:00",
+		"formatDate(1485856800, 'unix')":                         int64(1485856800),
+	}
+	for expr, expected := range cases {
+		if v, err := evalExpression(expr, newExprContext()); err != nil || !reflect.DeepEqual(v, expected) {
+			t.Errorf("%s: expected %#v, got %#v %v", expr, expected, v, err)
+		}
+	}
+}
+
+func TestEvalExpressionRandom(t *testing.T) {
+	ctx := newExprContext()
+	uuid, err := evalExpression("uuid()", ctx)
+	if err != nil || !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(uuid.(string)) {
+		t.Errorf("uuid: got %v %v", uuid, err)
+	}
+	if s, err := evalExpression("randomString(12)", ctx); err != nil || len(s.(string)) != 12 {
+		t.Errorf("randomString: got %v %v", s, err)
+	}
+	for i := 0; i < 20; i++ {
+		if n, err := evalExpression("randomInt(1, 3)", ctx); err != nil || n.(int64) < 1 || n.(int64) > 3 {
+			t.Fatalf("randomInt: got %v %v", n, err)
+		}
+	}
+	// The same seed gives the same values.
+	first, _ := evalExpression("randomString(8) + uuid()", newExprContext())
+	if second, _ := evalExpression("randomString(8) + uuid()", newExprContext()); first != second {
+		t.Errorf("the same seed gave %v and %v", first, second)
+	}
+	if now, err := evalExpression("now('unix')", ctx); err != nil || now.(int64) < time.Now().Unix()-5 {
+		t.Errorf("now: got %v %v", now, err)
+	}
+}
+
+func TestEvalExpressionErrors(t *testing.T) {
+	cases := map[string]string{
+		"1 +":                     "unexpected end",
+		"(1 + 2":                  "missing )",
+		"'abc":                    "unterminated string",
+		"1 2":                     "unexpected 2",
+		"1 / 0":                   "division by zero",
+		"'a' * 2":                 "can't apply *",
+		"nope(1)":                 "unknown function nope",
+		"upper()":                 "upper takes 1 arguments, not 0",
+		"dateAdd(1)":              "dateAdd takes 2 to 3 arguments, not 1",
+		"randomInt(3, 1)":         "randomInt takes two integers",
+		"env('MEQA_EXPR_UNSET')":  "is not set",
+		"post_addPet_1.id":        "invalid reference",
+		"missing_1.outputs.id":    "test missing_1 is not found",
+		"post_addPet_1.outputs.x": "post_addPet_1.outputs.x is not found",
+	}
+	for expr, expected := range cases {
+		if _, err := evalExpression(expr, newExprContext()); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected the error %s, got %v", expr, expected, err)
+		}
+	}
+	if _, err := evalExpression("a.outputs.id", &exprContext{}); err == nil || !strings.Contains(err.Error(), "can't refer to the tests here") {
+		t.Errorf("expected no history, got %v", err)
+	}
+}
+
+func TestResolveTemplates(t *testing.T) {
+	mqutil.Logger = mqutil.NewStdLogger()
+	ctx := newExprContext()
+	ctx.references = make(map[string]bool)
+	v := resolveTemplates(map[string]interface{}{
+		"id":      "{{ post_addPet_1.outputs.id }}",
+		"name":    "{{ upper(post_addPet_1.outputs.name) }}-{{ 1 + 1 }}",
+		"text":    "no template",
+		"quoted":  "{{ 'a}}b' }}",
+		"list":    []interface{}{" {{ 2 * 2 }} ", "{{ nope() }}"},
+		"unended": "{{ 1 + 1",
+	}, ctx)
+	expected := map[string]interface{}{
+		"id":      int64(7),
+		"name":    "DOGGIE-2",
+		"text":    "no template",
+		"quoted":  "a}}b",
+		"list":    []interface{}{int64(4), "{{ nope() }}"},
+		"unended": "{{ 1 + 1",
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("expected %v, got %v", expected, v)
+	}
+	if !reflect.DeepEqual(ctx.references, map[string]bool{"post_addPet_1": true}) {
+		t.Errorf("unexpected references %v", ctx.references)
+	}
+}
+
+func TestTemplatesInTests(t *testing.T) {
+	server := newRecordingServer()
+	defer server.Close()
+	plan := newTestPlan(t, loadPetstore(t), `
+pets:
+- name: create
+  method: post
+  path: /pet
+  bodyParams:
+    id: 7
+    name: "{{ upper('doggie') }}"
+    photoUrls: ["{{ 'http://' + 'photo' }}"]
+- name: get
+  method: get
+  path: /pet/{petId}
+  pathParams:
+    petId: "{{ create.bodyParams.id * 2 }}"
+`, server.URL)
+	if counts, _ := plan.Run("pets", nil); counts[mqutil.Passed] != 2 {
+		t.Errorf("expected 2 passes, got %v", counts)
+	}
+	requests := server.requests(false)
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %v", requests)
+	}
+	if !strings.Contains(requests[0], `"name":"DOGGIE"`) || !strings.Contains(requests[0], `"photoUrls":["http://photo"]`) {
+		t.Errorf("unexpected create request %s", requests[0])
+	}
+	if !strings.HasPrefix(requests[1], "GET /pet/14 ") {
+		t.Errorf("unexpected get request %s", requests[1])
+	}
+}
@@ -0,0 +1,54 @@
+package mqplan
+
+import (
+	"fmt"
+
+	"meqa/mqutil"
+)
+
+// What a test suite does after one of its tests fails.
+const (
+	OnFailureStop           = "stop"           // skip the rest of the suite, the default
+	OnFailureContinue       = "continue"       // run the rest of the suite
+	OnFailureSkipDependents = "skipDependents" // only skip the tests whose templates refer to the failed tests
+)
+
+// validOnFailure checks the name of the failure policy.
+func validOnFailure(name string) error {
+	if len(name) == 0 || name == OnFailureStop || name == OnFailureContinue || name == OnFailureSkipDependents {
+		return nil
+	}
+	return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("unknown onFailure %s, it can be %s, %s or %s",
+		name, OnFailureStop, OnFailureContinue, OnFailureSkipDependents))
+}
+
+// continuesAfterFailure returns whether the suite runs the rest of its tests after one fails.
+func (tc *TestSuite) continuesAfterFailure() bool {
+	return tc.OnFailure == OnFailureContinue || tc.OnFailure == OnFailureSkipDependents
+}
+
+// skip records the test as skipped for the reason, so that the reports list it.
+func (r *suiteRun) skip(t *Test, reason string) {
+	mqutil.Logger.Printf("\n--- %s skipped, %s\n", t.Name, reason)
+	fmt.Printf("\n--- %s skipped, %s\n", t.Name, reason)
+	t.skipReason = reason
+	r.results = append(r.results, t)
+}
+
+// fail remembers that the test failed, or was skipped, so the tests that refer to it can be skipped.
+func (r *suiteRun) fail(name string) {
+	if r.failed == nil {
+		r.failed = make(map[string]bool)
+	}
+	r.failed[name] = true
+}
+
+// failedReference returns the failed test the templates of the test refer to, or "" if there is none.
+func (r *suiteRun) failedReference(t *Test) string {
+	for _, name := range t.references {
+		if r.failed[name] {
+			return name
+		}
+	}
+	return ""
+}
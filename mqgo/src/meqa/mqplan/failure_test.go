@@ -0,0 +1,140 @@
+package mqplan
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"meqa/mqutil"
+)
+
+// The create fails, get and again depend on it, find doesn't.
+const failureSuite = `
+pets:
+- name: meqa_init
+  onFailure: %s
+- name: create
+  method: post
+  path: /pet
+  bodyParams:
+    id: 7
+    name: doggie
+    photoUrls: []
+- name: get
+  method: get
+  path: /pet/{petId}
+  pathParams:
+    petId: '{{create.outputs.id}}'
+- name: again
+  method: get
+  path: /pet/{petId}
+  pathParams:
+    petId: '{{get.pathParams.petId}}'
+- name: find
+  method: get
+  path: /pet/findByStatus
+  queryParams:
+    status: available
+`
+
+// runOnFailure runs the suite with the policy against a server that fails the posts.
+func runOnFailure(t *testing.T, policy string) (map[string]int, []string, *TestPlan) {
+	server := newStatusServer(map[string]int{http.MethodPost: http.StatusInternalServerError})
+	defer server.Close()
+	plan := newTestPlan(t, loadPetstore(t), strings.Replace(failureSuite, "%s", policy, 1), server.URL)
+	counts, err := plan.Run("pets", nil)
+	if err == nil {
+		t.Errorf("%s: expected the error of the create", policy)
+	}
+	return counts, server.paths(), plan
+}
+
+func TestOnFailureStop(t *testing.T) {
+	counts, requests, _ := runOnFailure(t, OnFailureStop)
+	if !equalStrings(requests, []string{"POST /pet"}) {
+		t.Errorf("expected the suite to stop after the create, got %v", requests)
+	}
+	// meqa_init is counted in the total.
+	if counts[mqutil.Total] != 5 || counts[mqutil.Failed] != 1 || counts[mqutil.Skipped] != 4 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
+
+func TestOnFailureContinue(t *testing.T) {
+	counts, requests, _ := runOnFailure(t, OnFailureContinue)
+	if len(requests) != 4 {
+		t.Errorf("expected all the tests to run, got %v", requests)
+	}
+	if counts[mqutil.Failed]+counts[mqutil.Passed] != 4 || counts[mqutil.Skipped] != 0 || counts[mqutil.SkippedDependent] != 0 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
+
+func TestOnFailureSkipDependents(t *testing.T) {
+	counts, requests, plan := runOnFailure(t, OnFailureSkipDependents)
+	if !equalStrings(requests, []string{"POST /pet", "GET /pet/findByStatus"}) {
+		t.Errorf("expected only the independent test to run, got %v", requests)
+	}
+	if counts[mqutil.Failed] != 1 || counts[mqutil.SkippedDependent] != 2 ||
+		counts[mqutil.Passed] != 1 || counts[mqutil.Skipped] != 0 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+	// The tests that refer to a skipped test are skipped too.
+	reasons := make(map[string]string)
+	for _, test := range plan.resultList {
+		reasons[test.Name] = test.skipReason
+	}
+	if reasons["get"] != "it refers to create that didn't pass" || reasons["again"] != "it refers to get that didn't pass" ||
+		len(reasons["find"]) > 0 {
+		t.Errorf("unexpected skip reasons %v", reasons)
+	}
+}
+
+func TestOnFailureRef(t *testing.T) {
+	server := newStatusServer(map[string]int{http.MethodPost: http.StatusInternalServerError})
+	defer server.Close()
+	plan := newTestPlan(t, loadPetstore(t), `
+create:
+- name: create
+  method: post
+  path: /pet
+  bodyParams:
+    id: 7
+    name: doggie
+    photoUrls: []
+---
+pets:
+- name: meqa_init
+  onFailure: skipDependents
+- name: create
+  ref: create
+- name: get
+  method: get
+  path: /pet/{petId}
+  pathParams:
+    petId: '{{create.outputs.id}}'
+- name: find
+  method: get
+  path: /pet/findByStatus
+  queryParams:
+    status: available
+`, server.URL)
+	counts, _ := plan.Run("pets", nil)
+	if requests := server.paths(); !equalStrings(requests, []string{"POST /pet", "GET /pet/findByStatus"}) {
+		t.Errorf("expected the suite to go on after the suite it refers to failed, got %v", requests)
+	}
+	if counts[mqutil.Failed] != 1 || counts[mqutil.SkippedDependent] != 1 || counts[mqutil.Passed] != 1 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
+
+func TestValidOnFailure(t *testing.T) {
+	for _, name := range []string{"", OnFailureStop, OnFailureContinue, OnFailureSkipDependents} {
+		if err := validOnFailure(name); err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+	if err := validOnFailure("retry"); err == nil {
+		t.Error("expected an error for an unknown onFailure")
+	}
+}
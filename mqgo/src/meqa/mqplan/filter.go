@@ -0,0 +1,158 @@
+package mqplan
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"meqa/mqutil"
+)
+
+// The reason given for the tests the filters leave out.
+const skippedByFilters = "it's left out by the filters"
+
+// Filter selects the tests to run. The tests it leaves out are counted and reported as skipped. The
+// empty fields select everything.
+type Filter struct {
+	IncludeSuite   string   // a regular expression the suite name must match
+	ExcludeSuite   string   // a regular expression the suite name must not match
+	IncludeTest    string   // a regular expression the test name must match
+	ExcludeTest    string   // a regular expression the test name must not match
+	IncludeMethods []string // the HTTP methods
+	ExcludeMethods []string
+	IncludePaths   []string // globs of the paths in the spec, e.g. /pet/*. * doesn't match a /, ** does.
+	ExcludePaths   []string
+	IncludeTags    []string // the tags of the operations in the spec
+	ExcludeTags    []string
+
+	includeSuite *regexp.Regexp
+	excludeSuite *regexp.Regexp
+	includeTest  *regexp.Regexp
+	excludeTest  *regexp.Regexp
+	includePaths []*regexp.Regexp
+	excludePaths []*regexp.Regexp
+}
+
+func compileFilterRegexp(option string, expr string) (*regexp.Regexp, error) {
+	if len(expr) == 0 {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid %s %s: %s", option, expr, err.Error()))
+	}
+	return re, nil
+}
+
+// globRegexp returns the regular expression of the path glob.
+func globRegexp(glob string) *regexp.Regexp {
+	expr := regexp.QuoteMeta(glob)
+	expr = strings.Replace(expr, `\*\*`, ".*", -1)
+	expr = strings.Replace(expr, `\*`, "[^/]*", -1)
+	expr = strings.Replace(expr, `\?`, "[^/]", -1)
+	return regexp.MustCompile("^" + expr + "$")
+}
+
+// SetFilter makes the test plan only run the tests the filter selects.
+func (plan *TestPlan) SetFilter(f *Filter) error {
+	var err error
+	if f.includeSuite, err = compileFilterRegexp("suite filter", f.IncludeSuite); err != nil {
+		return err
+	}
+	if f.excludeSuite, err = compileFilterRegexp("suite filter", f.ExcludeSuite); err != nil {
+		return err
+	}
+	if f.includeTest, err = compileFilterRegexp("test filter", f.IncludeTest); err != nil {
+		return err
+	}
+	if f.excludeTest, err = compileFilterRegexp("test filter", f.ExcludeTest); err != nil {
+		return err
+	}
+	f.includePaths = nil
+	for _, p := range f.IncludePaths {
+		f.includePaths = append(f.includePaths, globRegexp(p))
+	}
+	f.excludePaths = nil
+	for _, p := range f.ExcludePaths {
+		f.excludePaths = append(f.excludePaths, globRegexp(p))
+	}
+	plan.filter = f
+	return nil
+}
+
+// matchesRegexp returns whether the name matches the include expression and not the exclude one.
+func matchesRegexp(name string, include *regexp.Regexp, exclude *regexp.Regexp) bool {
+	return (include == nil || include.MatchString(name)) && (exclude == nil || !exclude.MatchString(name))
+}
+
+// containsFold returns whether one of the values is in the list, ignoring the case.
+func containsFold(list []string, values ...string) bool {
+	for _, s := range list {
+		for _, v := range values {
+			if strings.EqualFold(s, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesAnyPath(path string, globs []*regexp.Regexp) bool {
+	for _, re := range globs {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectsSuite returns whether the filter selects the suite by its name.
+func (f *Filter) selectsSuite(name string) bool {
+	return f == nil || matchesRegexp(name, f.includeSuite, f.excludeSuite)
+}
+
+// selects returns whether the filter selects the test.
+func (f *Filter) selects(plan *TestPlan, t *Test) bool {
+	if f == nil {
+		return true
+	}
+	if !matchesRegexp(t.Name, f.includeTest, f.excludeTest) {
+		return false
+	}
+	if (len(f.IncludeMethods) > 0 && !containsFold(f.IncludeMethods, t.Method)) || containsFold(f.ExcludeMethods, t.Method) {
+		return false
+	}
+	if (len(f.includePaths) > 0 && !matchesAnyPath(t.Path, f.includePaths)) || matchesAnyPath(t.Path, f.excludePaths) {
+		return false
+	}
+	if len(f.IncludeTags) > 0 || len(f.ExcludeTags) > 0 {
+		var tags []string
+		if plan.swagger != nil && plan.swagger.Paths != nil {
+			pathItem := plan.swagger.Paths.Paths[t.Path]
+			if op := GetOperationByMethod(&pathItem, t.Method); op != nil {
+				tags = op.Tags
+			}
+		}
+		if (len(f.IncludeTags) > 0 && !containsFold(f.IncludeTags, tags...)) || containsFold(f.ExcludeTags, tags...) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectsAnyTest returns whether the filter selects the suite and any of its tests. The suites that
+// only refer to other suites are selected, their tests are filtered when they run.
+func (f *Filter) selectsAnyTest(plan *TestPlan, tc *TestSuite) bool {
+	if f == nil {
+		return true
+	}
+	if !f.selectsSuite(tc.Name) {
+		return false
+	}
+	for _, t := range tc.Tests {
+		if len(t.Ref) != 0 || (t.Name != MeqaInit && f.selects(plan, t)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package mqplan
+
+import (
+	"testing"
+
+	"meqa/mqutil"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	cases := []struct {
+		glob    string
+		path    string
+		matches bool
+	}{
+		{"/pet/*", "/pet/{petId}", true},
+		{"/pet/*", "/pet/{petId}/uploadImage", false},
+		{"/pet/*", "/pet", false},
+		{"/pet/**", "/pet/{petId}/uploadImage", true},
+		{"/pet/{petId}", "/pet/{petId}", true},
+		{"/store/orde?/*", "/store/order/{orderId}", true},
+		{"/user.*", "/user/login", false},
+	}
+	for _, c := range cases {
+		if matches := globRegexp(c.glob).MatchString(c.path); matches != c.matches {
+			t.Errorf("%s %s: expected %v", c.glob, c.path, c.matches)
+		}
+	}
+}
+
+func TestFilterSelects(t *testing.T) {
+	plan := &TestPlan{}
+	plan.Init(loadPetstore(t), nil)
+	addPet := &Test{Name: "post_addPet_1", Method: "post", Path: "/pet"}
+	getPet := &Test{Name: "get_getPetById_2", Method: "get", Path: "/pet/{petId}"}
+	getOrder := &Test{Name: "get_getOrderById_3", Method: "get", Path: "/store/order/{orderId}"}
+	login := &Test{Name: "get_loginUser_4", Method: "get", Path: "/user/login"}
+	all := []*Test{addPet, getPet, getOrder, login}
+
+	cases := []struct {
+		name     string
+		filter   *Filter
+		selected []*Test
+	}{
+		{"nil", nil, all},
+		{"empty", &Filter{}, all},
+		{"include test", &Filter{IncludeTest: "Pet"}, []*Test{addPet, getPet}},
+		{"exclude test", &Filter{ExcludeTest: "_[12]$"}, []*Test{getOrder, login}},
+		{"include methods", &Filter{IncludeMethods: []string{"POST"}}, []*Test{addPet}},
+		{"exclude methods", &Filter{ExcludeMethods: []string{"post", "put"}}, []*Test{getPet, getOrder, login}},
+		{"include paths", &Filter{IncludePaths: []string{"/pet/*", "/user/**"}}, []*Test{getPet, login}},
+		{"exclude paths", &Filter{ExcludePaths: []string{"/pet**"}}, []*Test{getOrder, login}},
+		{"include tags", &Filter{IncludeTags: []string{"Store", "user"}}, []*Test{getOrder, login}},
+		{"exclude tags", &Filter{ExcludeTags: []string{"pet"}}, []*Test{getOrder, login}},
+		{"all of them", &Filter{IncludeTags: []string{"pet", "store"}, ExcludeMethods: []string{"post"}, ExcludeTest: "Order"}, []*Test{getPet}},
+	}
+	for _, c := range cases {
+		if c.filter != nil {
+			if err := plan.SetFilter(c.filter); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var selected []*Test
+		for _, test := range all {
+			if c.filter.selects(plan, test) {
+				selected = append(selected, test)
+			}
+		}
+		if len(selected) != len(c.selected) {
+			t.Errorf("%s: expected %d tests, got %d", c.name, len(c.selected), len(selected))
+			continue
+		}
+		for i := range selected {
+			if selected[i] != c.selected[i] {
+				t.Errorf("%s: expected %s, got %s", c.name, c.selected[i].Name, selected[i].Name)
+			}
+		}
+	}
+
+	if err := plan.SetFilter(&Filter{IncludeSuite: "("}); err == nil {
+		t.Error("expected an error for an invalid regular expression")
+	}
+	if err := plan.SetFilter(&Filter{ExcludeTest: "[a-"}); err == nil {
+		t.Error("expected an error for an invalid regular expression")
+	}
+}
+
+func TestFilterRun(t *testing.T) {
+	server := newStatusServer(nil)
+	defer server.Close()
+	plan := newTestPlan(t, loadPetstore(t), `
+pets:
+- name: create
+  method: post
+  path: /pet
+  bodyParams:
+    id: 7
+    name: doggie
+    photoUrls: []
+- name: find
+  method: get
+  path: /pet/findByStatus
+  queryParams:
+    status: available
+---
+users:
+- name: login
+  method: get
+  path: /user/login
+  queryParams:
+    username: alice
+    password: secret
+---
+all:
+- name: pets
+  ref: pets
+- name: users
+  ref: users
+`, server.URL)
+	if err := plan.SetFilter(&Filter{ExcludeSuite: "^users$", ExcludeMethods: []string{"post"}}); err != nil {
+		t.Fatal(err)
+	}
+	counts, errs := plan.RunSuites([]string{"pets", "users", "all"}, 1)
+	if requests := server.paths(); !equalStrings(requests, []string{"GET /pet/findByStatus", "GET /pet/findByStatus", "GET /user/login"}) {
+		t.Errorf("unexpected requests %v", requests)
+	}
+	for i, name := range []string{"pets", "users"} {
+		if errs[i] != nil {
+			t.Errorf("%s: unexpected error %v", name, errs[i])
+		}
+	}
+	if counts[0][mqutil.Passed] != 1 || counts[0][mqutil.Skipped] != 1 {
+		t.Errorf("pets: expected the create to be skipped, got %v", counts[0])
+	}
+	if counts[1][mqutil.Total] != 1 || counts[1][mqutil.Skipped] != 1 {
+		t.Errorf("users: expected the suite to be skipped, got %v", counts[1])
+	}
+	// The suites referred to are run by the suite that refers to them, with the tests filtered.
+	if counts[2][mqutil.Passed] != 2 || counts[2][mqutil.Skipped] != 1 {
+		t.Errorf("all: unexpected counts %v", counts[2])
+	}
+
+	skipped := 0
+	for _, test := range plan.resultList {
+		if test.skipReason == skippedByFilters {
+			skipped++
+		}
+	}
+	if skipped != 3 {
+		t.Errorf("expected 3 tests reported as skipped by the filters, got %d", skipped)
+	}
+}
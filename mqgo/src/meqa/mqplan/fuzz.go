@@ -0,0 +1,557 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"meqa/mqswag"
+	"meqa/mqutil"
+)
+
+// The kinds of problems the fuzzer looks for.
+const (
+	FuzzServerError    = "server_error"    // the server returned a 5xx status
+	FuzzTimeout        = "timeout"         // the server didn't respond in time
+	FuzzNoResponse     = "no_response"     // e.g. the server closed the connection
+	FuzzSchemaMismatch = "schema_mismatch" // the response doesn't match the schema in the spec
+)
+
+// The most requests we send to make a crashing request smaller.
+const maxMinimizeRuns = 64
+
+// FuzzFinding is a problem the fuzzer found in an operation.
+type FuzzFinding struct {
+	Kind     string
+	Method   string
+	Path     string
+	Status   int // 0 if there is no response
+	Message  string
+	Count    int    // how many requests ran into it
+	PlanFile string // the test plan that reproduces it
+}
+
+// The strings we mutate the parameters to.
+var unicodeStrings = []string{
+	"\u00e9\u00e8\u00ea \u4e2d\u6587 \u0639\u0631\u0628\u064a",
+	"\U0001F600\U0001F4A9\U0001F525\U0001F1FA\U0001F1F8",
+	"\u202etxt.exe",                   // a right to left override
+	"\ufeff\u200b\u200d\u2060",        // a BOM and the zero width characters
+	"a\u0000b",                        // a NUL in the middle
+	"Z\u0351\u0367\u0313\u0364\u0310", // combining characters
+}
+
+var injectionStrings = []string{
+	"' OR '1'='1",
+	"1; DROP TABLE users; --",
+	"\" OR \"\"=\"",
+	"<script>alert(1)</script>",
+	"../../../../../../etc/passwd",
+	"$(cat /etc/passwd)",
+	"`id`",
+	"${jndi:ldap://127.0.0.1/a}",
+	"%s%s%s%s%n",
+	"{\"$gt\": \"\"}",
+	"\r\nX-Injected: true",
+}
+
+var confusedValues = []interface{}{
+	true,
+	int64(-9223372036854775808),
+	1.7976931348623157e308,
+	"0",
+	[]interface{}{1, "a"},
+	map[string]interface{}{"a": 1},
+}
+
+// fuzzSlot is where a mutated value goes. The whole body has no name.
+type fuzzSlot struct {
+	in   string
+	name string
+}
+
+func (s fuzzSlot) String() string {
+	if len(s.name) == 0 {
+		return s.in
+	}
+	return s.in + "_" + s.name
+}
+
+// fuzzMutation replaces a valid value with one likely to break the server. It returns false if it
+// doesn't apply to the slot.
+type fuzzMutation struct {
+	name   string
+	mutate func(slot fuzzSlot, value interface{}, r *rand.Rand) (interface{}, bool)
+}
+
+var fuzzMutations = []fuzzMutation{
+	{"type_confusion", mutateType},
+	{"unicode", func(slot fuzzSlot, value interface{}, r *rand.Rand) (interface{}, bool) {
+		return pickString(slot, unicodeStrings, r)
+	}},
+	{"huge", mutateHuge},
+	{"null", mutateNull},
+	{"injection", func(slot fuzzSlot, value interface{}, r *rand.Rand) (interface{}, bool) {
+		return pickString(slot, injectionStrings, r)
+	}},
+	{"deep_nesting", mutateNesting},
+}
+
+func mutateType(slot fuzzSlot, value interface{}, r *rand.Rand) (interface{}, bool) {
+	var values []interface{}
+	for _, v := range confusedValues {
+		if value == nil || reflect.TypeOf(v) != reflect.TypeOf(value) {
+			values = append(values, v)
+		}
+	}
+	return values[r.Intn(len(values))], true
+}
+
+func mutateHuge(slot fuzzSlot, value interface{}, r *rand.Rand) (interface{}, bool) {
+	size := 1 << 16
+	switch slot.in {
+	case "header":
+		size = 1 << 13
+	case "body":
+		size = 1 << 20
+	}
+	return strings.Repeat("A", size), true
+}
+
+func mutateNull(slot fuzzSlot, value interface{}, r *rand.Rand) (interface{}, bool) {
+	if slot.in == "path" {
+		// Leaving out a path parameter changes the path instead.
+		return nil, false
+	}
+	if slot.in == "body" && len(slot.name) == 0 {
+		return "null", true
+	}
+	// A nil parameter is left out of the request.
+	return nil, true
+}
+
+func mutateNesting(slot fuzzSlot, value interface{}, r *rand.Rand) (interface{}, bool) {
+	if slot.in != "body" {
+		return nil, false
+	}
+	return nested(1000), true
+}
+
+// nested returns an array nested depth levels deep.
+func nested(depth int) interface{} {
+	var v interface{} = []interface{}{0}
+	for i := 1; i < depth; i++ {
+		v = []interface{}{v}
+	}
+	return v
+}
+
+// nestingDepth returns how deep the arrays of one item are nested.
+func nestingDepth(v interface{}) int {
+	depth := 0
+	for {
+		a, ok := v.([]interface{})
+		if !ok || len(a) != 1 {
+			return depth
+		}
+		depth++
+		v = a[0]
+	}
+}
+
+// pickString picks one of the strings. The go http client refuses to send the control characters in a
+// header, so they are left out of the headers.
+func pickString(slot fuzzSlot, strs []string, r *rand.Rand) (interface{}, bool) {
+	var candidates []string
+	for _, s := range strs {
+		if slot.in != "header" || !strings.ContainsAny(s, "\r\n\x00") {
+			candidates = append(candidates, s)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, false
+	}
+	return candidates[r.Intn(len(candidates))], true
+}
+
+// paramsMap returns the parameter map of the slot.
+func (p *TestParams) paramsMap(in string) map[string]interface{} {
+	switch in {
+	case "path":
+		return p.PathParams
+	case "query":
+		return p.QueryParams
+	case "header":
+		return p.HeaderParams
+	case "formData":
+		return p.FormParams
+	case "body":
+		m, _ := p.BodyParams.(map[string]interface{})
+		return m
+	}
+	return nil
+}
+
+func (p *TestParams) get(slot fuzzSlot) interface{} {
+	if slot.in == "body" && len(slot.name) == 0 {
+		return p.BodyParams
+	}
+	return p.paramsMap(slot.in)[slot.name]
+}
+
+func (p *TestParams) set(slot fuzzSlot, value interface{}) {
+	if slot.in == "path" && value != nil {
+		// The path parameters are put in the path as they are.
+		value = url.PathEscape(mqutil.InterfaceToJsonString(value))
+	}
+	if slot.in == "body" && len(slot.name) == 0 {
+		p.BodyParams = value
+		return
+	}
+	if m := p.paramsMap(slot.in); m != nil {
+		m[slot.name] = value
+	}
+}
+
+func (p *TestParams) duplicate() TestParams {
+	dup := TestParams{
+		QueryParams:  mqutil.MapCopy(p.QueryParams),
+		FormParams:   mqutil.MapCopy(p.FormParams),
+		PathParams:   mqutil.MapCopy(p.PathParams),
+		HeaderParams: mqutil.MapCopy(p.HeaderParams),
+		BodyParams:   p.BodyParams,
+	}
+	if m, ok := p.BodyParams.(map[string]interface{}); ok {
+		dup.BodyParams = mqutil.MapCopy(m)
+	} else if a, ok := p.BodyParams.([]interface{}); ok {
+		dup.BodyParams = mqutil.ArrayCopy(a)
+	}
+	return dup
+}
+
+// slots returns the parameters that can be mutated, sorted.
+func (p *TestParams) slots() []fuzzSlot {
+	var slots []fuzzSlot
+	for _, in := range []string{"path", "query", "header", "formData", "body"} {
+		var names []string
+		for name := range p.paramsMap(in) {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			slots = append(slots, fuzzSlot{in, name})
+		}
+	}
+	if p.BodyParams != nil {
+		slots = append(slots, fuzzSlot{"body", ""})
+	}
+	return slots
+}
+
+// fuzzer sends the mutated requests and keeps the findings.
+type fuzzer struct {
+	plan      *TestPlan
+	suite     *TestSuite
+	timeout   time.Duration
+	outputDir string
+	testId    int
+	findings  map[string]*FuzzFinding
+	order     []*FuzzFinding
+}
+
+// fuzzRequest is a request the fuzzer sends, with the slot it mutated.
+type fuzzRequest struct {
+	node     *mqswag.DAGNode
+	params   TestParams
+	slot     *fuzzSlot // nil if nothing was mutated
+	mutation string
+}
+
+func (f *fuzzer) newTest(req *fuzzRequest) *Test {
+	f.testId++
+	t := CreateTestFromOp(req.node, f.testId)
+	if req.slot != nil {
+		t.Name += "_" + req.slot.String() + "_" + req.mutation
+		// Once fixed, the server should reject the request.
+		t.Expect = map[string]interface{}{ExpectStatus: ExpectClientError}
+	}
+	t.TestParams = req.params.duplicate()
+	t.Init(f.suite)
+	return t
+}
+
+// send runs the request and returns the finding, or nil if the server handled it fine.
+func (f *fuzzer) send(req *fuzzRequest) (*Test, *FuzzFinding) {
+	t := f.newTest(req).Duplicate()
+	t.Run(f.suite)
+	finding := &FuzzFinding{Method: t.Method, Path: t.Path, Count: 1}
+	if t.err != nil {
+		finding.Kind = FuzzNoResponse
+		if t.duration() >= f.timeout {
+			finding.Kind = FuzzTimeout
+		}
+		finding.Message = mqutil.ErrorMessage(t.err)
+		return t, finding
+	}
+	if t.resp == nil {
+		// The request wasn't sent, e.g. we don't have the credentials.
+		return t, nil
+	}
+	finding.Status = t.resp.StatusCode()
+	if finding.Status >= 500 {
+		finding.Kind = FuzzServerError
+		finding.Message = string(t.resp.Body())
+		return t, finding
+	}
+	if err := t.responseSchemaError(); err != nil {
+		finding.Kind = FuzzSchemaMismatch
+		finding.Message = err.Error()
+		return t, finding
+	}
+	return t, nil
+}
+
+// responseSchemaError checks the JSON response against the schema in the spec for the status.
+func (t *Test) responseSchemaError() error {
+	respSchema := (*mqswag.Schema)(t.responseSpec(t.resp.StatusCode()).Schema)
+	body := t.resp.Body()
+	if respSchema == nil || len(body) == 0 {
+		return nil
+	}
+	var obj interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if d.Decode(&obj) != nil {
+		// Not JSON, e.g. XML.
+		return nil
+	}
+	return respSchema.Parses("", obj, make(map[string][]interface{}), true, t.db.Swagger)
+}
+
+func (finding *FuzzFinding) key() string {
+	return fmt.Sprintf("%s %s %s %d", finding.Kind, finding.Method, finding.Path, finding.Status)
+}
+
+func (finding *FuzzFinding) same(other *FuzzFinding) bool {
+	return other != nil && finding.key() == other.key()
+}
+
+// minimize makes the request that ran into the finding smaller: it leaves out the other parameters
+// and shortens the mutated value, as long as the request still runs into the same problem.
+func (f *fuzzer) minimize(req *fuzzRequest, finding *FuzzFinding) *fuzzRequest {
+	runs := 0
+	try := func(candidate *fuzzRequest) bool {
+		if runs >= maxMinimizeRuns {
+			return false
+		}
+		runs++
+		_, found := f.send(candidate)
+		return finding.same(found)
+	}
+	with := func(slot fuzzSlot, value interface{}) *fuzzRequest {
+		candidate := *req
+		candidate.params = req.params.duplicate()
+		candidate.params.set(slot, value)
+		return &candidate
+	}
+
+	for _, slot := range req.params.slots() {
+		if slot.in == "path" || len(slot.name) == 0 || req.params.get(slot) == nil || (req.slot != nil && *req.slot == slot) {
+			continue
+		}
+		if candidate := with(slot, nil); try(candidate) {
+			req = candidate
+		}
+	}
+	if req.slot == nil {
+		return req
+	}
+	for {
+		value := req.params.get(*req.slot)
+		var smaller interface{}
+		if s, ok := value.(string); ok && len(s) > 1 && req.slot.in != "path" {
+			smaller = s[:len(s)/2]
+		} else if depth := nestingDepth(value); depth > 1 {
+			smaller = nested(depth / 2)
+		} else {
+			return req
+		}
+		candidate := with(*req.slot, smaller)
+		if !try(candidate) {
+			return req
+		}
+		req = candidate
+	}
+}
+
+// save writes a test plan that sends the request to the output directory.
+func (f *fuzzer) save(req *fuzzRequest, finding *FuzzFinding) error {
+	t := f.newTest(req)
+	t.TestParams = jsonNumbersToValues(t.TestParams)
+	if finding.Kind == FuzzSchemaMismatch {
+		t.Expect = map[string]interface{}{ExpectStatus: finding.Status}
+	}
+
+	plan := &TestPlan{}
+	plan.Init(f.plan.swagger, nil)
+	plan.comment = fmt.Sprintf("Found by mqgo fuzz: %s %s %s", strings.ToUpper(finding.Method), finding.Path, finding.Kind)
+	if finding.Status > 0 {
+		plan.comment += fmt.Sprintf(" (status %d)", finding.Status)
+	}
+	plan.comment += "\n" + firstLine(finding.Message)
+	name := fmt.Sprintf("%s -- %s -- %s", finding.Path, finding.Method, finding.Kind)
+	plan.Add(CreateTestSuite(name, []*Test{t}, plan))
+
+	fileName := fmt.Sprintf("%s_%s", OperationName(req.node), finding.Kind)
+	if finding.Status > 0 {
+		fileName += fmt.Sprintf("_%d", finding.Status)
+	}
+	finding.PlanFile = filepath.Join(f.outputDir, fileName+".yml")
+	return plan.DumpToFile(finding.PlanFile)
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[:i]
+	}
+	if len(s) > 200 {
+		s = s[:200] + "..."
+	}
+	return s
+}
+
+// jsonNumbersToValues turns the json numbers in the parameters to int64 or float64, so they are
+// written to yaml as numbers.
+func jsonNumbersToValues(p TestParams) TestParams {
+	for _, m := range []map[string]interface{}{p.PathParams, p.QueryParams, p.HeaderParams, p.FormParams} {
+		numbersToValues(m)
+	}
+	p.BodyParams = numbersToValues(p.BodyParams)
+	return p
+}
+
+// numbersToValues converts the json numbers in the value to ints and floats, in place.
+func numbersToValues(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range value {
+			value[k] = numbersToValues(e)
+		}
+	case []interface{}:
+		for i, e := range value {
+			value[i] = numbersToValues(e)
+		}
+	}
+	return v
+}
+
+// generate resolves the parameters of a valid request to the operation.
+func (f *fuzzer) generate(node *mqswag.DAGNode) (TestParams, error) {
+	t := f.newTest(&fuzzRequest{node: node}).Duplicate()
+	err := t.ResolveParameters(f.suite)
+	if err != nil {
+		return TestParams{}, err
+	}
+	// Pin the optional parameters we left out, so that the request doesn't change when we send it again.
+	for _, p := range t.op.Parameters {
+		if m := t.paramsMap(p.In); m != nil && p.In != "body" {
+			if _, ok := m[p.Name]; !ok {
+				m[p.Name] = nil
+			}
+		}
+	}
+	return t.TestParams, nil
+}
+
+// record adds the finding. The first request that runs into a problem is minimized and saved.
+func (f *fuzzer) record(req *fuzzRequest, finding *FuzzFinding) {
+	if existing := f.findings[finding.key()]; existing != nil {
+		existing.Count++
+		return
+	}
+	f.findings[finding.key()] = finding
+	f.order = append(f.order, finding)
+	fmt.Printf("%v... found %s: %s %s%v\n", mqutil.RED, finding.Kind, strings.ToUpper(finding.Method), finding.Path, mqutil.END)
+	mqutil.Logger.Printf("fuzz found %s: %s %s: %s", finding.Kind, finding.Method, finding.Path, finding.Message)
+
+	req = f.minimize(req, finding)
+	if err := f.save(req, finding); err != nil {
+		mqutil.Logger.Print(err)
+		fmt.Printf("failed to save the test plan for %s: %s\n", finding.key(), err.Error())
+	}
+}
+
+// Fuzz sends requests with mutated parameters to the operations picked at random from the DAG until the
+// duration is over. The requests that get a 5xx status, time out or get a response that doesn't match the
+// spec are made as small as we can and saved to the output directory as test plans.
+func (plan *TestPlan) Fuzz(dag *mqswag.DAG, duration time.Duration, timeout time.Duration, outputDir string) ([]*FuzzFinding, error) {
+	var nodes []*mqswag.DAGNode
+	dag.IterateByWeight(func(previous *mqswag.DAGNode, current *mqswag.DAGNode) error {
+		if current.GetType() == mqswag.TypeOp {
+			nodes = append(nodes, current)
+		}
+		return nil
+	})
+	if len(nodes) == 0 {
+		return nil, mqutil.NewError(mqutil.ErrNotFound, "no operation to fuzz in the spec")
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, err
+	}
+	if plan.rand == nil {
+		plan.SetSeed(time.Now().UnixNano())
+	}
+
+	f := &fuzzer{plan: plan, timeout: timeout, outputDir: outputDir, findings: make(map[string]*FuzzFinding)}
+	f.suite = CreateTestSuite("fuzz", nil, plan)
+	f.suite.db = plan.db.CloneSchema()
+	r := plan.rand
+	skipped := make(map[*mqswag.DAGNode]bool)
+	deadline := time.Now().Add(duration)
+	for time.Now().Before(deadline) && len(skipped) < len(nodes) {
+		node := nodes[r.Intn(len(nodes))]
+		if skipped[node] {
+			continue
+		}
+		params, err := f.generate(node)
+		if err != nil {
+			// e.g. the operation needs a file.
+			mqutil.Logger.Printf("fuzz skips %s %s: %s", node.GetMethod(), node.GetName(), err.Error())
+			skipped[node] = true
+			continue
+		}
+
+		req := &fuzzRequest{node: node, params: params}
+		// Some of the requests are sent as they are, to create the objects the others refer to and to
+		// find the problems with the valid requests.
+		slots := params.slots()
+		if len(slots) > 0 && r.Intn(4) != 0 {
+			slot := slots[r.Intn(len(slots))]
+			mutation := fuzzMutations[r.Intn(len(fuzzMutations))]
+			if value, ok := mutation.mutate(slot, params.get(slot), r); ok {
+				req.params.set(slot, value)
+				req.slot = &slot
+				req.mutation = mutation.name
+			}
+		}
+		if _, finding := f.send(req); finding != nil {
+			f.record(req, finding)
+		}
+	}
+	return f.order, nil
+}
@@ -0,0 +1,152 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"meqa/mqswag"
+)
+
+func TestFuzzMutations(t *testing.T) {
+	r := globalRand
+	if _, ok := mutateNull(fuzzSlot{"path", "petId"}, 1, r); ok {
+		t.Error("null: a path parameter can't be left out")
+	}
+	if v, ok := mutateNull(fuzzSlot{"body", ""}, map[string]interface{}{}, r); !ok || v != "null" {
+		t.Errorf("null: expected the body to be null, got %v", v)
+	}
+	if _, ok := mutateNesting(fuzzSlot{"query", "status"}, "sold", r); ok {
+		t.Error("deep_nesting: only the body can be nested")
+	}
+	if depth := nestingDepth(nested(5)); depth != 5 {
+		t.Errorf("expected the depth 5, got %d", depth)
+	}
+	for i := 0; i < 20; i++ {
+		if v, _ := mutateType(fuzzSlot{"query", "status"}, "sold", r); reflect.TypeOf(v) == reflect.TypeOf("") {
+			t.Fatalf("type_confusion: expected another type than string, got %v", v)
+		}
+		v, ok := pickString(fuzzSlot{"header", "api_key"}, injectionStrings, r)
+		if !ok || strings.ContainsAny(v.(string), "\r\n\x00") {
+			t.Fatalf("the header got a control character: %q", v)
+		}
+	}
+}
+
+// newFuzzer returns a fuzzer of the petstore that sends the requests to the handler.
+func newFuzzer(t *testing.T, handler http.HandlerFunc) (*fuzzer, *mqswag.DAG, func()) {
+	swagger := loadPetstore(t)
+	dag := mqswag.NewDAG()
+	if err := swagger.AddToDAG(dag); err != nil {
+		t.Fatal(err)
+	}
+	dag.Sort()
+	dag.CheckWeight()
+	server := httptest.NewServer(handler)
+	dir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	plan := &TestPlan{}
+	plan.Init(swagger, db)
+	plan.BaseURL = server.URL
+	plan.SetSeed(42)
+	f := &fuzzer{plan: plan, timeout: time.Second, outputDir: dir, findings: make(map[string]*FuzzFinding)}
+	f.suite = CreateTestSuite("fuzz", nil, plan)
+	f.suite.db = plan.db.CloneSchema()
+	return f, dag, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// crashOnLongName fails with a 500 when the name of the pet is 1000 bytes or longer.
+func crashOnLongName(w http.ResponseWriter, r *http.Request) {
+	var pet map[string]interface{}
+	body, _ := ioutil.ReadAll(r.Body)
+	json.Unmarshal(body, &pet)
+	if name, _ := pet["name"].(string); len(name) >= 1000 {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("name too long"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func TestFuzzMinimize(t *testing.T) {
+	f, dag, done := newFuzzer(t, crashOnLongName)
+	defer done()
+	node := dag.NameMap[mqswag.GetDAGName(mqswag.TypeOp, "/pet", "post")]
+	params, err := f.generate(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot := fuzzSlot{"body", "name"}
+	req := &fuzzRequest{node: node, params: params, slot: &slot, mutation: "huge"}
+	value, _ := mutateHuge(slot, nil, globalRand)
+	req.params.set(slot, value)
+	_, finding := f.send(req)
+	if finding == nil || finding.Kind != FuzzServerError || finding.Status != http.StatusInternalServerError {
+		t.Fatalf("expected a server error, got %+v", finding)
+	}
+
+	// The name is halved down to 1024 bytes, and the other properties are left out.
+	minimized := f.minimize(req, finding)
+	if name, _ := minimized.params.get(slot).(string); len(name) != 1024 {
+		t.Errorf("expected a name of 1024 bytes, got %d", len(name))
+	}
+	for _, other := range minimized.params.slots() {
+		if other.in == "body" && len(other.name) > 0 && other != slot && minimized.params.get(other) != nil {
+			t.Errorf("%s wasn't left out: %v", other, minimized.params.get(other))
+		}
+	}
+	// The request we started from is left as it was.
+	if name, _ := req.params.get(slot).(string); len(name) != 1<<20 {
+		t.Errorf("the original request changed, the name has %d bytes", len(name))
+	}
+}
+
+func TestFuzz(t *testing.T) {
+	f, dag, done := newFuzzer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/pet" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer done()
+	findings, err := f.plan.Fuzz(dag, 500*time.Millisecond, time.Second, f.outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var crash *FuzzFinding
+	for _, finding := range findings {
+		if finding.Kind == FuzzServerError {
+			if finding.Method != "post" || finding.Path != "/pet" || crash != nil {
+				t.Errorf("unexpected finding %+v", finding)
+			}
+			crash = finding
+		}
+	}
+	if crash == nil {
+		t.Fatalf("the crash of post /pet wasn't found: %+v", findings)
+	}
+	data, err := ioutil.ReadFile(crash.PlanFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan := string(data); !strings.Contains(plan, "Found by mqgo fuzz: POST /pet server_error (status 500)") ||
+		!strings.Contains(plan, "/pet -- post -- server_error") {
+		t.Errorf("unexpected test plan:\n%s", plan)
+	}
+}
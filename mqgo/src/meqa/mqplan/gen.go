@@ -50,16 +50,22 @@ func GetLastPathParam(name string) string {
 	return ""
 }
 
-func CreateTestFromOp(opNode *mqswag.DAGNode, testId int) *Test {
+// OperationName returns the method and the operation id (or the last path element) of the operation,
+// e.g. post_addPet.
+func OperationName(opNode *mqswag.DAGNode) string {
 	op := opNode.Data.((*spec.Operation))
-	t := &Test{}
-	t.Path = opNode.GetName()
-	t.Method = opNode.GetMethod()
 	opId := op.ID
 	if len(opId) == 0 {
-		opId = GetLastPathElement(t.Path)
+		opId = GetLastPathElement(opNode.GetName())
 	}
-	t.Name = fmt.Sprintf("%s_%s_%d", t.Method, opId, testId)
+	return fmt.Sprintf("%s_%s", opNode.GetMethod(), opId)
+}
+
+func CreateTestFromOp(opNode *mqswag.DAGNode, testId int) *Test {
+	t := &Test{}
+	t.Path = opNode.GetName()
+	t.Method = opNode.GetMethod()
+	t.Name = fmt.Sprintf("%s_%d", OperationName(opNode), testId)
 
 	return t
 }
@@ -106,28 +112,6 @@ func GenerateTestsForObject(create *mqswag.DAGNode, obj *mqswag.DAGNode, plan *T
 		plan.Add(testSuite)
 	}
 
-	// a loop where we pick random operations and pair it with the create operation.
-	// This would generate a few objects.
-	/* disable random stuff during development
-	testId = 0
-	testSuite = &TestSuite{nil, fmt.Sprintf("%s -- %s -- random", createPath, objName)}
-	for i := 0; i < 2*len(obj.Children); i++ {
-		j := rand.Intn(len(obj.Children))
-		child := obj.Children[j]
-		if child.GetType() != mqswag.TypeOp {
-			mqutil.Logger.Printf("unexpected: (%s) has a child (%s) that's not an operation", obj.Name, child.Name)
-			continue
-		}
-		testId++
-		testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(create, testId))
-		testId++
-		testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(child, testId))
-	}
-	if len(testSuite.Tests) > 0 {
-		plan.Add(testSuite)
-	}
-	*/
-
 	return nil
 }
 
@@ -332,3 +316,49 @@ func GenerateSimpleTestPlan(swagger *mqswag.Swagger, dag *mqswag.DAG) (*TestPlan
 
 	return testPlan, nil
 }
+
+// The test plan generation algorithms.
+const (
+	AlgoSimple   = "simple"
+	AlgoObject   = "object"
+	AlgoPath     = "path"
+	AlgoNegative = "negative"
+	AlgoRandom   = "random"
+	AlgoAll      = "all"
+)
+
+// AlgoList is the list of algorithms that "all" generates.
+var AlgoList []string = []string{AlgoSimple, AlgoObject, AlgoPath, AlgoNegative, AlgoRandom}
+
+// GenerateOptions are the settings of the test plan generation algorithms.
+type GenerateOptions struct {
+	Whitelist map[string]bool // the paths the path algorithm generates test suites for, nil for all of them
+	Walks     int             // the number of test suites the random algorithm generates
+	WalkSteps int             // the number of operations in each test suite of the random algorithm
+	Seed      int64           // the seed of the random algorithm, 0 for a new seed every time
+}
+
+// DefaultGenerateOptions returns the options used when none are given.
+func DefaultGenerateOptions() *GenerateOptions {
+	return &GenerateOptions{Walks: DefaultRandomWalks, WalkSteps: DefaultRandomWalkSteps}
+}
+
+// GenerateTestPlanByAlgorithm generates the test plan using the named algorithm. The options can be
+// nil for the defaults.
+func GenerateTestPlanByAlgorithm(algo string, swagger *mqswag.Swagger, dag *mqswag.DAG, options *GenerateOptions) (*TestPlan, error) {
+	if options == nil {
+		options = DefaultGenerateOptions()
+	}
+	switch algo {
+	case AlgoPath:
+		return GeneratePathTestPlan(swagger, dag, options.Whitelist)
+	case AlgoObject:
+		return GenerateTestPlan(swagger, dag)
+	case AlgoNegative:
+		return GenerateNegativeTestPlan(swagger, dag)
+	case AlgoRandom:
+		return GenerateRandomTestPlan(swagger, dag, options.Walks, options.WalkSteps, options.Seed)
+	default:
+		return GenerateSimpleTestPlan(swagger, dag)
+	}
+}
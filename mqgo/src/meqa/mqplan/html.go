@@ -0,0 +1,189 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/resty.v0"
+	"gopkg.in/yaml.v2"
+
+	"meqa/mqutil"
+)
+
+// The HTML report is a single static page, with the styles inlined and no scripts. The suites and
+// tests are <details> elements so they can be expanded and collapsed.
+const htmlReportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>meqa test report - {{.Time}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; }
+pre { background: #f6f6f6; border: 1px solid #ddd; padding: 0.5em; overflow-x: auto; white-space: pre-wrap; }
+details { margin: 0.3em 0; }
+details.suite { border: 1px solid #ccc; border-radius: 4px; padding: 0.3em 0.8em; }
+details.test { margin-left: 1.5em; }
+summary { cursor: pointer; }
+.counts span { margin-right: 1.5em; font-weight: bold; }
+.Passed { color: #2a8a2a; }
+.Failed, .TeardownFailed { color: #c62828; }
+.Skipped, .SkippedDependent { color: #1e5fb4; }
+.SchemaMismatch { color: #b08800; }
+.label { font-weight: bold; margin-top: 0.8em; }
+</style>
+</head>
+<body>
+<h1>meqa test report</h1>
+<p>{{.Time}}</p>
+<p class="counts">{{range .Counts}}<span class="{{.Name}}">{{.Name}}: {{.Count}}</span>{{end}}</p>
+{{range .Suites}}
+<details class="suite"{{if .Failed}} open{{end}}>
+<summary><b>{{.Name}}</b> <span class="Passed">{{.Passed}} passed</span>{{if .Failed}}, <span class="Failed">{{.Failed}} failed</span>{{end}}{{if .Skipped}}, <span class="Skipped">{{.Skipped}} skipped</span>{{end}}{{if .SchemaMismatch}}, <span class="SchemaMismatch">{{.SchemaMismatch}} schema mismatch</span>{{end}}</summary>
+{{range .Tests}}
+<details class="test">
+<summary><span class="{{.Status}}">{{.Status}}</span> {{.Name}} - {{.Method}} {{.Path}}{{if .StatusCode}} - {{.StatusCode}}{{end}} - {{.Duration}}{{if .SchemaError}} <span class="SchemaMismatch">schema mismatch</span>{{end}}</summary>
+{{if .URL}}<div class="label">URL</div><pre>{{.Method}} {{.URL}}</pre>{{end}}
+{{if .SkipReason}}<div class="label Skipped">Skipped</div><pre>{{.SkipReason}}</pre>{{end}}
+{{if .Error}}<div class="label Failed">Error</div><pre>{{.Error}}</pre>{{end}}
+{{if .Comparison}}<div class="label Failed">Client DB comparison</div><pre>{{.Comparison}}</pre>{{end}}
+{{if .Assertions}}<div class="label">Assertions</div><pre>{{range .Assertions}}<span class="{{if .Passed}}Passed{{else}}Failed{{end}}">{{if .Passed}}Passed{{else}}Failed{{end}}</span> {{.}}
+{{end}}</pre>{{end}}
+{{if .Attempts}}<div class="label">Attempts</div><pre>{{range .Attempts}}<span class="{{if .Passed}}Passed{{else}}Failed{{end}}">{{if .Passed}}Passed{{else}}Failed{{end}}</span> {{.}}
+{{end}}</pre>{{end}}
+<div class="label">Parameters</div><pre>{{.Params}}</pre>
+{{if .ResponseBody}}<div class="label">Response body</div><pre>{{.ResponseBody}}</pre>{{end}}
+{{if .SchemaError}}<div class="label SchemaMismatch">Schema mismatch</div><pre>{{.SchemaError}}</pre>{{end}}
+</details>
+{{end}}
+</details>
+{{end}}
+</body>
+</html>
+`
+
+type htmlCount struct {
+	Name  string
+	Count int
+}
+
+type htmlTest struct {
+	Name         string
+	Method       string
+	Path         string
+	URL          string
+	Status       string
+	StatusCode   int
+	Duration     string
+	Params       string
+	ResponseBody string
+	Error        string
+	SkipReason   string
+	Comparison   string
+	SchemaError  string
+	Assertions   []*Assertion
+	Attempts     []*Attempt
+}
+
+type htmlSuite struct {
+	Name           string
+	Passed         int
+	Failed         int
+	Skipped        int
+	SchemaMismatch int
+	Tests          []*htmlTest
+}
+
+type htmlReport struct {
+	Time   string
+	Counts []htmlCount
+	Suites []*htmlSuite
+}
+
+// prettyBody indents the body if it's json.
+func prettyBody(body []byte) string {
+	var out bytes.Buffer
+	if json.Indent(&out, body, "", "    ") == nil {
+		return out.String()
+	}
+	return string(body)
+}
+
+func (t *Test) toHTML() *htmlTest {
+	h := &htmlTest{Name: t.Name, Method: t.Method, Path: t.Path, URL: t.url, Status: mqutil.Passed}
+	h.Duration = t.duration().String()
+	paramBytes, _ := yaml.Marshal(t.TestParams)
+	h.Params = string(paramBytes)
+	if t.resp != nil {
+		h.StatusCode = t.resp.StatusCode()
+		h.ResponseBody = prettyBody(t.resp.Body())
+	}
+	if r, ok := t.responseError.(*resty.Response); ok && t.resp == nil {
+		h.StatusCode = r.StatusCode()
+		h.ResponseBody = prettyBody(r.Body())
+	}
+	if t.err != nil {
+		h.Status = mqutil.Failed
+		h.Error = mqutil.ErrorMessage(t.err)
+	}
+	if len(t.skipReason) > 0 {
+		h.Status = mqutil.Skipped
+		h.SkipReason = t.skipReason
+	}
+	// CompareGetResult records the objects that don't match as a string.
+	if s, ok := t.responseError.(string); ok {
+		h.Comparison = s
+	}
+	if t.schemaError != nil {
+		h.SchemaError = mqutil.ErrorMessage(t.schemaError)
+	}
+	h.Assertions = t.assertions
+	h.Attempts = t.Attempts
+	return h
+}
+
+// WriteHTMLToFile writes the result of the tests that were run as a static HTML page.
+func (plan *TestPlan) WriteHTMLToFile(path string) error {
+	report := &htmlReport{Time: time.Now().Format(time.RFC3339)}
+	for _, name := range []string{mqutil.Passed, mqutil.Failed, mqutil.Skipped, mqutil.SchemaMismatch, mqutil.Total} {
+		report.Counts = append(report.Counts, htmlCount{name, plan.ResultCounts[name]})
+	}
+	for _, name := range []string{mqutil.SkippedDependent, mqutil.TeardownFailed} {
+		if plan.ResultCounts[name] > 0 {
+			report.Counts = append(report.Counts, htmlCount{name, plan.ResultCounts[name]})
+		}
+	}
+	suiteNames, suiteTests := plan.resultsBySuite()
+	for _, name := range suiteNames {
+		suite := &htmlSuite{Name: name}
+		for _, t := range suiteTests[name] {
+			h := t.toHTML()
+			if h.Status == mqutil.Failed {
+				suite.Failed++
+			} else if h.Status == mqutil.Skipped {
+				suite.Skipped++
+			} else {
+				suite.Passed++
+			}
+			if t.schemaError != nil {
+				suite.SchemaMismatch++
+			}
+			suite.Tests = append(suite.Tests, h)
+		}
+		report.Suites = append(report.Suites, suite)
+	}
+
+	tmpl, err := template.New("report").Parse(htmlReportTemplate)
+	if err != nil {
+		return mqutil.NewError(mqutil.ErrInternal, fmt.Sprintf("invalid report template: %s", err.Error()))
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, report); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(mqutil.MaskSecrets(buf.String())), 0644)
+}
@@ -0,0 +1,67 @@
+package mqplan
+
+import (
+	"html"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"meqa/mqutil"
+)
+
+func writeHTML(t *testing.T, plan *TestPlan) string {
+	dir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "report.html")
+	if err = plan.WriteHTMLToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriteHTML(t *testing.T) {
+	page := writeHTML(t, runReportPlan(t))
+	for _, s := range []string{
+		"<b>pets</b>",
+		`<span class="Passed">1 passed</span>`,
+		`<span class="Failed">1 failed</span>`,
+		`<span class="Skipped">1 skipped</span>`,
+		`<span class="Passed">Passed</span> find - get /pet/findByStatus - 200`,
+		`<span class="Skipped">Skipped</span> leftOut`,
+		html.EscapeString(skippedByFilters),
+		`<span class="Failed">Failed</span> wrongStatus`,
+		`<details class="suite" open>`,
+	} {
+		if !strings.Contains(page, s) {
+			t.Errorf("the report doesn't have %s", s)
+		}
+	}
+	// No scripts or external files.
+	if strings.Contains(page, "<script") || strings.Contains(page, "<link") {
+		t.Error("the report isn't self-contained")
+	}
+}
+
+func TestWriteHTMLEscape(t *testing.T) {
+	mqutil.Logger = mqutil.NewStdLogger()
+	mqutil.AddSecret("html-secret")
+	test := &Test{Name: "<script>alert(1)</script>", Method: "get", Path: "/pet/1", suite: &TestSuite{Name: "pets"}}
+	test.err = mqutil.NewError(mqutil.ErrHttp, "bad token html-secret")
+	plan := &TestPlan{resultList: []*Test{test}}
+	page := writeHTML(t, plan)
+	if strings.Contains(page, "<script>") || !strings.Contains(page, "&lt;script&gt;") {
+		t.Error("the test name isn't escaped")
+	}
+	if strings.Contains(page, "html-secret") || !strings.Contains(page, "bad token "+mqutil.SecretMask) {
+		t.Error("the secret isn't masked")
+	}
+}
@@ -0,0 +1,161 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/resty.v0"
+
+	"meqa/mqutil"
+)
+
+// The JUnit XML report format understood by CI servers (e.g. Jenkins, GitLab).
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Type     string `xml:"type,attr"`
+	Contents string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitTestCase struct {
+	XMLName   xml.Name      `xml:"testcase"`
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name         `xml:"testsuite"`
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Errors    int              `xml:"errors,attr"`
+	Skipped   int              `xml:"skipped,attr"`
+	Time      string           `xml:"time,attr"`
+	Timestamp string           `xml:"timestamp,attr,omitempty"`
+	TestCases []*junitTestCase `xml:"testcase"`
+	duration  time.Duration
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr,omitempty"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Errors   int               `xml:"errors,attr"`
+	Skipped  int               `xml:"skipped,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// junitFailureDetail describes why the test failed, using the server response if there is one.
+func (t *Test) junitFailureDetail() string {
+	detail := fmt.Sprintf("%s %s\n", t.Method, t.Path)
+	switch r := t.responseError.(type) {
+	case *resty.Response:
+		detail += fmt.Sprintf("Response Status Code: %d\n%s\n", r.StatusCode(), string(r.Body()))
+	case nil:
+	default:
+		detail += fmt.Sprintf("%v\n", r)
+	}
+	if t.err != nil {
+		detail += mqutil.ErrorMessage(t.err)
+	}
+	return detail
+}
+
+func (t *Test) toJUnit(suiteName string) *junitTestCase {
+	tc := &junitTestCase{Name: t.Name, ClassName: suiteName, Time: junitTime(t.duration())}
+	if len(t.skipReason) > 0 {
+		tc.Skipped = &junitSkipped{Message: t.skipReason}
+	}
+	if t.err != nil {
+		failure := &junitFailure{Message: mqutil.ErrorMessage(t.err), Contents: t.junitFailureDetail()}
+		// Tests that got a different result from what's expected fail. Everything else (e.g. the
+		// server can't be reached, or the parameters can't be generated) is an error.
+		if e, ok := t.err.(mqutil.Error); ok && e.Type() == mqutil.ErrExpect {
+			failure.Type = "failure"
+			tc.Failure = failure
+		} else {
+			failure.Type = "error"
+			tc.Error = failure
+		}
+	}
+	for _, a := range t.assertions {
+		result := "PASSED"
+		if !a.Passed {
+			result = "FAILED"
+		}
+		tc.SystemOut += fmt.Sprintf("%s: %s\n", result, a)
+	}
+	for i, a := range t.Attempts {
+		tc.SystemOut += fmt.Sprintf("attempt %d: %s\n", i+1, a)
+	}
+	if t.schemaError != nil {
+		tc.SystemOut += fmt.Sprintf("WARNING: the response doesn't match the OpenAPI schema:\n%s", mqutil.ErrorMessage(t.schemaError))
+	}
+	return tc
+}
+
+// WriteJUnitToFile writes the result of the tests that were run in JUnit XML format. Each test
+// suite becomes a <testsuite> and each test a <testcase>. The tests skipped have a <skipped> element.
+func (plan *TestPlan) WriteJUnitToFile(path string) error {
+	report := &junitTestSuites{Name: "meqa"}
+	var totalTime time.Duration
+	suiteNames, suiteTests := plan.resultsBySuite()
+	for _, name := range suiteNames {
+		suite := &junitTestSuite{Name: name}
+		if first := suiteTests[name][0]; !first.startTime.IsZero() {
+			suite.Timestamp = first.startTime.Format("2006-01-02T15:04:05")
+		}
+		report.Suites = append(report.Suites, suite)
+		for _, t := range suiteTests[name] {
+			tc := t.toJUnit(name)
+			suite.TestCases = append(suite.TestCases, tc)
+			suite.Tests++
+			report.Tests++
+			if tc.Failure != nil {
+				suite.Failures++
+				report.Failures++
+			}
+			if tc.Error != nil {
+				suite.Errors++
+				report.Errors++
+			}
+			if tc.Skipped != nil {
+				suite.Skipped++
+				report.Skipped++
+			}
+			suite.duration += t.duration()
+			totalTime += t.duration()
+		}
+	}
+	for _, suite := range report.Suites {
+		suite.Time = junitTime(suite.duration)
+	}
+	report.Time = junitTime(totalTime)
+
+	buf := bytes.NewBufferString(xml.Header)
+	encoder := xml.NewEncoder(buf)
+	encoder.Indent("", "  ")
+	err := encoder.Encode(report)
+	if err != nil {
+		return err
+	}
+	buf.WriteString("\n")
+	return ioutil.WriteFile(path, []byte(mqutil.MaskSecrets(buf.String())), 0644)
+}
@@ -0,0 +1,89 @@
+package mqplan
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"meqa/mqutil"
+)
+
+func readJUnit(t *testing.T, plan *TestPlan) *junitTestSuites {
+	dir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "junit.xml")
+	if err = plan.WriteJUnitToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &junitTestSuites{}
+	if err = xml.Unmarshal(data, report); err != nil {
+		t.Fatalf("invalid JUnit XML: %s\n%s", err.Error(), string(data))
+	}
+	return report
+}
+
+func TestWriteJUnit(t *testing.T) {
+	report := readJUnit(t, runReportPlan(t))
+	if report.Tests != 3 || report.Failures != 1 || report.Errors != 0 || report.Skipped != 1 {
+		t.Errorf("unexpected counts: %d tests, %d failures, %d errors, %d skipped",
+			report.Tests, report.Failures, report.Errors, report.Skipped)
+	}
+	if len(report.Suites) != 1 || report.Suites[0].Name != "pets" || len(report.Suites[0].TestCases) != 3 {
+		t.Fatalf("expected the pets suite with 3 test cases, got %+v", report.Suites)
+	}
+	suite := report.Suites[0]
+	if suite.Tests != 3 || suite.Failures != 1 || suite.Skipped != 1 || len(suite.Timestamp) == 0 {
+		t.Errorf("unexpected suite: %+v", suite)
+	}
+	cases := make(map[string]*junitTestCase)
+	for _, tc := range suite.TestCases {
+		cases[tc.Name] = tc
+		if tc.ClassName != "pets" {
+			t.Errorf("%s: expected the class name pets, got %s", tc.Name, tc.ClassName)
+		}
+	}
+	if tc := cases["find"]; tc == nil || tc.Failure != nil || tc.Error != nil || tc.Skipped != nil {
+		t.Errorf("find: expected a pass, got %+v", tc)
+	}
+	if tc := cases["leftOut"]; tc == nil || tc.Skipped == nil || tc.Skipped.Message != skippedByFilters {
+		t.Errorf("leftOut: expected it skipped by the filters, got %+v", tc)
+	}
+	tc := cases["wrongStatus"]
+	if tc == nil || tc.Failure == nil || tc.Failure.Type != "failure" {
+		t.Fatalf("wrongStatus: expected a failure, got %+v", tc)
+	}
+	if !strings.Contains(tc.Failure.Contents, "get /pet/findByStatus") || !strings.Contains(tc.Failure.Contents, "Response Status Code: 200") {
+		t.Errorf("wrongStatus: unexpected failure detail %s", tc.Failure.Contents)
+	}
+}
+
+func TestJUnitError(t *testing.T) {
+	mqutil.Logger = mqutil.NewStdLogger()
+	test := &Test{Name: "unreachable", Method: "get", Path: "/pet/1"}
+	test.err = mqutil.NewError(mqutil.ErrHttp, "connection refused")
+	tc := test.toJUnit("pets")
+	if tc.Failure != nil || tc.Error == nil || tc.Error.Type != "error" || tc.Error.Message != "connection refused" {
+		t.Errorf("expected an error, got %+v", tc)
+	}
+
+	// The secrets are masked in the report.
+	mqutil.AddSecret("junit-secret")
+	plan := &TestPlan{}
+	test.err = mqutil.NewError(mqutil.ErrHttp, "bad token junit-secret")
+	test.suite = &TestSuite{Name: "pets"}
+	plan.resultList = []*Test{test}
+	report := readJUnit(t, plan)
+	if e := report.Suites[0].TestCases[0].Error; e == nil || strings.Contains(e.Message, "junit-secret") {
+		t.Errorf("expected the secret to be masked, got %+v", e)
+	}
+}
@@ -0,0 +1,343 @@
+package mqplan
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/xeipuuv/gojsonschema"
+
+	"meqa/mqswag"
+)
+
+// The expected status of the negative tests. The server should reject the request as a client error.
+const ExpectClientError = "4xx"
+
+// badValue is a value that breaks one of the constraints of a schema.
+type badValue struct {
+	kind  string // e.g. above_maximum
+	value interface{}
+}
+
+// The values of the wrong type, that the server can't parse as the type.
+var wrongTypeValues = map[string]string{
+	gojsonschema.TYPE_INTEGER: "not_an_integer",
+	gojsonschema.TYPE_NUMBER:  "not_a_number",
+	gojsonschema.TYPE_BOOLEAN: "not_a_boolean",
+	gojsonschema.TYPE_ARRAY:   "not_an_array",
+	gojsonschema.TYPE_OBJECT:  "not_an_object",
+}
+
+// The values that don't match the formats. They are all strings, so they only break the format.
+var badFormatValues = map[string]string{
+	"date":      "not-a-date",
+	"date-time": "not-a-date-time",
+	"email":     "not-an-email",
+	"uuid":      "not-a-uuid",
+	"uri":       "not a uri",
+	"url":       "not a url",
+	"hostname":  "-not a hostname-",
+	"ipv4":      "999.999.999.999",
+	"ipv6":      "not-an-ipv6",
+	"byte":      "!!not base64!!",
+}
+
+// The strings we try to find one that doesn't match a pattern.
+var patternMismatches = []string{"!", "~~~", "a b", "0", "a", ""}
+
+// badValues returns the values that break the constraints of the schema, one constraint each. When
+// inBody is false the value is sent as a string, so a wrong type can only be sent for the non-string
+// types.
+func badValues(schema *spec.Schema, inBody bool) []badValue {
+	if len(schema.Type) == 0 {
+		return nil
+	}
+	var values []badValue
+	schemaType := schema.Type[0]
+	isNumber := schemaType == gojsonschema.TYPE_INTEGER || schemaType == gojsonschema.TYPE_NUMBER
+
+	switch schemaType {
+	case gojsonschema.TYPE_INTEGER, gojsonschema.TYPE_NUMBER, gojsonschema.TYPE_BOOLEAN:
+		values = append(values, badValue{"wrong_type", wrongTypeValues[schemaType]})
+	case gojsonschema.TYPE_STRING:
+		if inBody {
+			values = append(values, badValue{"wrong_type", 12345})
+		}
+	case gojsonschema.TYPE_ARRAY:
+		if inBody {
+			values = append(values, badValue{"wrong_type", wrongTypeValues[schemaType]})
+		}
+		// An array with one bad item.
+		if schema.Items != nil && schema.Items.Schema != nil {
+			for _, b := range badValues(schema.Items.Schema, inBody) {
+				values = append(values, badValue{"item_" + b.kind, []interface{}{b.value}})
+			}
+		}
+		return values
+	case gojsonschema.TYPE_OBJECT:
+		if inBody {
+			values = append(values, badValue{"wrong_type", wrongTypeValues[schemaType]})
+		}
+		// We don't break the constraints of the properties at this level.
+		return values
+	default:
+		// e.g. file
+		return nil
+	}
+
+	number := func(f float64) interface{} {
+		if schemaType == gojsonschema.TYPE_INTEGER {
+			return int64(f)
+		}
+		return f
+	}
+	if isNumber && schema.Minimum != nil {
+		v := *schema.Minimum
+		if !schema.ExclusiveMinimum {
+			v--
+		}
+		values = append(values, badValue{"below_minimum", number(v)})
+	}
+	if isNumber && schema.Maximum != nil {
+		v := *schema.Maximum
+		if !schema.ExclusiveMaximum {
+			v++
+		}
+		values = append(values, badValue{"above_maximum", number(v)})
+	}
+	if schemaType == gojsonschema.TYPE_INTEGER && schema.Format == "int32" {
+		values = append(values, badValue{"invalid_format", int64(math.MaxInt32) + 1})
+	}
+
+	if schemaType == gojsonschema.TYPE_STRING {
+		if schema.MinLength != nil && *schema.MinLength > 0 {
+			values = append(values, badValue{"too_short", strings.Repeat("a", int(*schema.MinLength)-1)})
+		}
+		if schema.MaxLength != nil {
+			values = append(values, badValue{"too_long", strings.Repeat("a", int(*schema.MaxLength)+1)})
+		}
+		if len(schema.Pattern) > 0 {
+			// Patterns the go regexp package doesn't understand are skipped.
+			if re, err := regexp.Compile(schema.Pattern); err == nil {
+				for _, s := range patternMismatches {
+					if !re.MatchString(s) {
+						values = append(values, badValue{"pattern_mismatch", s})
+						break
+					}
+				}
+			}
+		}
+		if v, ok := badFormatValues[schema.Format]; ok {
+			values = append(values, badValue{"invalid_format", v})
+		}
+	}
+
+	if len(schema.Enum) > 0 {
+		if isNumber {
+			values = append(values, badValue{"invalid_enum", number(largestNumber(schema.Enum) + 1)})
+		} else {
+			values = append(values, badValue{"invalid_enum", stringNotInEnum(schema.Enum)})
+		}
+	}
+	return values
+}
+
+func largestNumber(enum []interface{}) float64 {
+	largest := 0.0
+	for _, e := range enum {
+		var f float64
+		if _, err := fmt.Sscan(fmt.Sprint(e), &f); err == nil && f > largest {
+			largest = f
+		}
+	}
+	return largest
+}
+
+func stringNotInEnum(enum []interface{}) string {
+	inEnum := make(map[string]bool)
+	for _, e := range enum {
+		inEnum[fmt.Sprint(e)] = true
+	}
+	v := "not_in_enum"
+	for inEnum[v] {
+		v += "_"
+	}
+	return v
+}
+
+// violation is a test that sends one bad parameter.
+type violation struct {
+	name  string // e.g. status_invalid_enum
+	in    string
+	param string
+	value interface{} // nil to leave out the parameter
+}
+
+func (v *violation) apply(t *Test) {
+	params := map[string]interface{}{v.param: v.value}
+	switch v.in {
+	case "path":
+		t.PathParams = params
+	case "query":
+		t.QueryParams = params
+	case "header":
+		t.HeaderParams = params
+	case "formData":
+		t.FormParams = params
+	case "body":
+		t.BodyParams = params
+	}
+}
+
+// operationViolations returns the ways to break the constraints of the parameters of the operation.
+func operationViolations(swagger *mqswag.Swagger, params []spec.Parameter) []*violation {
+	var violations []*violation
+	for _, p := range params {
+		if p.In == "body" {
+			violations = append(violations, bodyViolations(swagger, &p)...)
+			continue
+		}
+		if p.Type == "file" {
+			continue
+		}
+		// Leaving out a path parameter, or making it empty, changes the path instead.
+		if p.Required && p.In != "path" {
+			violations = append(violations, &violation{p.Name + "_missing", p.In, p.Name, nil})
+		}
+		schema := (*spec.Schema)(mqswag.CreateSchemaFromSimple(&p.SimpleSchema, &p.CommonValidations))
+		for _, b := range badValues(schema, false) {
+			if s, ok := b.value.(string); ok && len(s) == 0 && p.In == "path" {
+				continue
+			}
+			violations = append(violations, &violation{p.Name + "_" + b.kind, p.In, p.Name, b.value})
+		}
+	}
+	return violations
+}
+
+// bodyViolations breaks the constraints of the properties of a body object, one property at a time.
+// The rest of the body is generated as usual.
+func bodyViolations(swagger *mqswag.Swagger, p *spec.Parameter) []*violation {
+	if p.Schema == nil {
+		return nil
+	}
+	schema := p.Schema
+	if _, referred, err := swagger.GetReferredSchema((*mqswag.Schema)(schema)); err == nil && referred != nil {
+		schema = (*spec.Schema)(referred)
+	}
+	if len(schema.Properties) == 0 || (len(schema.Type) > 0 && schema.Type[0] != gojsonschema.TYPE_OBJECT) {
+		return nil
+	}
+	required := make(map[string]bool)
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	var names []string
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var violations []*violation
+	for _, name := range names {
+		if required[name] {
+			violations = append(violations, &violation{name + "_missing", "body", name, nil})
+		}
+		property := schema.Properties[name]
+		if len(property.Ref.String()) > 0 {
+			continue
+		}
+		for _, b := range badValues(&property, true) {
+			violations = append(violations, &violation{name + "_" + b.kind, "body", name, b.value})
+		}
+	}
+	return violations
+}
+
+// createOperations maps the classes to the operations that create them. The operations tagged with
+// the class are preferred, e.g. POST /user over POST /user/createWithArray.
+func createOperations(dag *mqswag.DAG) map[string]*mqswag.DAGNode {
+	creates := make(map[string]*mqswag.DAGNode)
+	isTagged := func(node *mqswag.DAGNode, class string) bool {
+		tag := mqswag.GetMeqaTag(node.Data.(*spec.Operation).Description)
+		return tag != nil && tag.Class == class
+	}
+	dag.IterateByWeight(func(previous *mqswag.DAGNode, current *mqswag.DAGNode) error {
+		if current.GetType() != mqswag.TypeOp || !OperationMatches(current, mqswag.MethodPost) {
+			return nil
+		}
+		for _, c := range current.Children {
+			if c.GetType() != mqswag.TypeDef {
+				continue
+			}
+			class := c.GetName()
+			if creates[class] == nil || (!isTagged(creates[class], class) && isTagged(current, class)) {
+				creates[class] = current
+			}
+		}
+		return nil
+	})
+	return creates
+}
+
+// GenerateNegativeTestPlan generates a test suite for every operation, with tests that break the
+// constraints of the parameters one at a time, and expect the server to reject them. When the path
+// parameters refer to an object, the suite creates one first, so the requests only fail because of
+// the bad parameter.
+func GenerateNegativeTestPlan(swagger *mqswag.Swagger, dag *mqswag.DAG) (*TestPlan, error) {
+	testPlan := &TestPlan{}
+	testPlan.Init(swagger, nil)
+	testPlan.comment = `
+In this test plan, each test suite sends requests to one operation with one parameter that
+breaks the constraints in the spec (a missing required parameter, a wrong type, a value out of
+range, too long or too short, not matching the pattern, the format or the enum). The server is
+expected to reject them with a 4xx status.
+`
+	addInitTestSuite(testPlan)
+	creates := createOperations(dag)
+
+	genFunc := func(previous *mqswag.DAGNode, current *mqswag.DAGNode) error {
+		if current.GetType() != mqswag.TypeOp {
+			return nil
+		}
+		pathItem := swagger.Paths.Paths[current.GetName()]
+		op := current.Data.(*spec.Operation)
+		params := ParamsAdd(append([]spec.Parameter{}, op.Parameters...), pathItem.Parameters)
+		violations := operationViolations(swagger, params)
+		if len(violations) == 0 {
+			return nil
+		}
+
+		testId := 0
+		testSuite := CreateTestSuite(fmt.Sprintf("%s -- %s -- negative", current.GetName(), current.GetMethod()), nil, testPlan)
+		created := make(map[string]bool)
+		for _, p := range params {
+			tag := mqswag.GetMeqaTag(p.Description)
+			if p.In != "path" || tag == nil || created[tag.Class] {
+				continue
+			}
+			if create := creates[tag.Class]; create != nil && create != current {
+				testId++
+				testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(create, testId))
+				created[tag.Class] = true
+			}
+		}
+		for _, v := range violations {
+			testId++
+			t := CreateTestFromOp(current, testId)
+			t.Name += "_" + v.name
+			v.apply(t)
+			t.Expect = map[string]interface{}{ExpectStatus: ExpectClientError}
+			testSuite.Tests = append(testSuite.Tests, t)
+		}
+		return testPlan.Add(testSuite)
+	}
+	err := dag.IterateByWeight(genFunc)
+	if err != nil {
+		return nil, err
+	}
+	return testPlan, nil
+}
@@ -0,0 +1,162 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+
+	"meqa/mqswag"
+	"meqa/mqutil"
+)
+
+func badValueMap(values []badValue) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, v := range values {
+		m[v.kind] = v.value
+	}
+	return m
+}
+
+func TestBadValues(t *testing.T) {
+	integer := spec.Int32Property().WithMinimum(1, false).WithMaximum(10, true)
+	expected := map[string]interface{}{
+		"wrong_type":     "not_an_integer",
+		"below_minimum":  int64(0),
+		"above_maximum":  int64(10),
+		"invalid_format": int64(math.MaxInt32) + 1,
+	}
+	if values := badValueMap(badValues(integer, false)); !reflect.DeepEqual(values, expected) {
+		t.Errorf("integer: expected %v, got %v", expected, values)
+	}
+
+	str := spec.StringProperty().WithMinLength(3).WithMaxLength(5).WithPattern("^[a-z]+$")
+	str.Format = "email"
+	str.Enum = []interface{}{"abc", "not_in_enum"}
+	expected = map[string]interface{}{
+		"wrong_type":       12345,
+		"too_short":        "aa",
+		"too_long":         "aaaaaa",
+		"pattern_mismatch": "!",
+		"invalid_format":   "not-an-email",
+		"invalid_enum":     "not_in_enum_",
+	}
+	if values := badValueMap(badValues(str, true)); !reflect.DeepEqual(values, expected) {
+		t.Errorf("string in the body: expected %v, got %v", expected, values)
+	}
+	// A string parameter can't have the wrong type.
+	if _, ok := badValueMap(badValues(str, false))["wrong_type"]; ok {
+		t.Error("string parameter: unexpected wrong_type")
+	}
+
+	array := spec.ArrayProperty(&spec.Schema{SchemaProps: spec.SchemaProps{Type: []string{"number"}, Enum: []interface{}{1.5, 3}}})
+	expected = map[string]interface{}{
+		"wrong_type":        "not_an_array",
+		"item_wrong_type":   []interface{}{"not_a_number"},
+		"item_invalid_enum": []interface{}{4.0},
+	}
+	if values := badValueMap(badValues(array, true)); !reflect.DeepEqual(values, expected) {
+		t.Errorf("array: expected %v, got %v", expected, values)
+	}
+}
+
+func TestGenerateNegativeTestPlan(t *testing.T) {
+	swagger := loadPetstore(t)
+	dag := mqswag.NewDAG()
+	if err := swagger.AddToDAG(dag); err != nil {
+		t.Fatal(err)
+	}
+	dag.Sort()
+	dag.CheckWeight()
+	generated, err := GenerateNegativeTestPlan(swagger, dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suite := generated.SuiteMap["/pet -- post -- negative"]
+	if suite == nil {
+		t.Fatalf("no negative suite for post /pet in %v", generated.SuiteMap)
+	}
+	var names []string
+	for _, test := range suite.Tests {
+		names = append(names, test.Name)
+		if test.Method != "post" || test.Path != "/pet" {
+			t.Errorf("unexpected test %s %s in the suite", test.Method, test.Path)
+		}
+		if test.Expect[ExpectStatus] != ExpectClientError {
+			t.Errorf("%s: expected status %s, got %v", test.Name, ExpectClientError, test.Expect[ExpectStatus])
+		}
+	}
+	for _, suffix := range []string{"_name_missing", "_photoUrls_missing", "_status_invalid_enum", "_id_wrong_type"} {
+		found := false
+		for _, name := range names {
+			found = found || strings.HasSuffix(name, suffix)
+		}
+		if !found {
+			t.Errorf("no test ends with %s: %v", suffix, names)
+		}
+	}
+
+	// Run the suite against a server that rejects everything, and one that takes everything.
+	var bodies []map[string]interface{}
+	status := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		requestBody, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(requestBody, &body)
+		bodies = append(bodies, body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	planPath := filepath.Join(dir, "negative.yml")
+	if err = generated.DumpToFile(planPath); err != nil {
+		t.Fatal(err)
+	}
+	loadPlan := func() *TestPlan {
+		db := &mqswag.DB{}
+		db.Init(swagger)
+		plan := &TestPlan{BaseURL: server.URL}
+		if err := plan.InitFromFile(planPath, db); err != nil {
+			t.Fatal(err)
+		}
+		return plan
+	}
+	suiteName := suite.Name
+	plan := loadPlan()
+	plan.SuiteMap[suiteName].OnFailure = OnFailureContinue
+	counts, _ := plan.Run(suiteName, nil)
+	if counts[mqutil.Passed] != len(suite.Tests) {
+		t.Errorf("expected all the tests to pass when the server rejects them, got %v", counts)
+	}
+	var missingName, badStatus bool
+	for _, body := range bodies {
+		if _, ok := body["name"]; !ok && len(body) > 0 {
+			missingName = true
+		}
+		if body["status"] == "not_in_enum" {
+			badStatus = true
+		}
+	}
+	if !missingName || !badStatus {
+		t.Errorf("expected a body without the name and one with a bad status, got %v", bodies)
+	}
+
+	status = http.StatusOK
+	plan = loadPlan()
+	plan.SuiteMap[suiteName].OnFailure = OnFailureContinue
+	if counts, _ = plan.Run(suiteName, nil); counts[mqutil.Failed] != len(suite.Tests) {
+		t.Errorf("expected all the tests to fail when the server takes them, got %v", counts)
+	}
+}
@@ -0,0 +1,145 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-openapi/spec"
+	"gopkg.in/resty.v0"
+
+	"meqa/mqutil"
+)
+
+// The OAuth2 flows in swagger 2.0 that we can get the tokens for without a user in the loop. OpenAPI 3.0
+// calls the application flow clientCredentials.
+const (
+	OAuth2Application       = "application"
+	OAuth2ClientCredentials = "clientCredentials"
+	OAuth2Password          = "password"
+)
+
+// A token is refreshed a bit before it expires, so it doesn't expire while the request is on the way.
+const oauth2ExpiryMargin = 10 * time.Second
+
+type oauth2Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+
+	expiry time.Time // zero if the token doesn't expire
+}
+
+func (token *oauth2Token) valid() bool {
+	return len(token.AccessToken) > 0 && (token.expiry.IsZero() || time.Now().Add(oauth2ExpiryMargin).Before(token.expiry))
+}
+
+// oauth2Tokens caches the tokens by the security scheme and the scopes requested.
+type oauth2Tokens struct {
+	tokens map[string]*oauth2Token
+	mutex  sync.Mutex
+}
+
+func oauth2TokenKey(name string, scopes []string) string {
+	sorted := append([]string{}, scopes...)
+	sort.Strings(sorted)
+	return name + " " + strings.Join(sorted, " ")
+}
+
+// get returns a valid access token for the scheme, requesting a new one from the token endpoint if the
+// cached one has expired.
+func (c *oauth2Tokens) get(name string, scheme *spec.SecurityScheme, cred *Credential, scopes []string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := oauth2TokenKey(name, scopes)
+	token := c.tokens[key]
+	if token != nil && token.valid() {
+		return token.AccessToken, nil
+	}
+	var err error
+	if token != nil && len(token.RefreshToken) > 0 {
+		refreshToken := token.RefreshToken
+		token, err = requestOAuth2Token(name, scheme, cred, map[string]string{
+			"grant_type":    "refresh_token",
+			"refresh_token": refreshToken,
+		})
+		if err == nil && len(token.RefreshToken) == 0 {
+			// The server may keep using the same refresh token.
+			token.RefreshToken = refreshToken
+		}
+		if err != nil {
+			mqutil.Logger.Printf("failed to refresh the token of %s, requesting a new one: %s", name, mqutil.ErrorMessage(err))
+		}
+	}
+	if token == nil || err != nil {
+		token, err = newOAuth2Token(name, scheme, cred, scopes)
+		if err != nil {
+			return "", err
+		}
+	}
+	if c.tokens == nil {
+		c.tokens = make(map[string]*oauth2Token)
+	}
+	c.tokens[key] = token
+	return token.AccessToken, nil
+}
+
+// invalidate drops the access token of the scheme, e.g. when the server rejects it. The refresh token
+// is kept, so the next get can use it.
+func (c *oauth2Tokens) invalidate(name string, scopes []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if token := c.tokens[oauth2TokenKey(name, scopes)]; token != nil {
+		token.AccessToken = ""
+	}
+}
+
+func newOAuth2Token(name string, scheme *spec.SecurityScheme, cred *Credential, scopes []string) (*oauth2Token, error) {
+	form := make(map[string]string)
+	switch scheme.Flow {
+	case OAuth2Application, OAuth2ClientCredentials:
+		form["grant_type"] = "client_credentials"
+	case OAuth2Password:
+		form["grant_type"] = "password"
+		form["username"] = cred.Username
+		form["password"] = cred.Password
+	default:
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"can't get a token for the %s flow of %s, put the access token in the credentials file instead", scheme.Flow, name))
+	}
+	if len(scopes) > 0 {
+		form["scope"] = strings.Join(scopes, " ")
+	}
+	return requestOAuth2Token(name, scheme, cred, form)
+}
+
+func requestOAuth2Token(name string, scheme *spec.SecurityScheme, cred *Credential, form map[string]string) (*oauth2Token, error) {
+	tokenURL := cred.TokenURL
+	if len(tokenURL) == 0 {
+		tokenURL = scheme.TokenURL
+	}
+	if len(tokenURL) == 0 {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("no tokenUrl for %s", name))
+	}
+	mqutil.Logger.Printf("requesting %s token of %s from %s", form["grant_type"], name, tokenURL)
+	resp, err := resty.R().SetBasicAuth(cred.ClientID, cred.ClientSecret).SetFormData(form).Post(tokenURL)
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrHttp, fmt.Sprintf("failed to get the token of %s: %s", name, err.Error()))
+	}
+	if resp.StatusCode() >= 300 {
+		return nil, mqutil.NewError(mqutil.ErrServerResp, fmt.Sprintf("failed to get the token of %s: %s\n%s", name, resp.Status(), string(resp.Body())))
+	}
+	token := &oauth2Token{}
+	err = json.Unmarshal(resp.Body(), token)
+	if err != nil || len(token.AccessToken) == 0 {
+		return nil, mqutil.NewError(mqutil.ErrServerResp, fmt.Sprintf("invalid token response for %s: %s", name, string(resp.Body())))
+	}
+	if token.ExpiresIn > 0 {
+		token.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
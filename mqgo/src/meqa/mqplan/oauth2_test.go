@@ -0,0 +1,191 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-openapi/spec"
+
+	"meqa/mqutil"
+)
+
+// newTokenServer returns a recordingServer that is an OAuth2 token endpoint. The access tokens it hands
+// out are token-1, token-2 and so on.
+func newTokenServer(expiresIn int64) *recordingServer {
+	return newRespondingServer(func(w http.ResponseWriter, r *http.Request, body []byte, n int) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "client-secret" {
+			http.Error(w, `{"error": "invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  fmt.Sprintf("token-%d", n),
+			"token_type":    "bearer",
+			"expires_in":    expiresIn,
+			"refresh_token": fmt.Sprintf("refresh-%d", n),
+		})
+	})
+}
+
+func oauth2Scheme(flow string, tokenURL string) *spec.SecurityScheme {
+	return &spec.SecurityScheme{SecuritySchemeProps: spec.SecuritySchemeProps{
+		Type:     SecurityOAuth2,
+		Flow:     flow,
+		TokenURL: tokenURL,
+	}}
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	mqutil.Logger = mqutil.NewStdLogger()
+	server := newTokenServer(3600)
+	defer server.Close()
+	scheme := oauth2Scheme(OAuth2Application, server.URL)
+	cred := &Credential{ClientID: "client", ClientSecret: "client-secret"}
+
+	var tokens oauth2Tokens
+	token, err := tokens.get("petstore_auth", scheme, cred, []string{"write:pets", "read:pets"})
+	if err != nil || token != "token-1" {
+		t.Fatalf("expected token-1, got %s %v", token, err)
+	}
+	forms := server.forms()
+	if forms[0].Get("grant_type") != "client_credentials" || forms[0].Get("scope") != "write:pets read:pets" {
+		t.Errorf("unexpected token request: %v", forms[0])
+	}
+
+	// The tokens are cached by the scopes, in any order.
+	token, err = tokens.get("petstore_auth", scheme, cred, []string{"read:pets", "write:pets"})
+	if err != nil || token != "token-1" {
+		t.Errorf("expected the cached token-1, got %s %v", token, err)
+	}
+	token, err = tokens.get("petstore_auth", scheme, cred, []string{"read:pets"})
+	if err != nil || token != "token-2" {
+		t.Errorf("expected a new token for the other scopes, got %s %v", token, err)
+	}
+	if n := len(server.forms()); n != 2 {
+		t.Errorf("expected 2 token requests, got %d", n)
+	}
+
+	// The OpenAPI 3 name of the flow.
+	var tokens3 oauth2Tokens
+	if _, err = tokens3.get("petstore_auth", oauth2Scheme(OAuth2ClientCredentials, server.URL), cred, nil); err != nil {
+		t.Error(err)
+	}
+	if form := server.forms()[2]; form.Get("grant_type") != "client_credentials" || len(form.Get("scope")) > 0 {
+		t.Errorf("unexpected token request: %v", form)
+	}
+}
+
+func TestOAuth2Password(t *testing.T) {
+	mqutil.Logger = mqutil.NewStdLogger()
+	server := newTokenServer(3600)
+	defer server.Close()
+	cred := &Credential{ClientID: "client", ClientSecret: "client-secret", Username: "alice", Password: "alice-password"}
+
+	var tokens oauth2Tokens
+	token, err := tokens.get("petstore_auth", oauth2Scheme(OAuth2Password, server.URL), cred, []string{"read:pets"})
+	if err != nil || token != "token-1" {
+		t.Fatalf("expected token-1, got %s %v", token, err)
+	}
+	form := server.forms()[0]
+	if form.Get("grant_type") != "password" || form.Get("username") != "alice" || form.Get("password") != "alice-password" {
+		t.Errorf("unexpected token request: %v", form)
+	}
+
+	// The token URL in the credentials overrides the one in the spec.
+	var other oauth2Tokens
+	cred.TokenURL = server.URL
+	if _, err = other.get("petstore_auth", oauth2Scheme(OAuth2Password, "http://127.0.0.1:1/token"), cred, nil); err != nil {
+		t.Error(err)
+	}
+
+	// The wrong client secret.
+	var rejected oauth2Tokens
+	cred.ClientSecret = "wrong"
+	if _, err = rejected.get("petstore_auth", oauth2Scheme(OAuth2Password, server.URL), cred, nil); err == nil {
+		t.Error("expected an error for the rejected client")
+	}
+
+	// The flows that need a user in the loop.
+	if _, err = rejected.get("petstore_auth", oauth2Scheme("implicit", server.URL), cred, nil); err == nil {
+		t.Error("expected an error for the implicit flow")
+	}
+}
+
+func TestOAuth2Refresh(t *testing.T) {
+	mqutil.Logger = mqutil.NewStdLogger()
+	// The tokens expire within the margin, so they are refreshed every time.
+	server := newTokenServer(1)
+	defer server.Close()
+	scheme := oauth2Scheme(OAuth2Application, server.URL)
+	cred := &Credential{ClientID: "client", ClientSecret: "client-secret"}
+
+	var tokens oauth2Tokens
+	if token, err := tokens.get("petstore_auth", scheme, cred, nil); err != nil || token != "token-1" {
+		t.Fatalf("expected token-1, got %s %v", token, err)
+	}
+	if token, err := tokens.get("petstore_auth", scheme, cred, nil); err != nil || token != "token-2" {
+		t.Fatalf("expected the refreshed token-2, got %s %v", token, err)
+	}
+	form := server.forms()[1]
+	if form.Get("grant_type") != "refresh_token" || form.Get("refresh_token") != "refresh-1" {
+		t.Errorf("unexpected refresh request: %v", form)
+	}
+
+	// The access token rejected by the server is dropped, and the refresh token is used for a new one.
+	tokens.invalidate("petstore_auth", nil)
+	if token, err := tokens.get("petstore_auth", scheme, cred, nil); err != nil || token != "token-3" {
+		t.Fatalf("expected token-3, got %s %v", token, err)
+	}
+	if form := server.forms()[2]; form.Get("refresh_token") != "refresh-2" {
+		t.Errorf("unexpected refresh request: %v", form)
+	}
+}
+
+func TestOAuth2RefetchAfterUnauthorized(t *testing.T) {
+	tokenServer := newTokenServer(3600)
+	defer tokenServer.Close()
+	// The API revokes token-1 as soon as it's handed out.
+	var authorizations []string
+	var mutex sync.Mutex
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		mutex.Unlock()
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	defer api.Close()
+
+	swagger := loadPetstore(t)
+	swagger.SecurityDefinitions["petstore_auth"] = oauth2Scheme(OAuth2Application, tokenServer.URL)
+	plan := newTestPlan(t, swagger, `
+pets:
+- name: find
+  method: get
+  path: /pet/findByStatus
+  queryParams:
+    status: available
+  expect:
+    status: 200
+`, api.URL)
+	plan.Credentials = map[string]*Credential{"petstore_auth": {ClientID: "client", ClientSecret: "client-secret"}}
+
+	counts, err := plan.Run("pets", nil)
+	if err != nil || counts[mqutil.Passed] != 1 {
+		t.Fatalf("expected the test to pass with the new token, got %v %v", counts, err)
+	}
+	if len(authorizations) != 2 || authorizations[0] != "Bearer token-1" || authorizations[1] != "Bearer token-2" {
+		t.Errorf("unexpected authorizations: %v", authorizations)
+	}
+	if forms := tokenServer.forms(); len(forms) != 2 || forms[1].Get("grant_type") != "refresh_token" {
+		t.Errorf("expected the token to be refreshed, got %v", forms)
+	}
+}
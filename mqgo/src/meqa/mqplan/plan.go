@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -18,15 +19,23 @@ import (
 )
 
 const (
-	MeqaInit = "meqa_init"
+	MeqaInit     = "meqa_init"
+	MeqaSetup    = "meqa_setup"    // the tests run before all the test suites
+	MeqaTeardown = "meqa_teardown" // the tests run after all the test suites, even if some fail
+)
+
+// The phases of a test suite the tests are run in.
+const (
+	PhaseSetup    = "setup"
+	PhaseTeardown = "teardown"
 )
 
 type TestParams struct {
-	QueryParams  map[string]interface{} `yaml:"queryParams,omitempty"`
-	FormParams   map[string]interface{} `yaml:"formParams,omitempty"`
-	PathParams   map[string]interface{} `yaml:"pathParams,omitempty"`
-	HeaderParams map[string]interface{} `yaml:"headerParams,omitempty"`
-	BodyParams   interface{}            `yaml:"bodyParams,omitempty"`
+	QueryParams  map[string]interface{} `yaml:"queryParams,omitempty" json:"queryParams,omitempty"`
+	FormParams   map[string]interface{} `yaml:"formParams,omitempty" json:"formParams,omitempty"`
+	PathParams   map[string]interface{} `yaml:"pathParams,omitempty" json:"pathParams,omitempty"`
+	HeaderParams map[string]interface{} `yaml:"headerParams,omitempty" json:"headerParams,omitempty"`
+	BodyParams   interface{}            `yaml:"bodyParams,omitempty" json:"bodyParams,omitempty"`
 }
 
 // Copy the parameters from src. If there is a conflict dst will be overwritten.
@@ -67,20 +76,25 @@ func (dst *TestParams) Add(src *TestParams) {
 }
 
 type TestSuite struct {
-	Tests []*Test
-	Name  string
+	Tests    []*Test
+	Name     string
+	Setup    []*Test // run before the tests, the tests are skipped if one fails
+	Teardown []*Test // run after the tests, even if some fail
 
 	// test suite parameters
 	TestParams `yaml:",inline,omitempty" json:",inline,omitempty"`
 	Strict     bool
+	Generator  string
+	OnFailure  string
 
 	// Authentication
 	Username string
 	Password string
 	ApiToken string
 
-	plan *TestPlan
-	db   *mqswag.DB // objects generated/obtained as part of this suite
+	plan  *TestPlan
+	db    *mqswag.DB // objects generated/obtained as part of this suite
+	mutex sync.Mutex // held while the suite runs
 
 	comment string
 }
@@ -91,6 +105,8 @@ func CreateTestSuite(name string, tests []*Test, plan *TestPlan) *TestSuite {
 	c.Tests = tests
 	(&c.TestParams).Copy(&plan.TestParams)
 	c.Strict = plan.Strict
+	c.Generator = plan.Generator
+	c.OnFailure = plan.OnFailure
 
 	c.Username = plan.Username
 	c.Password = plan.Password
@@ -110,17 +126,48 @@ type TestPlan struct {
 	// global parameters
 	TestParams `yaml:",inline,omitempty" json:",inline,omitempty"`
 	Strict     bool
+	Generator  string
+	OnFailure  string
+
+	// The URL the requests are sent to instead of the one in the spec, e.g. https://staging.example.com/v2
+	BaseURL string
+	// The headers sent with every request, unless the test sets them.
+	Headers map[string]string
 
 	// Authentication
-	Username string
-	Password string
-	ApiToken string
+	Username     string
+	Password     string
+	ApiToken     string
+	Credentials  map[string]*Credential // keyed by the security scheme name
+	Secrets      map[string]string      // the values of the ${secret:name} placeholders, by name
+	oauth2Tokens oauth2Tokens
+
+	// The seed of the random source the parameters are generated from.
+	Seed           int64
+	rand           *rand.Rand
+	boundaryCounts boundaryCounts
+
+	// The tests run before and after all the test suites.
+	setupSuite    *TestSuite
+	teardownSuite *TestSuite
+
+	// The tests to run, nil for all of them.
+	filter *Filter
+
+	// The objects created during the run, when they are deleted at the end.
+	cleanup *cleanupList
+
+	// Recording or replaying the HTTP traffic.
+	recording *Cassette
+	replaying *Cassette
 
 	// Run result.
 	resultList   []*Test
+	resultMutex  sync.Mutex
 	ResultCounts map[string]int
 
 	comment string
+	dir     string // the directory of the test plan file, where the dataset files are looked up
 }
 
 // Add a new TestSuite, returns whether the Case is successfully added.
@@ -135,28 +182,87 @@ func (plan *TestPlan) Add(testSuite *TestSuite) error {
 	return nil
 }
 
+// allSuites returns the test suites, with the ones run before and after all of them.
+func (plan *TestPlan) allSuites() []*TestSuite {
+	suites := append([]*TestSuite{}, plan.SuiteList...)
+	if plan.setupSuite != nil {
+		suites = append([]*TestSuite{plan.setupSuite}, suites...)
+	}
+	if plan.teardownSuite != nil {
+		suites = append(suites, plan.teardownSuite)
+	}
+	return suites
+}
+
+// allTests returns the setup tests, the tests and the teardown tests of the suite.
+func (tc *TestSuite) allTests() []*Test {
+	var tests []*Test
+	tests = append(tests, tc.Setup...)
+	tests = append(tests, tc.Tests...)
+	return append(tests, tc.Teardown...)
+}
+
+// suiteDef is a test suite in the test plan file. It's either the list of the tests, or a map with the
+// setup, tests and teardown lists.
+type suiteDef struct {
+	Setup    []*Test `yaml:"setup,omitempty"`
+	Tests    []*Test `yaml:"tests,omitempty"`
+	Teardown []*Test `yaml:"teardown,omitempty"`
+}
+
+func (def *suiteDef) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&def.Tests); err == nil {
+		return nil
+	}
+	type plain suiteDef
+	return unmarshal((*plain)(def))
+}
+
+// initTests initializes the tests of the suite, and expands the ones with a dataset.
+func (plan *TestPlan) initTests(testSuite *TestSuite, testList []*Test) []*Test {
+	var tests []*Test
+	for _, t := range testList {
+		t.Init(testSuite)
+		tests = append(tests, t.expandDataset(plan)...)
+	}
+	return tests
+}
+
 func (plan *TestPlan) AddFromString(data string) error {
-	var suiteMap map[string]([]*Test)
+	var suiteMap map[string]*suiteDef
 	err := yaml.Unmarshal([]byte(data), &suiteMap)
 	if err != nil {
 		mqutil.Logger.Printf("The following is not a valud TestSuite:\n%s", data)
 		return err
 	}
 
-	for suiteName, testList := range suiteMap {
+	for suiteName, def := range suiteMap {
+		if def == nil {
+			continue
+		}
+		testList := def.Tests
 		if suiteName == MeqaInit {
 			// global parameters
 			for _, t := range testList {
 				t.Init(nil)
 				(&plan.TestParams).Copy(&t.TestParams)
 				plan.Strict = t.Strict
+				plan.Generator = t.Generator
+				plan.OnFailure = t.OnFailure
 			}
 
 			continue
 		}
 		testSuite := CreateTestSuite(suiteName, testList, plan)
-		for _, t := range testList {
-			t.Init(testSuite)
+		testSuite.Tests = plan.initTests(testSuite, testList)
+		testSuite.Setup = plan.initTests(testSuite, def.Setup)
+		testSuite.Teardown = plan.initTests(testSuite, def.Teardown)
+		if suiteName == MeqaSetup {
+			plan.setupSuite = testSuite
+			continue
+		} else if suiteName == MeqaTeardown {
+			plan.teardownSuite = testSuite
+			continue
 		}
 		err = plan.Add(testSuite)
 		if err != nil {
@@ -168,6 +274,7 @@ func (plan *TestPlan) AddFromString(data string) error {
 
 func (plan *TestPlan) InitFromFile(path string, db *mqswag.DB) error {
 	plan.Init(db.Swagger, db)
+	plan.dir = filepath.Dir(path)
 
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -179,7 +286,7 @@ func (plan *TestPlan) InitFromFile(path string, db *mqswag.DB) error {
 	for _, chunk := range chunks {
 		plan.AddFromString(chunk)
 	}
-	return nil
+	return plan.ResolvePlaceholders()
 }
 
 func WriteComment(comment string, f *os.File) {
@@ -199,7 +306,7 @@ func (plan *TestPlan) DumpToFile(path string) error {
 	if len(plan.comment) > 0 {
 		WriteComment(plan.comment, f)
 	}
-	for _, testSuite := range plan.SuiteList {
+	for _, testSuite := range plan.allSuites() {
 		f.WriteString("\n\n")
 		if len(testSuite.comment) > 0 {
 			WriteComment(testSuite.comment, f)
@@ -209,10 +316,14 @@ func (plan *TestPlan) DumpToFile(path string) error {
 			return err
 		}
 		testMap := map[string]interface{}{testSuite.Name: testSuite.Tests}
+		if len(testSuite.Setup) > 0 || len(testSuite.Teardown) > 0 {
+			testMap[testSuite.Name] = &suiteDef{testSuite.Setup, testSuite.Tests, testSuite.Teardown}
+		}
 		caseBytes, err := yaml.Marshal(testMap)
 		if err != nil {
 			return err
 		}
+		caseBytes = []byte(mqutil.MaskSecrets(string(caseBytes)))
 		count, err = f.Write(caseBytes)
 		if count != len(caseBytes) || err != nil {
 			panic("writing test suite failed")
@@ -225,13 +336,18 @@ func (plan *TestPlan) WriteResultToFile(path string) error {
 	// We create a new test plan that just contain all the tests in one test suite.
 	p := &TestPlan{}
 	tc := &TestSuite{}
+	if plan.rand != nil {
+		p.comment = fmt.Sprintf("seed: %d", plan.Seed)
+	}
 	// Test case name is the current time.
 	tc.Name = time.Now().Format(time.RFC3339)
 	p.SuiteMap = map[string]*TestSuite{tc.Name: tc}
 	p.SuiteList = append(p.SuiteList, tc)
 
 	for _, test := range plan.resultList {
-		tc.Tests = append(tc.Tests, test)
+		if len(test.skipReason) == 0 {
+			tc.Tests = append(tc.Tests, test)
+		}
 	}
 	return p.DumpToFile(path)
 }
@@ -250,7 +366,7 @@ func (plan *TestPlan) LogErrors() {
 		if t.responseError != nil {
 			fmt.Print(mqutil.RED)
 			fmt.Println("Response Status Code:", t.resp.StatusCode())
-			fmt.Println(t.responseError)
+			fmt.Println(mqutil.MaskSecrets(fmt.Sprint(t.responseError)))
 			fmt.Print(mqutil.END)
 		}
 		if t.schemaError != nil {
@@ -271,10 +387,17 @@ func (plan *TestPlan) PrintSummary() {
 	fmt.Printf("%v: %v\n", mqutil.Failed, plan.ResultCounts[mqutil.Failed])
 	fmt.Print(mqutil.BLUE)
 	fmt.Printf("%v: %v\n", mqutil.Skipped, plan.ResultCounts[mqutil.Skipped])
+	if plan.ResultCounts[mqutil.SkippedDependent] > 0 {
+		fmt.Printf("%v: %v\n", mqutil.SkippedDependent, plan.ResultCounts[mqutil.SkippedDependent])
+	}
 	fmt.Print(mqutil.YELLOW)
 	fmt.Printf("%v: %v\n", mqutil.SchemaMismatch, plan.ResultCounts[mqutil.SchemaMismatch])
 	fmt.Print(mqutil.AQUA)
 	fmt.Printf("%v: %v\n", mqutil.Total, plan.ResultCounts[mqutil.Total])
+	if plan.ResultCounts[mqutil.TeardownFailed] > 0 {
+		fmt.Print(mqutil.RED)
+		fmt.Printf("%v: %v\n", mqutil.TeardownFailed, plan.ResultCounts[mqutil.TeardownFailed])
+	}
 	fmt.Print(mqutil.END)
 }
 
@@ -283,65 +406,374 @@ func (plan *TestPlan) Init(swagger *mqswag.Swagger, db *mqswag.DB) {
 	plan.swagger = swagger
 	plan.SuiteMap = make(map[string]*TestSuite)
 	plan.SuiteList = nil
+	plan.setupSuite = nil
+	plan.teardownSuite = nil
 	plan.resultList = nil
 }
 
+// SetSeed makes the tests generate their parameters and pick the objects from the DB using a random
+// source with the seed, so that running the same test plan with the same seed sends the same requests.
+func (plan *TestPlan) SetSeed(seed int64) {
+	plan.Seed = seed
+	plan.rand = rand.New(&lockedSource{src: rand.NewSource(seed)})
+}
+
+// suiteRand returns the random source of the i-th suite run in parallel. It's derived from the seed
+// and the index, so that the values a suite generates don't depend on the order the suites draw them.
+func (plan *TestPlan) suiteRand(i int) *rand.Rand {
+	if plan.rand == nil {
+		return nil
+	}
+	return rand.New(rand.NewSource(plan.Seed ^ (int64(i+1) * 0x5DEECE66D)))
+}
+
+// lockedSource is a rand.Source that can be shared by the suites running in parallel.
+type lockedSource struct {
+	src   rand.Source
+	mutex sync.Mutex
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.src.Seed(seed)
+}
+
+// The random source used when there is no test plan, e.g. to generate the mock responses.
+var globalRand = rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano())})
+
+// suiteRun holds the state of running a test suite, together with the suites it refers to.
+type suiteRun struct {
+	history *TestHistory // where the tests look up the parameters of the tests run before them
+	results []*Test
+	failed  map[string]bool // the tests that failed or were skipped, when the suite skips their dependents
+	rand    *rand.Rand      // the random source of the suite when it runs in parallel, nil for the plan's
+}
+
 // Run a named TestSuite in the test plan.
 func (plan *TestPlan) Run(name string, parentTest *Test) (map[string]int, error) {
+	r := &suiteRun{history: &History}
+	counts, err := plan.run(name, parentTest, r)
+	plan.addResults(r.results)
+	return counts, err
+}
+
+func (plan *TestPlan) addResults(results []*Test) {
+	plan.resultMutex.Lock()
+	defer plan.resultMutex.Unlock()
+	plan.resultList = append(plan.resultList, results...)
+}
+
+// RunSuites runs the named test suites, at most parallel of them at the same time. The counts and
+// errors returned are in the same order as the names, and so are the results recorded, no matter
+// which suite finishes first. Suites that run in parallel have their own history, so a test can only
+// refer to the tests of its own suite.
+func (plan *TestPlan) RunSuites(names []string, parallel int) ([]map[string]int, []error) {
+	counts := make([]map[string]int, len(names))
+	errs := make([]error, len(names))
+
+	// The tests before and after the suites can refer to each other, and the suites can refer to the
+	// tests before them.
+	h := &History
+	if parallel > 1 {
+		h = &TestHistory{}
+	}
+	defer plan.runPlanTeardown(h)
+	if err := plan.runPlanSetup(h); err != nil {
+		for i, name := range names {
+			counts[i] = make(map[string]int)
+			if tc, ok := plan.SuiteMap[name]; ok {
+				counts[i][mqutil.Total] = len(tc.Setup) + len(tc.Tests)
+				counts[i][mqutil.Skipped] = counts[i][mqutil.Total]
+			}
+			errs[i] = err
+		}
+		return counts, errs
+	}
+
+	if parallel <= 1 {
+		for i, name := range names {
+			mqutil.Logger.Printf("\n---\nTest suite: %s\n", name)
+			fmt.Printf("\n---\nTest suite: %s\n", name)
+			counts[i], errs[i] = plan.Run(name, nil)
+		}
+		return counts, errs
+	}
+
+	runs := make([]*suiteRun, len(names))
+	sem := make(chan bool, parallel)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- true
+			defer func() { <-sem }()
+			mqutil.Logger.Printf("\n---\nTest suite: %s\n", name)
+			fmt.Printf("\n---\nTest suite: %s\n", name)
+			runs[i] = &suiteRun{history: h.copy(), rand: plan.suiteRand(i)}
+			counts[i], errs[i] = plan.run(name, nil, runs[i])
+		}(i, name)
+	}
+	wg.Wait()
+	for _, r := range runs {
+		plan.addResults(r.results)
+	}
+	return counts, errs
+}
+
+func (plan *TestPlan) run(name string, parentTest *Test, r *suiteRun) (map[string]int, error) {
 	tc, ok := plan.SuiteMap[name]
 	resultCounts := make(map[string]int)
-	if !ok || len(tc.Tests) == 0 {
+	if !ok || len(tc.Setup)+len(tc.Tests) == 0 {
 		str := fmt.Sprintf("The following test suite is not found: %s", name)
 		mqutil.Logger.Println(str)
 		return resultCounts, errors.New(str)
 	}
+	// The same suite can be referred to by suites running in parallel.
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
 	tc.db = plan.db.CloneSchema()
 	defer func() {
 		tc.db = nil
 	}()
-	resultCounts[mqutil.Total] = len(tc.Tests)
+	resultCounts[mqutil.Total] = len(tc.Setup) + len(tc.Tests)
 	resultCounts[mqutil.Failed] = 0
+	if parentTest == nil && !plan.filter.selectsAnyTest(plan, tc) {
+		// Don't run the setup and the teardown either.
+		mqutil.Logger.Printf("\n--- %s skipped by the filters\n", tc.Name)
+		fmt.Printf("\n--- %s skipped by the filters\n", tc.Name)
+		for _, test := range tc.Setup {
+			dup := test.Duplicate()
+			dup.phase = PhaseSetup
+			r.skip(dup, skippedByFilters)
+		}
+		for _, test := range tc.Tests {
+			if test.Name != MeqaInit {
+				r.skip(test.Duplicate(), skippedByFilters)
+			}
+		}
+		resultCounts[mqutil.Skipped] = resultCounts[mqutil.Total]
+		return resultCounts, nil
+	}
+	var firstErr error // the first failure, when the suite goes on after it
+	// The teardown runs however the suite ends.
+	defer plan.runTeardown(tc, tc.Teardown, r, resultCounts)
+	if len(tc.Setup) > 0 {
+		// The meqa_init parameters apply to the setup tests too.
+		for _, test := range tc.Tests {
+			if test.Name == MeqaInit {
+				tc.applyInit(test)
+			}
+		}
+	}
+	for _, test := range tc.Setup {
+		dup, err := plan.runTest(tc, test, nil, PhaseSetup, r)
+		if dup.schemaError != nil {
+			resultCounts[mqutil.SchemaMismatch]++
+		}
+		if err != nil {
+			resultCounts[mqutil.Failed]++
+			resultCounts[mqutil.Skipped] = resultCounts[mqutil.Total] - resultCounts[mqutil.Passed] - 1
+			return resultCounts, err
+		}
+		resultCounts[mqutil.Passed]++
+	}
 	for _, test := range tc.Tests {
 		if len(test.Ref) != 0 {
 			test.Strict = tc.Strict
-			resultCounts, err := plan.Run(test.Ref, test)
+			refCounts, err := plan.run(test.Ref, test, r)
+			if refCounts[mqutil.Total] > 0 {
+				// The tests of the suite referred to are counted in place of this test.
+				for k, v := range refCounts {
+					resultCounts[k] += v
+				}
+				resultCounts[mqutil.Total]--
+			} else if err != nil {
+				resultCounts[mqutil.Failed]++
+			}
 			if err != nil {
+				if tc.continuesAfterFailure() {
+					if firstErr == nil {
+						firstErr = err
+					}
+					r.fail(test.Name)
+					continue
+				}
+				resultCounts[mqutil.Skipped] = resultCounts[mqutil.Total] - resultCounts[mqutil.Passed] -
+					resultCounts[mqutil.Failed] - resultCounts[mqutil.SkippedDependent]
 				return resultCounts, err
 			}
 			continue
 		}
 
 		if test.Name == MeqaInit {
-			// Apply the parameters to the test suite.
-			(&tc.TestParams).Copy(&test.TestParams)
-			tc.Strict = test.Strict
+			tc.applyInit(test)
 			continue
 		}
 
-		dup := test.Duplicate()
-		dup.Strict = tc.Strict
-		if parentTest != nil {
-			dup.CopyParent(parentTest)
+		if !plan.filter.selects(plan, test) {
+			r.skip(test.Duplicate(), skippedByFilters)
+			resultCounts[mqutil.Skipped]++
+			continue
 		}
-		dup.ResolveHistoryParameters(&History)
-		History.Append(dup)
-		if parentTest != nil {
-			dup.Name = parentTest.Name // always inherit the name
+		dup := plan.prepareTest(tc, test, parentTest, "", r)
+		if tc.OnFailure == OnFailureSkipDependents {
+			if failed := r.failedReference(dup); len(failed) > 0 {
+				r.skip(dup, fmt.Sprintf("it refers to %s that didn't pass", failed))
+				resultCounts[mqutil.SkippedDependent]++
+				r.fail(dup.Name)
+				continue
+			}
 		}
-		err := dup.Run(tc)
-		dup.err = err
-		plan.resultList = append(plan.resultList, dup)
+		err := plan.runPrepared(tc, dup, r)
 		if dup.schemaError != nil {
 			resultCounts[mqutil.SchemaMismatch]++
 		}
 		if err != nil {
 			resultCounts[mqutil.Failed]++
-			resultCounts[mqutil.Skipped] = len(tc.Tests) - resultCounts[mqutil.Passed] - 1
+			if tc.continuesAfterFailure() {
+				if firstErr == nil {
+					firstErr = err
+				}
+				r.fail(dup.Name)
+				continue
+			}
+			resultCounts[mqutil.Skipped] = resultCounts[mqutil.Total] - resultCounts[mqutil.Passed] -
+				resultCounts[mqutil.Failed] - resultCounts[mqutil.SkippedDependent]
 			return resultCounts, err
 		}
 		resultCounts[mqutil.Passed]++
 	}
-	return resultCounts, nil
+	return resultCounts, firstErr
+}
+
+// applyInit applies the parameters of the meqa_init test to the test suite.
+func (tc *TestSuite) applyInit(test *Test) {
+	(&tc.TestParams).Copy(&test.TestParams)
+	tc.Strict = test.Strict
+	if len(test.Generator) > 0 {
+		tc.Generator = test.Generator
+	}
+	if len(test.OnFailure) > 0 {
+		tc.OnFailure = test.OnFailure
+	}
+}
+
+// runTest runs a copy of the test in the suite and records the result.
+func (plan *TestPlan) runTest(tc *TestSuite, test *Test, parentTest *Test, phase string, r *suiteRun) (*Test, error) {
+	dup := plan.prepareTest(tc, test, parentTest, phase, r)
+	return dup, plan.runPrepared(tc, dup, r)
+}
+
+// prepareTest returns the copy of the test to run, with the templates resolved.
+func (plan *TestPlan) prepareTest(tc *TestSuite, test *Test, parentTest *Test, phase string, r *suiteRun) *Test {
+	dup := test.Duplicate()
+	dup.phase = phase
+	dup.rand = r.rand
+	dup.Strict = tc.Strict
+	if len(dup.Generator) == 0 {
+		dup.Generator = tc.Generator
+	}
+	if parentTest != nil {
+		dup.CopyParent(parentTest)
+	}
+	dup.ResolveHistoryParameters(r.history)
+	if parentTest != nil {
+		dup.Name = parentTest.Name // always inherit the name
+	}
+	return dup
+}
+
+// runPrepared runs the copy of the test and records the result.
+func (plan *TestPlan) runPrepared(tc *TestSuite, dup *Test, r *suiteRun) error {
+	r.history.Append(dup)
+	err := dup.Run(tc)
+	dup.err = err
+	r.results = append(r.results, dup)
+	return err
+}
+
+// runTeardown runs all the teardown tests, even if some of them fail. The failures are counted as
+// TeardownFailed, apart from the failures of the tests.
+func (plan *TestPlan) runTeardown(tc *TestSuite, tests []*Test, r *suiteRun, counts map[string]int) {
+	if len(tests) == 0 {
+		return
+	}
+	mqutil.Logger.Printf("\n--- Teardown: %s\n", tc.Name)
+	fmt.Printf("\n--- Teardown: %s\n", tc.Name)
+	for _, test := range tests {
+		if _, err := plan.runTest(tc, test, nil, PhaseTeardown, r); err != nil {
+			counts[mqutil.TeardownFailed]++
+		}
+	}
+}
+
+// runPlanSetup runs the tests before all the test suites. It stops at the first failure.
+func (plan *TestPlan) runPlanSetup(h *TestHistory) error {
+	tc := plan.setupSuite
+	if tc == nil || len(tc.Tests) == 0 {
+		return nil
+	}
+	mqutil.Logger.Printf("\n---\nTest suite: %s\n", tc.Name)
+	fmt.Printf("\n---\nTest suite: %s\n", tc.Name)
+	tc.db = plan.db.CloneSchema()
+	defer func() {
+		tc.db = nil
+	}()
+	r := &suiteRun{history: h}
+	counts := map[string]int{mqutil.Total: len(tc.Tests)}
+	var err error
+	for _, test := range tc.Tests {
+		var dup *Test
+		dup, err = plan.runTest(tc, test, nil, PhaseSetup, r)
+		if dup.schemaError != nil {
+			counts[mqutil.SchemaMismatch]++
+		}
+		if err != nil {
+			counts[mqutil.Failed]++
+			counts[mqutil.Skipped] = counts[mqutil.Total] - counts[mqutil.Passed] - 1
+			break
+		}
+		counts[mqutil.Passed]++
+	}
+	plan.addResults(r.results)
+	plan.addCounts(counts)
+	return err
+}
+
+// runPlanTeardown runs the tests after all the test suites, even if some of them fail.
+func (plan *TestPlan) runPlanTeardown(h *TestHistory) {
+	tc := plan.teardownSuite
+	if tc == nil || len(tc.Tests) == 0 {
+		return
+	}
+	tc.db = plan.db.CloneSchema()
+	defer func() {
+		tc.db = nil
+	}()
+	r := &suiteRun{history: h}
+	counts := make(map[string]int)
+	plan.runTeardown(tc, tc.Tests, r, counts)
+	plan.addResults(r.results)
+	plan.addCounts(counts)
+}
+
+func (plan *TestPlan) addCounts(counts map[string]int) {
+	plan.resultMutex.Lock()
+	defer plan.resultMutex.Unlock()
+	if plan.ResultCounts == nil {
+		plan.ResultCounts = make(map[string]int)
+	}
+	for k, v := range counts {
+		plan.ResultCounts[k] += v
+	}
 }
 
 // The current global TestPlan
@@ -364,6 +796,14 @@ func (h *TestHistory) GetTest(name string) *Test {
 	}
 	return nil
 }
+
+// copy returns a new history with the tests in this one.
+func (h *TestHistory) copy() *TestHistory {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return &TestHistory{tests: append([]*Test{}, h.tests...)}
+}
+
 func (h *TestHistory) Append(t *Test) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
@@ -373,6 +813,5 @@ func (h *TestHistory) Append(t *Test) {
 var History TestHistory
 
 func init() {
-	rand.Seed(int64(time.Now().Second()))
 	resty.SetRedirectPolicy(resty.FlexibleRedirectPolicy(15))
 }
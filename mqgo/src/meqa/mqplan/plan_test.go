@@ -0,0 +1,356 @@
+package mqplan
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"meqa/mqswag"
+	"meqa/mqutil"
+
+	"github.com/go-openapi/spec"
+)
+
+// loadPetstore loads the tagged petstore spec in testdata.
+func loadPetstore(t *testing.T) *mqswag.Swagger {
+	mqutil.Logger = mqutil.NewStdLogger()
+	dir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	swagger, err := mqswag.CreateSwaggerFromURL(filepath.Join(wd, "../../../testdata/petstore_meqa.yml"), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return swagger
+}
+
+// newTestPlan returns a test plan of the spec with the test suites in the yaml, which sends the requests
+// to the base URL. The suites can be in several yaml documents, separated by "---".
+func newTestPlan(t *testing.T, swagger *mqswag.Swagger, suites string, baseURL string) *TestPlan {
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	plan := &TestPlan{}
+	plan.Init(swagger, db)
+	plan.BaseURL = baseURL
+	for _, doc := range strings.Split(suites, "\n---\n") {
+		if err := plan.AddFromString(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := plan.ResolvePlaceholders(); err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+// respondFunc answers the n-th request a recordingServer got, counting from 1. The body is already read.
+type respondFunc func(w http.ResponseWriter, r *http.Request, body []byte, n int)
+
+// recordingServer records the requests it gets. It answers them with the status set for their method, or
+// with its respond func.
+type recordingServer struct {
+	*httptest.Server
+	respond  respondFunc
+	statuses map[string]int
+	received []receivedRequest
+	mutex    sync.Mutex
+}
+
+type receivedRequest struct {
+	method string
+	url    *url.URL
+	body   string
+}
+
+// newRecordingServer returns a recordingServer that answers the gets with an empty list and the posts
+// with their body.
+func newRecordingServer() *recordingServer {
+	return newRespondingServer(func(w http.ResponseWriter, r *http.Request, body []byte, n int) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			w.Write([]byte("[]"))
+		} else {
+			w.Write(body)
+		}
+	})
+}
+
+func newRespondingServer(respond respondFunc) *recordingServer {
+	s := &recordingServer{respond: respond}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.mutex.Lock()
+		s.received = append(s.received, receivedRequest{r.Method, r.URL, string(body)})
+		n := len(s.received)
+		status := s.statuses[r.Method]
+		s.mutex.Unlock()
+		if status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		s.respond(w, r, body, n)
+	}))
+	return s
+}
+
+// setStatuses makes the server answer the requests with the status set for their method instead.
+func (s *recordingServer) setStatuses(statuses map[string]int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.statuses = statuses
+}
+
+// requests returns the method, the URL and the body of the requests received, sorted if the order
+// doesn't matter.
+func (s *recordingServer) requests(sorted bool) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var requests []string
+	for _, r := range s.received {
+		requests = append(requests, r.method+" "+r.url.String()+" "+r.body)
+	}
+	if sorted {
+		sort.Strings(requests)
+	}
+	return requests
+}
+
+// paths returns the method and the path of the requests received.
+func (s *recordingServer) paths() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var paths []string
+	for _, r := range s.received {
+		paths = append(paths, r.method+" "+r.url.Path)
+	}
+	return paths
+}
+
+// forms returns the forms posted to the server.
+func (s *recordingServer) forms() []url.Values {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var forms []url.Values
+	for _, r := range s.received {
+		form, _ := url.ParseQuery(r.body)
+		forms = append(forms, form)
+	}
+	return forms
+}
+
+// calls returns the number of requests received.
+func (s *recordingServer) calls() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.received)
+}
+
+// The tests generate all their parameters, and don't send any date.
+const generatedSuites = `
+pets:
+- name: create
+  method: post
+  path: /pet
+- name: find
+  method: get
+  path: /pet/findByStatus
+users:
+- name: create
+  method: post
+  path: /user
+- name: createList
+  method: post
+  path: /user/createWithArray
+`
+
+// runWithSeed runs the suites with the seed, and returns the requests sent.
+func runWithSeed(t *testing.T, swagger *mqswag.Swagger, seed int64, parallel int) []string {
+	server := newRecordingServer()
+	defer server.Close()
+	plan := newTestPlan(t, swagger, generatedSuites, server.URL)
+	plan.SetSeed(seed)
+	plan.RunSuites([]string{"pets", "users"}, parallel)
+	requests := server.requests(parallel > 1)
+	if len(requests) != 4 {
+		t.Fatalf("expected 4 requests, got %v", requests)
+	}
+	return requests
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSeed(t *testing.T) {
+	swagger := loadPetstore(t)
+	first := runWithSeed(t, swagger, 42, 1)
+	if second := runWithSeed(t, swagger, 42, 1); !equalStrings(first, second) {
+		t.Errorf("the same seed sent different requests:\n%v\n%v", first, second)
+	}
+	if other := runWithSeed(t, swagger, 43, 1); equalStrings(first, other) {
+		t.Errorf("another seed sent the same requests: %v", other)
+	}
+}
+
+func TestSeedStrings(t *testing.T) {
+	// The dates and the patterns are drawn from the plan's source too, and don't depend on when the
+	// test runs.
+	generate := func(seed int64) []string {
+		plan := &TestPlan{}
+		plan.SetSeed(seed)
+		test := &Test{suite: &TestSuite{plan: plan}}
+		var values []string
+		for _, s := range []*spec.Schema{
+			{SchemaProps: spec.SchemaProps{Format: "date-time"}},
+			{SchemaProps: spec.SchemaProps{Format: "date"}},
+			{SchemaProps: spec.SchemaProps{Pattern: "^[a-z]{4}-[0-9]+$"}},
+		} {
+			str, err := generateString(s, "", test.baseTime(), test.random())
+			if err != nil {
+				t.Fatal(err)
+			}
+			values = append(values, str)
+		}
+		return values
+	}
+	first := generate(42)
+	if second := generate(42); !equalStrings(first, second) {
+		t.Errorf("the same seed generated different strings:\n%v\n%v", first, second)
+	}
+	if other := generate(43); equalStrings(first, other) {
+		t.Errorf("another seed generated the same strings: %v", other)
+	}
+	if date, err := time.Parse(time.RFC3339, first[0]); err != nil || !date.Before(seedTime) {
+		t.Errorf("expected a date before %v, got %s", seedTime, first[0])
+	}
+}
+
+func TestRunSuitesParallel(t *testing.T) {
+	swagger := loadPetstore(t)
+	// Each suite draws from its own source, so the requests don't depend on which suite runs first.
+	first := runWithSeed(t, swagger, 42, 2)
+	for i := 0; i < 3; i++ {
+		if again := runWithSeed(t, swagger, 42, 2); !equalStrings(first, again) {
+			t.Fatalf("the same seed sent different requests in parallel:\n%v\n%v", first, again)
+		}
+	}
+
+	// The pets suite finishes last, but its results come first.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/pet") {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	plan := newTestPlan(t, swagger, generatedSuites, server.URL)
+	start := time.Now()
+	counts, errs := plan.RunSuites([]string{"pets", "users"}, 2)
+	if elapsed := time.Since(start); elapsed > 350*time.Millisecond {
+		t.Errorf("the suites didn't run at the same time, it took %v", elapsed)
+	}
+	for i, name := range []string{"pets", "users"} {
+		if errs[i] != nil || counts[i][mqutil.Total] != 2 || counts[i][mqutil.Passed] != 2 {
+			t.Errorf("%s: unexpected result %v %v", name, counts[i], errs[i])
+		}
+	}
+	var suites []string
+	for _, test := range plan.resultList {
+		suites = append(suites, test.suiteName())
+	}
+	if !equalStrings(suites, []string{"pets", "pets", "users", "users"}) {
+		t.Errorf("the results aren't in the order of the suites: %v", suites)
+	}
+}
+
+func TestSeedGenerate(t *testing.T) {
+	swagger := loadPetstore(t)
+	dag := mqswag.NewDAG()
+	if err := swagger.AddToDAG(dag); err != nil {
+		t.Fatal(err)
+	}
+	dag.Sort()
+	dag.CheckWeight()
+	dir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	generate := func(name string, seed int64) []byte {
+		plan, err := GenerateTestPlanByAlgorithm(AlgoRandom, swagger, dag, &GenerateOptions{Walks: 3, WalkSteps: 10, Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err = plan.DumpToFile(path); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	first := generate("first.yml", 42)
+	if second := generate("second.yml", 42); !bytes.Equal(first, second) {
+		t.Errorf("the same seed generated different test plans:\n%s\n%s", first, second)
+	}
+	if other := generate("other.yml", 43); bytes.Equal(first, other) {
+		t.Error("another seed generated the same test plan")
+	}
+}
+
+// runReportPlan runs a suite with a test that passes, one left out by the filters and one that fails,
+// for the reports.
+func runReportPlan(t *testing.T) *TestPlan {
+	server := newRecordingServer()
+	defer server.Close()
+	plan := newTestPlan(t, loadPetstore(t), `
+pets:
+- name: find
+  method: get
+  path: /pet/findByStatus
+  queryParams:
+    status: available
+- name: leftOut
+  method: get
+  path: /pet/findByStatus
+  queryParams:
+    status: pending
+- name: wrongStatus
+  method: get
+  path: /pet/findByStatus
+  queryParams:
+    status: sold
+  expect:
+    status: 201
+`, server.URL)
+	if err := plan.SetFilter(&Filter{ExcludeTest: "^leftOut$"}); err != nil {
+		t.Fatal(err)
+	}
+	counts, _ := plan.Run("pets", nil)
+	plan.ResultCounts = counts
+	return plan
+}
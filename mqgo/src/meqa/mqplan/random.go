@@ -0,0 +1,220 @@
+package mqplan
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/go-openapi/spec"
+
+	"meqa/mqswag"
+)
+
+// The random walks the random algorithm generates by default.
+const (
+	DefaultRandomWalks     = 5  // the number of test suites
+	DefaultRandomWalkSteps = 30 // the number of operations picked in each suite, before the objects left are deleted
+)
+
+// The chance of picking an operation, by method.
+var walkWeights = map[string]int{
+	mqswag.MethodPost:    2,
+	mqswag.MethodGet:     3,
+	mqswag.MethodHead:    1,
+	mqswag.MethodOptions: 1,
+	mqswag.MethodPut:     2,
+	mqswag.MethodPatch:   2,
+	mqswag.MethodDelete:  1,
+}
+
+// walkOp is an operation with the classes it creates, uses and deletes.
+type walkOp struct {
+	node     *mqswag.DAGNode
+	method   string // the method in the meqa tag, or the http method
+	produces []string
+	consumes []string
+	deletes  []string
+}
+
+// walkOperations collects the operations in the DAG. The operations are the children of the classes
+// they use, and the classes are the children of the operations that create them.
+func walkOperations(dag *mqswag.DAG) []*walkOp {
+	var ops []*walkOp
+	opMap := make(map[*mqswag.DAGNode]*walkOp)
+	dag.IterateByWeight(func(previous *mqswag.DAGNode, current *mqswag.DAGNode) error {
+		if current.GetType() != mqswag.TypeOp {
+			return nil
+		}
+		op := &walkOp{node: current, method: current.GetMethod()}
+		tag := mqswag.GetMeqaTag(current.Data.(*spec.Operation).Description)
+		if tag != nil && len(tag.Operation) > 0 {
+			op.method = tag.Operation
+		}
+		for _, c := range current.Children {
+			if c.GetType() == mqswag.TypeDef && op.method == mqswag.MethodPost {
+				op.produces = append(op.produces, c.GetName())
+			}
+		}
+		ops = append(ops, op)
+		opMap[current] = op
+		return nil
+	})
+	dag.IterateByWeight(func(previous *mqswag.DAGNode, current *mqswag.DAGNode) error {
+		if current.GetType() != mqswag.TypeDef {
+			return nil
+		}
+		for _, c := range current.Children {
+			if op := opMap[c]; op != nil {
+				op.consumes = append(op.consumes, current.GetName())
+			}
+		}
+		return nil
+	})
+	for _, op := range ops {
+		if op.method != mqswag.MethodDelete {
+			continue
+		}
+		tag := mqswag.GetMeqaTag(op.node.Data.(*spec.Operation).Description)
+		if tag != nil && len(tag.Class) > 0 {
+			op.deletes = []string{tag.Class}
+		} else {
+			op.deletes = op.consumes
+		}
+	}
+	return ops
+}
+
+// walk is the state of a random walk: the number of objects of each class we expect the server to have.
+type walk struct {
+	creatable map[string]bool // the classes some operation creates
+	live      map[string]int
+	created   []string // the classes of the objects created, in order
+}
+
+// enabled returns whether the objects the operation uses have been created.
+func (w *walk) enabled(op *walkOp) bool {
+	for _, classes := range [][]string{op.consumes, op.deletes} {
+		for _, c := range classes {
+			if w.creatable[c] && w.live[c] == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// weight returns the chance of picking the operation. Creating the first object of a class is more likely.
+func (w *walk) weight(op *walkOp) int {
+	weight := walkWeights[op.method]
+	for _, c := range op.produces {
+		if w.live[c] == 0 {
+			weight++
+		}
+	}
+	return weight
+}
+
+func (w *walk) apply(op *walkOp) {
+	for _, c := range op.produces {
+		w.live[c]++
+		w.created = append(w.created, c)
+	}
+	for _, c := range op.deletes {
+		if w.live[c] > 0 {
+			w.live[c]--
+		}
+	}
+}
+
+// pick picks one of the enabled operations at random, by their weights. It returns nil if none is enabled.
+func (w *walk) pick(ops []*walkOp, r *rand.Rand) *walkOp {
+	total := 0
+	weights := make([]int, len(ops))
+	for i, op := range ops {
+		if w.enabled(op) {
+			weights[i] = w.weight(op)
+			total += weights[i]
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	n := r.Intn(total)
+	for i, op := range ops {
+		if n < weights[i] {
+			return op
+		}
+		n -= weights[i]
+	}
+	return nil
+}
+
+// deleteOperations maps the classes to the operations that delete them.
+func deleteOperations(ops []*walkOp) map[string]*walkOp {
+	deletes := make(map[string]*walkOp)
+	for _, op := range ops {
+		for _, c := range op.deletes {
+			if deletes[c] == nil {
+				deletes[c] = op
+			}
+		}
+	}
+	return deletes
+}
+
+// GenerateRandomTestPlan generates test suites that are random walks over the operations in the DAG.
+// An operation is only picked after the objects it uses are created, and the objects left at the end
+// of a walk are deleted, latest first. The same seed generates the same walks.
+func GenerateRandomTestPlan(swagger *mqswag.Swagger, dag *mqswag.DAG, walks int, steps int, seed int64) (*TestPlan, error) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(seed))
+
+	testPlan := &TestPlan{}
+	testPlan.Init(swagger, nil)
+	testPlan.comment = fmt.Sprintf(`
+In this test plan, each test suite is a random walk over the operations. An operation is only
+called after the objects it uses have been created, and the objects left at the end are deleted.
+The operations run in orders the other test plans don't try.
+Generated with seed %d, use "mqgen -a random -seed %d" to generate the same test plan again.
+`, seed, seed)
+	addInitTestSuite(testPlan)
+
+	ops := walkOperations(dag)
+	deletes := deleteOperations(ops)
+	creatable := make(map[string]bool)
+	for _, op := range ops {
+		for _, c := range op.produces {
+			creatable[c] = true
+		}
+	}
+
+	for i := 0; i < walks; i++ {
+		w := &walk{creatable: creatable, live: make(map[string]int)}
+		testSuite := CreateTestSuite(fmt.Sprintf("random walk %d", i+1), nil, testPlan)
+		testId := 0
+		add := func(op *walkOp) {
+			testId++
+			testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(op.node, testId))
+			w.apply(op)
+		}
+		for step := 0; step < steps; step++ {
+			op := w.pick(ops, r)
+			if op == nil {
+				break
+			}
+			add(op)
+		}
+		for j := len(w.created) - 1; j >= 0; j-- {
+			c := w.created[j]
+			if op := deletes[c]; op != nil && w.live[c] > 0 && w.enabled(op) {
+				add(op)
+			}
+		}
+		if len(testSuite.Tests) > 0 {
+			testPlan.Add(testSuite)
+		}
+	}
+	return testPlan, nil
+}
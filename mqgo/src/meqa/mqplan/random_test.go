@@ -0,0 +1,105 @@
+package mqplan
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"meqa/mqswag"
+)
+
+func TestGenerateRandomTestPlan(t *testing.T) {
+	swagger := loadPetstore(t)
+	dag := mqswag.NewDAG()
+	if err := swagger.AddToDAG(dag); err != nil {
+		t.Fatal(err)
+	}
+	dag.Sort()
+	dag.CheckWeight()
+	plan, err := GenerateRandomTestPlan(swagger, dag, 4, 20, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(plan.comment, "mqgen -a random -seed 7") {
+		t.Errorf("the comment doesn't tell how to generate the plan again: %s", plan.comment)
+	}
+
+	ops := walkOperations(dag)
+	opMap := make(map[string]*walkOp)
+	creatable := make(map[string]bool)
+	for _, op := range ops {
+		opMap[op.node.GetName()+" "+op.node.GetMethod()] = op
+		for _, c := range op.produces {
+			creatable[c] = true
+		}
+	}
+	if len(creatable) == 0 {
+		t.Fatal("no operation creates an object")
+	}
+	deletes := deleteOperations(ops)
+
+	for i := 0; i < 4; i++ {
+		suite := plan.SuiteMap[fmt.Sprintf("random walk %d", i+1)]
+		if suite == nil || len(suite.Tests) < 20 {
+			t.Fatalf("random walk %d: expected at least 20 tests, got %+v", i+1, suite)
+		}
+		// Replay the walk: each operation uses the objects created before it.
+		w := &walk{creatable: creatable, live: make(map[string]int)}
+		for j, test := range suite.Tests {
+			op := opMap[test.Path+" "+test.Method]
+			if op == nil {
+				t.Fatalf("%s: unknown operation %s %s", test.Name, test.Method, test.Path)
+			}
+			if !w.enabled(op) {
+				t.Errorf("random walk %d: %s runs before the objects it uses are created", i+1, test.Name)
+			}
+			// The steps after the walk only delete.
+			if j >= 20 && op.method != mqswag.MethodDelete {
+				t.Errorf("random walk %d: %s runs after the walk", i+1, test.Name)
+			}
+			w.apply(op)
+		}
+		// The objects that can be deleted are gone at the end.
+		for c, n := range w.live {
+			if n > 0 && deletes[c] != nil {
+				t.Errorf("random walk %d: %d objects of %s are left", i+1, n, c)
+			}
+		}
+	}
+}
+
+func TestRandomWalkPick(t *testing.T) {
+	create := &walkOp{method: mqswag.MethodPost, produces: []string{"Pet"}}
+	get := &walkOp{method: mqswag.MethodGet, consumes: []string{"Pet"}}
+	remove := &walkOp{method: mqswag.MethodDelete, consumes: []string{"Pet"}, deletes: []string{"Pet"}}
+	ops := []*walkOp{create, get, remove}
+	w := &walk{creatable: map[string]bool{"Pet": true}, live: make(map[string]int)}
+
+	// Nothing uses a pet before one is created.
+	for i := 0; i < 20; i++ {
+		if op := w.pick(ops, globalRand); op != create {
+			t.Fatalf("expected the create to be picked first, got %+v", op)
+		}
+	}
+	// Creating the first object of a class is more likely.
+	if weight := w.weight(create); weight != walkWeights[mqswag.MethodPost]+1 {
+		t.Errorf("unexpected weight %d", weight)
+	}
+	w.apply(create)
+	if !w.enabled(get) || !w.enabled(remove) || w.weight(create) != walkWeights[mqswag.MethodPost] {
+		t.Error("expected the operations on the pet to be enabled")
+	}
+	w.apply(remove)
+	if w.live["Pet"] != 0 || w.enabled(get) {
+		t.Errorf("expected the pet to be deleted, got %v", w.live)
+	}
+
+	// The classes no operation creates don't hold the operations back.
+	lookup := &walkOp{method: mqswag.MethodGet, consumes: []string{"Inventory"}}
+	if op := w.pick([]*walkOp{lookup}, globalRand); op != lookup {
+		t.Errorf("expected the lookup to be picked, got %+v", op)
+	}
+	if op := (&walk{creatable: map[string]bool{"Pet": true}, live: make(map[string]int)}).pick([]*walkOp{get}, globalRand); op != nil {
+		t.Errorf("expected nothing to be picked, got %+v", op)
+	}
+}
@@ -0,0 +1,97 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gopkg.in/resty.v0"
+
+	"meqa/mqutil"
+)
+
+// Retry makes a test send its request again until the response passes the until expect block, e.g. to
+// wait for an object the server creates asynchronously.
+type Retry struct {
+	Count   int                    `yaml:"count,omitempty"`   // the most times the request is sent again
+	DelayMs int                    `yaml:"delayMs,omitempty"` // how long to wait before sending it again
+	Until   map[string]interface{} `yaml:"until,omitempty"`   // the expect block to wait for, the test's expect by default
+}
+
+// Attempt is one of the requests a test that retries sent.
+type Attempt struct {
+	Status     int     `yaml:"status,omitempty" json:"status,omitempty"`
+	DurationMs float64 `yaml:"durationMs" json:"durationMs"`
+	Error      string  `yaml:"error,omitempty" json:"error,omitempty"`
+	Passed     bool    `yaml:"passed" json:"passed"` // whether the response passed the until expect block
+}
+
+func (a *Attempt) String() string {
+	if len(a.Error) > 0 {
+		return fmt.Sprintf("%s after %.0fms", a.Error, a.DurationMs)
+	}
+	return fmt.Sprintf("status %d after %.0fms", a.Status, a.DurationMs)
+}
+
+// until returns the expect block the retries wait for.
+func (t *Test) until() map[string]interface{} {
+	if len(t.Retry.Until) > 0 {
+		return t.Retry.Until
+	}
+	return t.Expect
+}
+
+// untilPasses checks the response against the until expect block, without changing the test.
+func (t *Test) untilPasses(resp *resty.Response, err error) bool {
+	if err != nil {
+		return false
+	}
+	expect := t.until()
+	var expectedStatus interface{} = "success"
+	if expect[ExpectStatus] != nil {
+		expectedStatus = expect[ExpectStatus]
+	}
+	if !t.statusPasses(expectedStatus, resp.StatusCode()) {
+		return false
+	}
+	var resultObj interface{}
+	if body := resp.Body(); len(body) > 0 {
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+		d.Decode(&resultObj)
+	}
+	if expect[ExpectBody] != nil && !mqutil.InterfaceEquals(expect[ExpectBody], resultObj) {
+		return false
+	}
+	for _, a := range t.evalAssertions(expect, resp, resultObj) {
+		if !a.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// retry sends the request again while the response doesn't pass the until expect block and there are
+// retries left. Each attempt is recorded in the test. It returns the last response.
+func (t *Test) retry(req *resty.Request, path string, resp *resty.Response, err error) (*resty.Response, error) {
+	for i := 0; ; i++ {
+		t.stopTime = time.Now()
+		attempt := &Attempt{DurationMs: float64(t.duration().Nanoseconds()) / 1e6}
+		if err != nil {
+			attempt.Error = err.Error()
+		} else {
+			attempt.Status = resp.StatusCode()
+		}
+		attempt.Passed = t.untilPasses(resp, err)
+		t.Attempts = append(t.Attempts, attempt)
+		if attempt.Passed || i >= t.Retry.Count {
+			return resp, err
+		}
+		fmt.Printf("... attempt %d of %d didn't pass, retrying in %dms\n", i+1, t.Retry.Count+1, t.Retry.DelayMs)
+		mqutil.Logger.Printf("attempt %d: status %d, error %s", i+1, attempt.Status, attempt.Error)
+		time.Sleep(time.Duration(t.Retry.DelayMs) * time.Millisecond)
+		t.startTime = time.Now()
+		resp, err = t.send(req, path)
+	}
+}
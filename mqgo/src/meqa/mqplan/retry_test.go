@@ -0,0 +1,154 @@
+package mqplan
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"meqa/mqutil"
+)
+
+// newOrderServer returns a recordingServer that answers 404 until the order is created, then the order
+// with the status placed until it's delivered.
+func newOrderServer(notFound int, placed int) *recordingServer {
+	return newRespondingServer(func(w http.ResponseWriter, r *http.Request, body []byte, n int) {
+		if n <= notFound {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		status := "delivered"
+		if n <= notFound+placed {
+			status = "placed"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id": 1, "petId": 1, "quantity": 1, "status": "%s"}`, status)
+	})
+}
+
+// runRetry runs the test of get /store/order/1 with the retry and expect blocks, and returns the result.
+func runRetry(t *testing.T, server *recordingServer, retry string, expect string) *Test {
+	plan := newTestPlan(t, loadPetstore(t), `
+orders:
+- name: get
+  method: get
+  path: /store/order/{orderId}
+  pathParams:
+    orderId: 1
+`+retry+expect, server.URL)
+	plan.Run("orders", nil)
+	if len(plan.resultList) != 1 {
+		t.Fatalf("expected one result, got %d", len(plan.resultList))
+	}
+	return plan.resultList[0]
+}
+
+func TestRetry(t *testing.T) {
+	server := newOrderServer(2, 0)
+	defer server.Close()
+	// By default the retries wait for the expect block.
+	result := runRetry(t, server, `
+  retry:
+    count: 5
+    delayMs: 10
+`, `
+  expect:
+    status: 200
+`)
+	if result.err != nil || server.calls() != 3 || len(result.Attempts) != 3 {
+		t.Fatalf("expected a pass after 3 calls, got %v after %d calls, %v", result.err, server.calls(), result.Attempts)
+	}
+	for i, a := range result.Attempts {
+		if expected := (i == 2); a.Passed != expected || (expected && a.Status != 200) || (!expected && a.Status != 404) {
+			t.Errorf("attempt %d: unexpected %+v", i+1, a)
+		}
+	}
+	if result.Attempts[1].DurationMs > 1000 {
+		t.Errorf("the delay is counted in the duration of the attempt: %v", result.Attempts[1])
+	}
+}
+
+func TestRetryUntil(t *testing.T) {
+	server := newOrderServer(0, 2)
+	defer server.Close()
+	start := time.Now()
+	result := runRetry(t, server, `
+  retry:
+    count: 5
+    delayMs: 50
+    until:
+      json:
+        $.status: delivered
+`, "")
+	if result.err != nil || server.calls() != 3 || len(result.Attempts) != 3 || !result.Attempts[2].Passed {
+		t.Fatalf("expected a pass after 3 calls, got %v after %d calls, %v", result.err, server.calls(), result.Attempts)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected the delay between the attempts, it took %v", elapsed)
+	}
+
+	// The last response is checked against the expect block once there are no retries left.
+	server = newOrderServer(0, 10)
+	defer server.Close()
+	result = runRetry(t, server, `
+  retry:
+    count: 2
+    until:
+      json:
+        $.status: delivered
+`, `
+  expect:
+    json:
+      $.status: delivered
+`)
+	if server.calls() != 3 || len(result.Attempts) != 3 || result.Attempts[2].Passed {
+		t.Fatalf("expected 3 attempts that didn't pass, got %d calls, %v", server.calls(), result.Attempts)
+	}
+	if e, ok := result.err.(mqutil.Error); !ok || e.Type() != mqutil.ErrExpect {
+		t.Errorf("expected the test to fail, got %v", result.err)
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	server := newOrderServer(1, 0)
+	defer server.Close()
+	result := runRetry(t, server, "", "")
+	if server.calls() != 1 || len(result.Attempts) != 0 || result.err == nil {
+		t.Errorf("expected a single call that failed, got %d calls, %v %v", server.calls(), result.Attempts, result.err)
+	}
+}
+
+func TestRetryUntilTemplate(t *testing.T) {
+	server := newOrderServer(0, 0)
+	defer server.Close()
+	// The templates in the until block are resolved like the ones in the expect block.
+	plan := newTestPlan(t, loadPetstore(t), `
+orders:
+- name: create
+  method: post
+  path: /store/order
+- name: get
+  method: get
+  path: /store/order/{orderId}
+  pathParams:
+    orderId: '{{create.outputs.id}}'
+  retry:
+    count: 2
+    until:
+      json:
+        $.id: '{{create.outputs.id}}'
+`, server.URL)
+	plan.Run("orders", nil)
+	if len(plan.resultList) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(plan.resultList))
+	}
+	result := plan.resultList[1]
+	if result.err != nil || server.calls() != 2 || len(result.Attempts) != 1 || !result.Attempts[0].Passed {
+		t.Fatalf("expected a pass on the first attempt, got %v after %d calls, %v", result.err, server.calls(), result.Attempts)
+	}
+	// The test in the plan keeps the template for the next run.
+	until := plan.SuiteMap["orders"].Tests[1].Retry.Until["json"].(map[string]interface{})
+	if until["$.id"] != "{{create.outputs.id}}" {
+		t.Errorf("expected the template in the plan, got %v", until["$.id"])
+	}
+}
@@ -0,0 +1,140 @@
+package mqplan
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+
+	"meqa/mqutil"
+)
+
+// The placeholders replaced when the test plan is loaded, e.g. ${env:API_TENANT} or ${secret:api_token}.
+var placeholderRegex = regexp.MustCompile(`\$\{(env|secret):([^}]+)\}`)
+
+// LoadSecretsFromFile reads the values of the ${secret:name} placeholders from a yaml file, e.g.
+//
+//	api_token: abcd
+//	tenant_id: "1234"
+func (plan *TestPlan) LoadSecretsFromFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("can't read the secrets file %s: %s", path, err.Error()))
+	}
+	secrets := make(map[string]string)
+	err = yaml.Unmarshal(data, &secrets)
+	if err != nil {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid secrets file %s: %s", path, err.Error()))
+	}
+	plan.Secrets = secrets
+	return nil
+}
+
+// placeholderValue returns the value of the environment variable, or the secret. A secret that isn't in
+// the secrets file is taken from the environment variable of the same name. The secrets are masked in the
+// output from now on.
+func (plan *TestPlan) placeholderValue(kind string, name string) (string, error) {
+	if kind == "secret" {
+		value, ok := plan.Secrets[name]
+		if !ok {
+			value, ok = os.LookupEnv(name)
+		}
+		if !ok {
+			return "", mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("secret %s is not in the secrets file or the environment", name))
+		}
+		mqutil.AddSecret(value)
+		return value, nil
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("environment variable %s is not set", name))
+	}
+	return value, nil
+}
+
+// resolvePlaceholders replaces the placeholders in the strings of the value, and in its maps and arrays.
+func (plan *TestPlan) resolvePlaceholders(v interface{}) (interface{}, error) {
+	var err error
+	switch value := v.(type) {
+	case string:
+		resolved := placeholderRegex.ReplaceAllStringFunc(value, func(placeholder string) string {
+			m := placeholderRegex.FindStringSubmatch(placeholder)
+			s, e := plan.placeholderValue(m[1], m[2])
+			if e != nil && err == nil {
+				err = e
+			}
+			return s
+		})
+		return resolved, err
+	case map[string]interface{}:
+		for k, e := range value {
+			if value[k], err = plan.resolvePlaceholders(e); err != nil {
+				return v, err
+			}
+		}
+	case []interface{}:
+		for i, e := range value {
+			if value[i], err = plan.resolvePlaceholders(e); err != nil {
+				return v, err
+			}
+		}
+	}
+	return v, nil
+}
+
+func (plan *TestPlan) resolveParamPlaceholders(p *TestParams) error {
+	for _, m := range []map[string]interface{}{p.PathParams, p.QueryParams, p.HeaderParams, p.FormParams} {
+		if _, err := plan.resolvePlaceholders(m); err != nil {
+			return err
+		}
+	}
+	var err error
+	p.BodyParams, err = plan.resolvePlaceholders(p.BodyParams)
+	return err
+}
+
+// resolveExpectPlaceholders replaces the placeholders in the expect block of the test and in the one
+// its retry waits for.
+func (plan *TestPlan) resolveExpectPlaceholders(t *Test) error {
+	if _, err := plan.resolvePlaceholders(t.Expect); err != nil {
+		return err
+	}
+	if t.Retry != nil {
+		if _, err := plan.resolvePlaceholders(t.Retry.Until); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolvePlaceholders replaces the ${env:name} and ${secret:name} placeholders in the parameters of the
+// test plan, the suites and the tests, in the expect blocks of the tests, and in the headers sent with
+// every request. The tests with a dataset are expanded by then, so the values of the rows are replaced too.
+func (plan *TestPlan) ResolvePlaceholders() error {
+	if err := plan.resolveParamPlaceholders(&plan.TestParams); err != nil {
+		return err
+	}
+	for k, v := range plan.Headers {
+		resolved, err := plan.resolvePlaceholders(v)
+		if err != nil {
+			return err
+		}
+		plan.Headers[k] = resolved.(string)
+	}
+	for _, suite := range plan.allSuites() {
+		if err := plan.resolveParamPlaceholders(&suite.TestParams); err != nil {
+			return mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("test suite %s: %s", suite.Name, mqutil.ErrorMessage(err)))
+		}
+		for _, t := range suite.allTests() {
+			if err := plan.resolveParamPlaceholders(&t.TestParams); err != nil {
+				return mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("test %s: %s", t.Name, mqutil.ErrorMessage(err)))
+			}
+			if err := plan.resolveExpectPlaceholders(t); err != nil {
+				return mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("test %s: %s", t.Name, mqutil.ErrorMessage(err)))
+			}
+		}
+	}
+	return nil
+}
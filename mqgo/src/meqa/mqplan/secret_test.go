@@ -0,0 +1,212 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"html"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"meqa/mqswag"
+	"meqa/mqutil"
+)
+
+const placeholderPlan = `
+pets:
+- name: find
+  method: get
+  path: /pet/findByStatus
+  headerParams:
+    api_key: ${secret:mqplan_test_key}
+  expect:
+    status: 200
+    headers:
+      X-Tenant: ${env:MQPLAN_TEST_TENANT}
+  retry:
+    count: 2
+    until:
+      headers:
+        X-Tenant: ${env:MQPLAN_TEST_TENANT}
+  dataset:
+  - queryParams.status: ${env:MQPLAN_TEST_STATUS}
+    expect.message: ${secret:mqplan_test_key}
+`
+
+func newPlaceholderPlan(t *testing.T) *TestPlan {
+	mqutil.Logger = mqutil.NewStdLogger()
+	plan := &TestPlan{}
+	plan.Init(nil, nil)
+	plan.Secrets = map[string]string{"mqplan_test_key": "s3cr3t-k3y"}
+	if err := plan.AddFromString(placeholderPlan); err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func TestResolvePlaceholders(t *testing.T) {
+	os.Setenv("MQPLAN_TEST_TENANT", "acme")
+	os.Setenv("MQPLAN_TEST_STATUS", "sold")
+	defer os.Unsetenv("MQPLAN_TEST_TENANT")
+	defer os.Unsetenv("MQPLAN_TEST_STATUS")
+
+	plan := newPlaceholderPlan(t)
+	if err := plan.ResolvePlaceholders(); err != nil {
+		t.Fatal(err)
+	}
+	tests := plan.SuiteMap["pets"].Tests
+	if len(tests) != 1 || tests[0].Name != "find[0]" {
+		t.Fatalf("expected the dataset to expand to find[0], got %d tests", len(tests))
+	}
+	test := tests[0]
+	if v := test.HeaderParams["api_key"]; v != "s3cr3t-k3y" {
+		t.Errorf("header parameter: expected the secret, got %v", v)
+	}
+	if v := test.QueryParams["status"]; v != "sold" {
+		t.Errorf("dataset row: expected sold, got %v", v)
+	}
+	if v := test.Expect["message"]; v != "s3cr3t-k3y" {
+		t.Errorf("dataset row bound to the expect block: expected the secret, got %v", v)
+	}
+	headers, _ := test.Expect[ExpectHeaders].(map[string]interface{})
+	if v := headers["X-Tenant"]; v != "acme" {
+		t.Errorf("expect headers: expected acme, got %v", v)
+	}
+	until, _ := test.Retry.Until[ExpectHeaders].(map[string]interface{})
+	if v := until["X-Tenant"]; v != "acme" {
+		t.Errorf("retry until: expected acme, got %v", v)
+	}
+
+	masked := mqutil.MaskSecrets("api_key: s3cr3t-k3y, tenant: acme")
+	if strings.Contains(masked, "s3cr3t-k3y") || !strings.Contains(masked, mqutil.SecretMask) {
+		t.Errorf("the secret isn't masked: %s", masked)
+	}
+	if !strings.Contains(masked, "acme") {
+		t.Errorf("the environment variables aren't secrets: %s", masked)
+	}
+}
+
+func TestResolvePlaceholdersMissing(t *testing.T) {
+	os.Unsetenv("MQPLAN_TEST_TENANT")
+	os.Setenv("MQPLAN_TEST_STATUS", "sold")
+	defer os.Unsetenv("MQPLAN_TEST_STATUS")
+
+	plan := newPlaceholderPlan(t)
+	err := plan.ResolvePlaceholders()
+	if err == nil || !strings.Contains(err.Error(), "MQPLAN_TEST_TENANT") {
+		t.Errorf("expected an error about the unset variable, got %v", err)
+	}
+}
+
+func TestLoadSecretsFromFile(t *testing.T) {
+	mqutil.Logger = mqutil.NewStdLogger()
+	dir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secrets.yml")
+	ioutil.WriteFile(path, []byte("api_token: abcd\ntenant_id: \"1234\"\n"), 0600)
+	plan := &TestPlan{}
+	if err = plan.LoadSecretsFromFile(path); err != nil || plan.Secrets["api_token"] != "abcd" || plan.Secrets["tenant_id"] != "1234" {
+		t.Errorf("unexpected secrets %v %v", plan.Secrets, err)
+	}
+	if err = plan.LoadSecretsFromFile(filepath.Join(dir, "missing.yml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	ioutil.WriteFile(path, []byte("- a list"), 0600)
+	if err = plan.LoadSecretsFromFile(path); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+
+	// A secret that isn't in the file comes from the environment.
+	os.Setenv("mqplan_test_env_secret", "from-env")
+	defer os.Unsetenv("mqplan_test_env_secret")
+	if value, err := plan.placeholderValue("secret", "mqplan_test_env_secret"); err != nil || value != "from-env" {
+		t.Errorf("expected the secret from the environment, got %s %v", value, err)
+	}
+	if masked := mqutil.MaskSecrets("from-env"); masked != mqutil.SecretMask {
+		t.Errorf("the secret from the environment isn't masked: %s", masked)
+	}
+	if _, err := plan.placeholderValue("secret", "mqplan_test_no_secret"); err == nil {
+		t.Error("expected an error for a missing secret")
+	}
+}
+
+func TestSecretsMaskedInResults(t *testing.T) {
+	server := newRecordingServer()
+	defer server.Close()
+	swagger := loadPetstore(t)
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	plan := &TestPlan{}
+	plan.Init(swagger, db)
+	plan.BaseURL = server.URL
+	plan.Secrets = map[string]string{"mqplan_test_key": "masked-api-key"}
+	if err := plan.AddFromString(`
+pets:
+- name: find
+  method: get
+  path: /pet/findByStatus
+  queryParams:
+    status: available
+  headerParams:
+    api_key: ${secret:mqplan_test_key}
+`); err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.ResolvePlaceholders(); err != nil {
+		t.Fatal(err)
+	}
+	plan.Run("pets", nil)
+	if len(server.requests(false)) != 1 {
+		t.Fatalf("expected a request, got %v", server.requests(false))
+	}
+
+	// The secret is sent, but not written to the results.
+	dir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "result.yml")
+	if err = plan.WriteResultToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if result := string(data); strings.Contains(result, "masked-api-key") || !strings.Contains(result, "api_key: "+mqutil.SecretMask) {
+		t.Errorf("the secret isn't masked in the results:\n%s", result)
+	}
+}
+
+func TestEscapedSecretsMaskedInReports(t *testing.T) {
+	mqutil.Logger = mqutil.NewStdLogger()
+	mqutil.AddSecret(`k&y<"secret">`)
+	test := &Test{Name: "find", Method: "get", Path: "/pet/1", suite: &TestSuite{Name: "pets"}}
+	test.err = mqutil.NewError(mqutil.ErrHttp, `bad token k&y<"secret">`)
+	plan := &TestPlan{resultList: []*Test{test}}
+
+	dir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	summaryPath := filepath.Join(dir, "summary.json")
+	if err = plan.WriteJSONSummaryToFile(summaryPath); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(summaryPath)
+	summary := &RunSummary{}
+	if err = json.Unmarshal(data, summary); err != nil || len(summary.Results) != 1 ||
+		summary.Results[0].Error != "bad token "+mqutil.SecretMask {
+		t.Errorf("the secret isn't masked in the JSON summary:\n%s", string(data))
+	}
+	if e := readJUnit(t, plan).Suites[0].TestCases[0].Error; e == nil || e.Message != "bad token "+mqutil.SecretMask {
+		t.Errorf("the secret isn't masked in the JUnit report: %+v", e)
+	}
+	if page := html.UnescapeString(writeHTML(t, plan)); strings.Contains(page, "secret") ||
+		!strings.Contains(page, "bad token "+mqutil.SecretMask) {
+		t.Error("the secret isn't masked in the HTML report")
+	}
+}
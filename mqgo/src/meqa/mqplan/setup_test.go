@@ -0,0 +1,173 @@
+package mqplan
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"meqa/mqutil"
+)
+
+// newStatusServer returns a recordingServer that answers with the status set for the method, or echoes
+// the body of the request, a pet if it has none.
+func newStatusServer(statuses map[string]int) *recordingServer {
+	s := newRespondingServer(func(w http.ResponseWriter, r *http.Request, body []byte, n int) {
+		w.Header().Set("Content-Type", "application/json")
+		if len(body) == 0 {
+			body = []byte(`{"id": 7, "name": "doggie", "photoUrls": []}`)
+		}
+		w.Write(body)
+	})
+	s.setStatuses(statuses)
+	return s
+}
+
+const setupSuites = `
+pets:
+  setup:
+  - name: create
+    method: post
+    path: /pet
+    bodyParams:
+      id: 7
+      name: doggie
+      photoUrls: []
+  tests:
+  - name: get
+    method: get
+    path: /pet/{petId}
+    pathParams:
+      petId: '{{create.outputs.id}}'
+  - name: update
+    method: put
+    path: /pet
+    bodyParams:
+      id: '{{create.outputs.id}}'
+      name: kitty
+      photoUrls: []
+  teardown:
+  - name: delete
+    method: delete
+    path: /pet/{petId}
+    pathParams:
+      petId: '{{create.outputs.id}}'
+`
+
+// runSetupSuites runs the pets suite against a server that answers with the statuses by method.
+func runSetupSuites(t *testing.T, statuses map[string]int) (map[string]int, []string, *TestPlan) {
+	server := newStatusServer(statuses)
+	defer server.Close()
+	plan := newTestPlan(t, loadPetstore(t), setupSuites, server.URL)
+	counts, _ := plan.Run("pets", nil)
+	return counts, server.paths(), plan
+}
+
+func TestSetupTeardown(t *testing.T) {
+	counts, requests, plan := runSetupSuites(t, nil)
+	expected := []string{"POST /pet", "GET /pet/7", "PUT /pet", "DELETE /pet/7"}
+	if !equalStrings(requests, expected) {
+		t.Errorf("expected the requests %v, got %v", expected, requests)
+	}
+	// The setup test is counted, the teardown test isn't.
+	if counts[mqutil.Total] != 3 || counts[mqutil.Passed] != 3 || counts[mqutil.TeardownFailed] != 0 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+	phases := make(map[string]string)
+	for _, test := range plan.resultList {
+		phases[test.Name] = test.phase
+	}
+	if phases["create"] != PhaseSetup || phases["get"] != "" || phases["delete"] != PhaseTeardown {
+		t.Errorf("unexpected phases %v", phases)
+	}
+}
+
+func TestSetupFailure(t *testing.T) {
+	// The tests are skipped, and the teardown still runs.
+	counts, requests, _ := runSetupSuites(t, map[string]int{http.MethodPost: http.StatusInternalServerError})
+	if len(requests) != 2 || requests[0] != "POST /pet" || !strings.HasPrefix(requests[1], "DELETE /pet/") {
+		t.Errorf("unexpected requests %v", requests)
+	}
+	if counts[mqutil.Total] != 3 || counts[mqutil.Failed] != 1 || counts[mqutil.Skipped] != 2 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+
+	// A test fails, and the teardown fails too.
+	counts, requests, _ = runSetupSuites(t, map[string]int{
+		http.MethodPut:    http.StatusInternalServerError,
+		http.MethodDelete: http.StatusInternalServerError,
+	})
+	if expected := []string{"POST /pet", "GET /pet/7", "PUT /pet", "DELETE /pet/7"}; !equalStrings(requests, expected) {
+		t.Errorf("expected the requests %v, got %v", expected, requests)
+	}
+	if counts[mqutil.Total] != 3 || counts[mqutil.Passed] != 2 || counts[mqutil.Failed] != 1 || counts[mqutil.TeardownFailed] != 1 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
+
+const planSetupSuites = `
+meqa_setup:
+- name: create
+  method: post
+  path: /pet
+  bodyParams:
+    id: 7
+    name: doggie
+    photoUrls: []
+---
+meqa_teardown:
+- name: delete
+  method: delete
+  path: /pet/{petId}
+  pathParams:
+    petId: '{{create.outputs.id}}'
+---
+pets:
+- name: get
+  method: get
+  path: /pet/{petId}
+  pathParams:
+    petId: '{{create.outputs.id}}'
+---
+users:
+- name: find
+  method: get
+  path: /pet/findByStatus
+  queryParams:
+    status: '{{create.bodyParams.name}}'
+`
+
+func TestPlanSetupTeardown(t *testing.T) {
+	for _, parallel := range []int{1, 2} {
+		server := newStatusServer(nil)
+		plan := newTestPlan(t, loadPetstore(t), planSetupSuites, server.URL)
+		counts, errs := plan.RunSuites([]string{"pets", "users"}, parallel)
+		server.Close()
+		requests := server.paths()
+		if len(requests) != 4 || requests[0] != "POST /pet" || requests[3] != "DELETE /pet/7" {
+			t.Errorf("parallel %d: expected the setup first and the teardown last, got %v", parallel, requests)
+		}
+		for i := range counts {
+			if errs[i] != nil || counts[i][mqutil.Passed] != 1 {
+				t.Errorf("parallel %d: unexpected result %v %v", parallel, counts[i], errs[i])
+			}
+		}
+		if plan.ResultCounts[mqutil.Passed] != 1 || plan.ResultCounts[mqutil.Total] != 1 {
+			t.Errorf("parallel %d: expected the setup test in the counts of the plan, got %v", parallel, plan.ResultCounts)
+		}
+	}
+
+	// The suites are skipped when the setup fails, and the teardown still runs.
+	server := newStatusServer(map[string]int{http.MethodPost: http.StatusInternalServerError})
+	defer server.Close()
+	plan := newTestPlan(t, loadPetstore(t), planSetupSuites, server.URL)
+	counts, errs := plan.RunSuites([]string{"pets", "users"}, 1)
+	requests := server.paths()
+	if len(requests) != 2 || requests[0] != "POST /pet" || !strings.HasPrefix(requests[1], "DELETE /pet/") {
+		t.Errorf("expected the setup and the teardown, got %v", requests)
+	}
+	for i := range counts {
+		if errs[i] == nil || counts[i][mqutil.Skipped] != 1 || counts[i][mqutil.Total] != 1 {
+			t.Errorf("expected the suite to be skipped, got %v %v", counts[i], errs[i])
+		}
+	}
+}
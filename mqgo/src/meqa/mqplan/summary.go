@@ -0,0 +1,105 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"meqa/mqutil"
+)
+
+// TestResult is the machine readable result of one test.
+type TestResult struct {
+	Name           string  `json:"name"`
+	Suite          string  `json:"suite"`
+	Method         string  `json:"method"`
+	Path           string  `json:"path"`
+	URL            string  `json:"url,omitempty"`
+	Status         string  `json:"status"`          // mqutil.Passed, mqutil.Failed or mqutil.Skipped
+	Phase          string  `json:"phase,omitempty"` // setup or teardown for the tests run before or after the others
+	StatusCode     int     `json:"statusCode,omitempty"`
+	DurationMs     float64 `json:"durationMs"`
+	Error          string  `json:"error,omitempty"`
+	ErrorCategory  string  `json:"errorCategory,omitempty"`
+	SkipReason     string  `json:"skipReason,omitempty"`
+	SchemaMismatch string  `json:"schemaMismatch,omitempty"`
+
+	Assertions []*Assertion `json:"assertions,omitempty"` // the headers, latency, content type and json checks
+	Attempts   []*Attempt   `json:"attempts,omitempty"`   // the requests sent by a test that retries
+}
+
+// RunSummary is the machine readable summary of a test plan run.
+type RunSummary struct {
+	Counts  map[string]int `json:"counts"`
+	Results []*TestResult  `json:"results"`
+}
+
+// suiteName returns the name of the suite the test belongs to.
+func (t *Test) suiteName() string {
+	if t.suite != nil {
+		return t.suite.Name
+	}
+	return ""
+}
+
+// resultsBySuite groups the tests that were run by suite. The suite names are in the order they were run.
+// The teardown tests of a suite are in a group of their own, so their failures are reported apart.
+func (plan *TestPlan) resultsBySuite() ([]string, map[string][]*Test) {
+	var names []string
+	tests := make(map[string][]*Test)
+	for _, t := range plan.resultList {
+		name := t.suiteName()
+		if t.phase == PhaseTeardown && name != MeqaTeardown && name != MeqaCleanup {
+			name += " " + PhaseTeardown
+		}
+		if _, ok := tests[name]; !ok {
+			names = append(names, name)
+		}
+		tests[name] = append(tests[name], t)
+	}
+	return names, tests
+}
+
+func (t *Test) toResult() *TestResult {
+	r := &TestResult{Name: t.Name, Suite: t.suiteName(), Method: t.Method, Path: t.Path, URL: t.url, Status: mqutil.Passed,
+		Phase: t.phase}
+	if t.resp != nil {
+		r.StatusCode = t.resp.StatusCode()
+	}
+	r.DurationMs = float64(t.duration().Nanoseconds()) / 1e6
+	if t.err != nil {
+		r.Status = mqutil.Failed
+		r.Error = mqutil.ErrorMessage(t.err)
+		r.ErrorCategory = "unknown"
+		if e, ok := t.err.(mqutil.Error); ok {
+			r.ErrorCategory = mqutil.ErrTypeNames[e.Type()]
+		}
+	}
+	if len(t.skipReason) > 0 {
+		r.Status = mqutil.Skipped
+		r.SkipReason = t.skipReason
+	}
+	if t.schemaError != nil {
+		r.SchemaMismatch = mqutil.ErrorMessage(t.schemaError)
+	}
+	r.Assertions = t.assertions
+	r.Attempts = t.Attempts
+	return r
+}
+
+// GetRunSummary returns the result counts and the result of every test that was run or skipped.
+func (plan *TestPlan) GetRunSummary() *RunSummary {
+	summary := &RunSummary{Counts: plan.ResultCounts, Results: []*TestResult{}}
+	for _, t := range plan.resultList {
+		summary.Results = append(summary.Results, t.toResult())
+	}
+	return summary
+}
+
+// WriteJSONSummaryToFile writes the run summary to the file in JSON.
+func (plan *TestPlan) WriteJSONSummaryToFile(path string) error {
+	summaryBytes, err := json.MarshalIndent(plan.GetRunSummary(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(mqutil.MaskSecrets(string(summaryBytes))), 0644)
+}
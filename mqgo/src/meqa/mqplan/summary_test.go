@@ -0,0 +1,58 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"meqa/mqutil"
+)
+
+func TestWriteJSONSummary(t *testing.T) {
+	plan := runReportPlan(t)
+	dir, err := ioutil.TempDir("", "meqa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "summary.json")
+	if err = plan.WriteJSONSummaryToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := &RunSummary{}
+	if err = json.Unmarshal(data, summary); err != nil {
+		t.Fatalf("invalid JSON summary: %s\n%s", err.Error(), string(data))
+	}
+
+	counts := summary.Counts
+	if counts[mqutil.Total] != 3 || counts[mqutil.Passed] != 1 || counts[mqutil.Failed] != 1 || counts[mqutil.Skipped] != 1 {
+		t.Errorf("unexpected counts: %v", counts)
+	}
+	if len(summary.Results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(summary.Results))
+	}
+	results := make(map[string]*TestResult)
+	for _, r := range summary.Results {
+		results[r.Name] = r
+		if r.Suite != "pets" || r.Method != "get" || r.Path != "/pet/findByStatus" {
+			t.Errorf("unexpected result: %+v", r)
+		}
+	}
+	if r := results["find"]; r.Status != mqutil.Passed || r.StatusCode != 200 || len(r.URL) == 0 || len(r.Error) > 0 {
+		t.Errorf("find: unexpected result %+v", r)
+	}
+	if r := results["leftOut"]; r.Status != mqutil.Skipped || r.SkipReason != skippedByFilters || r.StatusCode != 0 {
+		t.Errorf("leftOut: unexpected result %+v", r)
+	}
+	r := results["wrongStatus"]
+	if r.Status != mqutil.Failed || r.StatusCode != 200 || len(r.Error) == 0 ||
+		r.ErrorCategory != mqutil.ErrTypeNames[mqutil.ErrExpect] {
+		t.Errorf("wrongStatus: unexpected result %+v", r)
+	}
+}
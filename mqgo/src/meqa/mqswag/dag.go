@@ -204,7 +204,7 @@ type DAGIterFunc func(previous *DAGNode, current *DAGNode) error
 
 func (dag *DAG) IterateWeight(weight int, f DAGIterFunc) error {
 	if weight >= DAGDepth {
-		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid weight to iterate", weight))
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid weight to iterate: %d", weight))
 	}
 	l := dag.WeightList[weight]
 	for _, n := range l {
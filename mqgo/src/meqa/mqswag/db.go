@@ -432,6 +432,8 @@ func (db *DB) Init(s *Swagger) {
 
 // Clone the db but not the objects
 func (db *DB) CloneSchema() *DB {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
 	schemas := make(map[string]*SchemaDB)
 	for k, v := range db.schemas {
 		schemas[k] = v.CloneSchema()
@@ -0,0 +1,81 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"meqa/mqutil"
+
+	"github.com/go-openapi/spec"
+)
+
+const dbSwagger = `{
+  "swagger": "2.0",
+  "paths": {},
+  "definitions": {
+    "Pet": {"type": "object", "properties": {"id": {"type": "integer"}, "name": {"type": "string"}}},
+    "Order": {"type": "object", "properties": {"id": {"type": "integer"}, "petId": {"type": "integer"}}}
+  }
+}`
+
+func newTestDB(t *testing.T) *DB {
+	swagger := &Swagger{}
+	if err := json.Unmarshal([]byte(dbSwagger), (*spec.Swagger)(swagger)); err != nil {
+		t.Fatal(err)
+	}
+	db := &DB{}
+	db.Init(swagger)
+	return db
+}
+
+func TestDBCloneSchema(t *testing.T) {
+	db := newTestDB(t)
+	db.Insert("Pet", map[string]interface{}{"id": 1, "name": "doggie"}, nil)
+	clone := db.CloneSchema()
+	if clone.GetSchema("Pet") == nil || clone.GetSchema("Order") == nil || clone.Swagger != db.Swagger {
+		t.Fatal("expected the clone to have the schemas")
+	}
+	if found := clone.Find("Pet", nil, nil, MatchAlways, -1); len(found) != 0 {
+		t.Errorf("expected the clone to have no objects, got %v", found)
+	}
+	clone.Insert("Pet", map[string]interface{}{"id": 2, "name": "kitty"}, nil)
+	if found := db.Find("Pet", nil, nil, MatchAlways, -1); len(found) != 1 {
+		t.Errorf("expected the objects of the clone to stay in the clone, got %v", found)
+	}
+}
+
+func TestDBConcurrent(t *testing.T) {
+	// The suites run in parallel clone the shared DB while the others write to it. Run with -race.
+	db := newTestDB(t)
+	const workers = 8
+	const objects = 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < objects; i++ {
+				id := w*objects + i
+				db.Insert("Pet", map[string]interface{}{"id": id, "name": "doggie"}, nil)
+				db.Update("Pet", map[string]interface{}{"id": id}, nil, mqutil.InterfaceEquals,
+					map[string]interface{}{"name": "kitty"}, 1, true)
+				local := db.CloneSchema()
+				local.Insert("Order", map[string]interface{}{"id": id, "petId": id}, nil)
+				db.Find("Pet", nil, nil, MatchAlways, -1)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	found := db.Find("Pet", map[string]interface{}{"name": "kitty"}, nil, mqutil.InterfaceEquals, -1)
+	if len(found) != workers*objects {
+		t.Errorf("expected %d pets, got %d", workers*objects, len(found))
+	}
+	if orders := db.Find("Order", nil, nil, MatchAlways, -1); len(orders) != 0 {
+		t.Errorf("expected the orders to be in the clones only, got %d", len(orders))
+	}
+	if deleted := db.Delete("Pet", nil, nil, MatchAlways, -1); deleted != workers*objects {
+		t.Errorf("expected %d pets deleted, got %d", workers*objects, deleted)
+	}
+}
@@ -0,0 +1,609 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"fmt"
+	"meqa/mqutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// This file loads OpenAPI 3.0 documents. The rest of meqa works on the swagger 2.0 object model, so
+// the 3.0 constructs (components, requestBody, content maps, servers) are mapped onto their 2.0
+// equivalents when loading. Schemas are JSON schema in both versions and are used as is.
+
+const (
+	openAPI3SchemaPrefix = "#/components/schemas/"
+	swaggerSchemaPrefix  = "#/definitions/"
+
+	mediaForm      = "application/x-www-form-urlencoded"
+	mediaMultipart = "multipart/form-data"
+)
+
+// Extension we put on security definitions converted from OpenAPI 3.0 "http" schemes that
+// don't exist in swagger 2.0 (e.g. bearer).
+const ExtHttpScheme = "x-http-scheme"
+
+type openAPI3Server struct {
+	URL       string `json:"url"`
+	Variables map[string]struct {
+		Default string `json:"default"`
+	} `json:"variables"`
+}
+
+type openAPI3MediaType struct {
+	Schema *spec.Schema `json:"schema"`
+}
+
+type openAPI3Parameter struct {
+	Ref             string       `json:"$ref"`
+	Name            string       `json:"name"`
+	In              string       `json:"in"`
+	Description     string       `json:"description"`
+	Required        bool         `json:"required"`
+	AllowEmptyValue bool         `json:"allowEmptyValue"`
+	Style           string       `json:"style"`
+	Explode         *bool        `json:"explode"`
+	Schema          *spec.Schema `json:"schema"`
+}
+
+type openAPI3RequestBody struct {
+	Ref         string                       `json:"$ref"`
+	Description string                       `json:"description"`
+	Required    bool                         `json:"required"`
+	Content     map[string]openAPI3MediaType `json:"content"`
+}
+
+type openAPI3Response struct {
+	Ref         string                       `json:"$ref"`
+	Description string                       `json:"description"`
+	Content     map[string]openAPI3MediaType `json:"content"`
+}
+
+type openAPI3OAuthFlow struct {
+	AuthorizationURL string            `json:"authorizationUrl"`
+	TokenURL         string            `json:"tokenUrl"`
+	Scopes           map[string]string `json:"scopes"`
+}
+
+type openAPI3SecurityScheme struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Scheme      string `json:"scheme"`
+	Flows       struct {
+		Implicit          *openAPI3OAuthFlow `json:"implicit"`
+		Password          *openAPI3OAuthFlow `json:"password"`
+		ClientCredentials *openAPI3OAuthFlow `json:"clientCredentials"`
+		AuthorizationCode *openAPI3OAuthFlow `json:"authorizationCode"`
+	} `json:"flows"`
+}
+
+type openAPI3Operation struct {
+	Tags        []string                    `json:"tags"`
+	Summary     string                      `json:"summary"`
+	Description string                      `json:"description"`
+	OperationID string                      `json:"operationId"`
+	Deprecated  bool                        `json:"deprecated"`
+	Parameters  []openAPI3Parameter         `json:"parameters"`
+	RequestBody *openAPI3RequestBody        `json:"requestBody"`
+	Responses   map[string]openAPI3Response `json:"responses"`
+	Security    []map[string][]string       `json:"security"`
+}
+
+type openAPI3PathItem struct {
+	Parameters []openAPI3Parameter `json:"parameters"`
+	Get        *openAPI3Operation  `json:"get"`
+	Put        *openAPI3Operation  `json:"put"`
+	Post       *openAPI3Operation  `json:"post"`
+	Delete     *openAPI3Operation  `json:"delete"`
+	Options    *openAPI3Operation  `json:"options"`
+	Head       *openAPI3Operation  `json:"head"`
+	Patch      *openAPI3Operation  `json:"patch"`
+}
+
+type openAPI3 struct {
+	OpenAPI    string                      `json:"openapi"`
+	Info       *spec.Info                  `json:"info"`
+	Servers    []openAPI3Server            `json:"servers"`
+	Paths      map[string]openAPI3PathItem `json:"paths"`
+	Security   []map[string][]string       `json:"security"`
+	Tags       []spec.Tag                  `json:"tags"`
+	Components struct {
+		Schemas         map[string]spec.Schema            `json:"schemas"`
+		Parameters      map[string]openAPI3Parameter      `json:"parameters"`
+		RequestBodies   map[string]openAPI3RequestBody    `json:"requestBodies"`
+		Responses       map[string]openAPI3Response       `json:"responses"`
+		SecuritySchemes map[string]openAPI3SecurityScheme `json:"securitySchemes"`
+	} `json:"components"`
+}
+
+// IsOpenAPI3 checks whether the json document is an OpenAPI 3.x spec.
+func IsOpenAPI3(jsonBytes []byte) bool {
+	var header struct {
+		OpenAPI string `json:"openapi"`
+	}
+	err := json.Unmarshal(jsonBytes, &header)
+	return err == nil && strings.HasPrefix(header.OpenAPI, "3.")
+}
+
+// rewriteSchemaRefs points all the #/components/schemas refs to #/definitions, which is where
+// the schemas live after the conversion.
+func rewriteSchemaRefs(obj interface{}) {
+	callback := func(m map[string]interface{}) error {
+		if ref, ok := m["$ref"].(string); ok && strings.HasPrefix(ref, openAPI3SchemaPrefix) {
+			m["$ref"] = swaggerSchemaPrefix + strings.TrimPrefix(ref, openAPI3SchemaPrefix)
+		}
+		return nil
+	}
+	mqutil.IterateMapsInInterface(obj, callback)
+}
+
+// refName returns the last element of a local ref like #/components/parameters/limit.
+func refName(ref string, prefix string) (string, error) {
+	if !strings.HasPrefix(ref, prefix) {
+		return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Invalid reference: %s", ref))
+	}
+	return strings.TrimPrefix(ref, prefix), nil
+}
+
+// sortedMediaTypes returns the media types in content, with json first so that it's preferred
+// when an operation supports several.
+func sortedMediaTypes(content map[string]openAPI3MediaType) []string {
+	var mediaTypes []string
+	for k := range content {
+		mediaTypes = append(mediaTypes, k)
+	}
+	sort.Slice(mediaTypes, func(i, j int) bool {
+		ji := strings.Contains(mediaTypes[i], "json")
+		jj := strings.Contains(mediaTypes[j], "json")
+		return (ji && !jj) || (ji == jj && mediaTypes[i] < mediaTypes[j])
+	})
+	return mediaTypes
+}
+
+// CreateSwaggerFromOpenAPI3 creates the swagger object from an OpenAPI 3.0 json document.
+func CreateSwaggerFromOpenAPI3(jsonBytes []byte) (*Swagger, error) {
+	var raw interface{}
+	err := json.Unmarshal(jsonBytes, &raw)
+	if err != nil {
+		return nil, err
+	}
+	rewriteSchemaRefs(raw)
+	jsonBytes, err = json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	doc := &openAPI3{}
+	err = json.Unmarshal(jsonBytes, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	swagger := &spec.Swagger{}
+	swagger.Swagger = "2.0"
+	swagger.Info = doc.Info
+	swagger.Tags = doc.Tags
+	swagger.Security = doc.Security
+	swagger.Definitions = doc.Components.Schemas
+	if swagger.Definitions == nil {
+		swagger.Definitions = make(spec.Definitions)
+	}
+	err = doc.setServers(swagger)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(doc.Components.SecuritySchemes) > 0 {
+		swagger.SecurityDefinitions = make(spec.SecurityDefinitions)
+		for name, s := range doc.Components.SecuritySchemes {
+			if scheme := s.toSwagger(); scheme != nil {
+				swagger.SecurityDefinitions[name] = scheme
+			}
+		}
+	}
+
+	swagger.Paths = &spec.Paths{Paths: make(map[string]spec.PathItem)}
+	for pathName, item := range doc.Paths {
+		pathItem := spec.PathItem{}
+		pathItem.Parameters, err = doc.convertParameters(item.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		ops := map[string]*openAPI3Operation{
+			MethodGet: item.Get, MethodPut: item.Put, MethodPost: item.Post, MethodDelete: item.Delete,
+			MethodOptions: item.Options, MethodHead: item.Head, MethodPatch: item.Patch,
+		}
+		for method, o := range ops {
+			if o == nil {
+				continue
+			}
+			op, err := doc.convertOperation(o)
+			if err != nil {
+				return nil, err
+			}
+			switch method {
+			case MethodGet:
+				pathItem.Get = op
+			case MethodPut:
+				pathItem.Put = op
+			case MethodPost:
+				pathItem.Post = op
+			case MethodDelete:
+				pathItem.Delete = op
+			case MethodOptions:
+				pathItem.Options = op
+			case MethodHead:
+				pathItem.Head = op
+			case MethodPatch:
+				pathItem.Patch = op
+			}
+		}
+		swagger.Paths.Paths[pathName] = pathItem
+	}
+
+	return (*Swagger)(swagger), nil
+}
+
+// setServers maps the first server entry to swagger's schemes, host and basePath. The other servers
+// on the same host only contribute their schemes.
+func (doc *openAPI3) setServers(swagger *spec.Swagger) error {
+	var host string
+	for i, server := range doc.Servers {
+		serverURL := server.URL
+		for name, v := range server.Variables {
+			serverURL = strings.Replace(serverURL, "{"+name+"}", v.Default, -1)
+		}
+		u, err := url.Parse(serverURL)
+		if err != nil {
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Invalid server url: %s", server.URL))
+		}
+		if i == 0 {
+			host = u.Host
+			swagger.Host = u.Host
+			swagger.BasePath = strings.TrimSuffix(u.Path, "/")
+		} else if u.Host != host {
+			continue
+		}
+		if len(u.Scheme) > 0 {
+			swagger.Schemes = append(swagger.Schemes, u.Scheme)
+		}
+	}
+	return nil
+}
+
+func (doc *openAPI3) convertOperation(o *openAPI3Operation) (*spec.Operation, error) {
+	op := &spec.Operation{}
+	op.Tags = o.Tags
+	op.Summary = o.Summary
+	op.Description = o.Description
+	op.ID = o.OperationID
+	op.Deprecated = o.Deprecated
+	op.Security = o.Security
+
+	var err error
+	op.Parameters, err = doc.convertParameters(o.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	if o.RequestBody != nil {
+		bodyParams, consumes, err := doc.convertRequestBody(o.RequestBody)
+		if err != nil {
+			return nil, err
+		}
+		op.Parameters = append(op.Parameters, bodyParams...)
+		op.Consumes = consumes
+	}
+
+	if len(o.Responses) > 0 {
+		op.Responses = &spec.Responses{}
+		op.Responses.StatusCodeResponses = make(map[int]spec.Response)
+		produces := make(map[string]bool)
+		// Sort the codes so that an explicit code always wins over a range like 2XX.
+		var codes []string
+		for code := range o.Responses {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			resp, mediaTypes, err := doc.convertResponse(o.Responses[code])
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range mediaTypes {
+				produces[m] = true
+			}
+			if code == "default" {
+				op.Responses.Default = resp
+				continue
+			}
+			status, err := strconv.Atoi(code)
+			if err != nil {
+				// Ranges like 2XX. Use the first code in the range if it's not specified explicitly.
+				if len(code) != 3 || (code[1] != 'X' && code[1] != 'x') {
+					mqutil.Logger.Printf("unrecognized response code %s", code)
+					continue
+				}
+				status = int(code[0]-'0') * 100
+				if _, exist := op.Responses.StatusCodeResponses[status]; exist {
+					continue
+				}
+			}
+			op.Responses.StatusCodeResponses[status] = *resp
+		}
+		for m := range produces {
+			op.Produces = append(op.Produces, m)
+		}
+		sort.Strings(op.Produces)
+	}
+	return op, nil
+}
+
+func (doc *openAPI3) convertParameters(params []openAPI3Parameter) ([]spec.Parameter, error) {
+	var result []spec.Parameter
+	for _, p := range params {
+		if len(p.Ref) > 0 {
+			name, err := refName(p.Ref, "#/components/parameters/")
+			if err != nil {
+				return nil, err
+			}
+			referred, ok := doc.Components.Parameters[name]
+			if !ok {
+				return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Reference object not found: %s", p.Ref))
+			}
+			p = referred
+		}
+		if p.In == "cookie" {
+			mqutil.Logger.Printf("cookie parameter %s is not supported, skipping", p.Name)
+			continue
+		}
+		param := spec.Parameter{}
+		param.Name = p.Name
+		param.In = p.In
+		param.Description = p.Description
+		param.Required = p.Required
+		param.AllowEmptyValue = p.AllowEmptyValue
+		if p.Schema != nil && GetMeqaTag(param.Description) == nil {
+			if tag := GetMeqaTag(p.Schema.Description); tag != nil {
+				param.Description = strings.TrimSpace(param.Description + " " + tag.ToString())
+			}
+		}
+		setSimpleSchema(&param, doc.primitiveSchema(p.Schema))
+		if param.Type == gojsonschema.TYPE_ARRAY {
+			param.CollectionFormat = collectionFormat(p.Style, p.Explode)
+		}
+		result = append(result, param)
+	}
+	return result, nil
+}
+
+// primitiveSchema follows the ref of a parameter schema if it points to a primitive type, so that
+// it can be turned into a simple schema.
+func (doc *openAPI3) primitiveSchema(schema *spec.Schema) *spec.Schema {
+	if schema == nil || schema.Ref.GetURL() == nil {
+		return schema
+	}
+	name, err := refName(schema.Ref.String(), swaggerSchemaPrefix)
+	if err != nil {
+		return schema
+	}
+	referred, ok := doc.Components.Schemas[name]
+	if !ok || len(referred.Type) == 0 || referred.Type.Contains(gojsonschema.TYPE_OBJECT) || referred.Type.Contains(gojsonschema.TYPE_ARRAY) {
+		return schema
+	}
+	return &referred
+}
+
+// setSimpleSchema sets the swagger 2.0 style type and validations on a non-body parameter. Schemas
+// that aren't primitive types (refs and objects) are kept as the parameter's schema.
+func setSimpleSchema(param *spec.Parameter, schema *spec.Schema) {
+	if schema == nil {
+		param.Type = gojsonschema.TYPE_STRING
+		return
+	}
+	if schema.Ref.GetURL() != nil || len(schema.AllOf) > 0 || len(schema.Type) == 0 || schema.Type.Contains(gojsonschema.TYPE_OBJECT) {
+		param.Schema = schema
+		return
+	}
+	param.Type = schema.Type[0]
+	param.Format = schema.Format
+	param.Default = schema.Default
+	param.CommonValidations = commonValidations(schema)
+	if schema.Type.Contains(gojsonschema.TYPE_ARRAY) && schema.Items != nil && schema.Items.Schema != nil {
+		itemSchema := schema.Items.Schema
+		if len(itemSchema.Type) == 0 || itemSchema.Ref.GetURL() != nil {
+			// Arrays of complex types can't be represented in a simple schema.
+			param.Type = ""
+			param.Format = ""
+			param.CommonValidations = spec.CommonValidations{}
+			param.Schema = schema
+			return
+		}
+		items := &spec.Items{}
+		items.Type = itemSchema.Type[0]
+		items.Format = itemSchema.Format
+		items.CommonValidations = commonValidations(itemSchema)
+		param.Items = items
+	}
+}
+
+func commonValidations(s *spec.Schema) spec.CommonValidations {
+	v := spec.CommonValidations{}
+	v.Maximum = s.Maximum
+	v.ExclusiveMaximum = s.ExclusiveMaximum
+	v.Minimum = s.Minimum
+	v.ExclusiveMinimum = s.ExclusiveMinimum
+	v.MaxLength = s.MaxLength
+	v.MinLength = s.MinLength
+	v.Pattern = s.Pattern
+	v.MaxItems = s.MaxItems
+	v.MinItems = s.MinItems
+	v.UniqueItems = s.UniqueItems
+	v.MultipleOf = s.MultipleOf
+	v.Enum = s.Enum
+	return v
+}
+
+// collectionFormat maps the 3.0 style/explode on an array query parameter to swagger 2.0 collectionFormat.
+func collectionFormat(style string, explode *bool) string {
+	switch style {
+	case "spaceDelimited":
+		return "ssv"
+	case "pipeDelimited":
+		return "pipes"
+	case "", "form":
+		if explode == nil || *explode {
+			return "multi"
+		}
+	}
+	return "csv"
+}
+
+// convertRequestBody turns the request body into either a body parameter or a list of formData
+// parameters. It also returns the media types the body can be sent as.
+func (doc *openAPI3) convertRequestBody(body *openAPI3RequestBody) ([]spec.Parameter, []string, error) {
+	if len(body.Ref) > 0 {
+		name, err := refName(body.Ref, "#/components/requestBodies/")
+		if err != nil {
+			return nil, nil, err
+		}
+		referred, ok := doc.Components.RequestBodies[name]
+		if !ok {
+			return nil, nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Reference object not found: %s", body.Ref))
+		}
+		body = &referred
+	}
+	mediaTypes := sortedMediaTypes(body.Content)
+	if len(mediaTypes) == 0 {
+		return nil, nil, nil
+	}
+	media := mediaTypes[0]
+	schema := body.Content[media].Schema
+
+	if (media == mediaForm || media == mediaMultipart) && schema != nil {
+		formSchema := schema
+		if schema.Ref.GetURL() != nil {
+			name, err := refName(schema.Ref.String(), swaggerSchemaPrefix)
+			if err != nil {
+				return nil, nil, err
+			}
+			referred, ok := doc.Components.Schemas[name]
+			if !ok {
+				return nil, nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Reference object not found: %s", schema.Ref.String()))
+			}
+			formSchema = &referred
+		}
+		required := make(map[string]bool)
+		for _, r := range formSchema.Required {
+			required[r] = true
+		}
+		var names []string
+		for name := range formSchema.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var params []spec.Parameter
+		for _, name := range names {
+			propSchema := formSchema.Properties[name]
+			param := spec.Parameter{}
+			param.Name = name
+			param.In = "formData"
+			param.Description = propSchema.Description
+			param.Required = required[name]
+			setSimpleSchema(&param, &propSchema)
+			if param.Type == gojsonschema.TYPE_STRING && (param.Format == "binary" || param.Format == "base64") {
+				param.Type = "file"
+				param.Format = ""
+			}
+			params = append(params, param)
+		}
+		return params, mediaTypes, nil
+	}
+
+	param := spec.Parameter{}
+	param.Name = "body"
+	param.In = "body"
+	param.Description = body.Description
+	param.Required = body.Required
+	param.Schema = schema
+	if param.Schema == nil {
+		param.Schema = &spec.Schema{}
+	}
+	return []spec.Parameter{param}, mediaTypes, nil
+}
+
+func (doc *openAPI3) convertResponse(r openAPI3Response) (*spec.Response, []string, error) {
+	if len(r.Ref) > 0 {
+		name, err := refName(r.Ref, "#/components/responses/")
+		if err != nil {
+			return nil, nil, err
+		}
+		referred, ok := doc.Components.Responses[name]
+		if !ok {
+			return nil, nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Reference object not found: %s", r.Ref))
+		}
+		r = referred
+	}
+	resp := &spec.Response{}
+	resp.Description = r.Description
+	mediaTypes := sortedMediaTypes(r.Content)
+	if len(mediaTypes) > 0 {
+		resp.Schema = r.Content[mediaTypes[0]].Schema
+	}
+	return resp, mediaTypes, nil
+}
+
+func (s *openAPI3SecurityScheme) toSwagger() *spec.SecurityScheme {
+	scheme := &spec.SecurityScheme{}
+	scheme.Description = s.Description
+	switch s.Type {
+	case "apiKey":
+		if s.In == "cookie" {
+			mqutil.Logger.Printf("cookie api key %s is not supported, skipping", s.Name)
+			return nil
+		}
+		scheme.Type = "apiKey"
+		scheme.Name = s.Name
+		scheme.In = s.In
+	case "http":
+		if strings.ToLower(s.Scheme) == "basic" {
+			scheme.Type = "basic"
+		} else {
+			// swagger 2.0 doesn't have bearer tokens. They are sent as the Authorization header.
+			scheme.Type = "apiKey"
+			scheme.Name = "Authorization"
+			scheme.In = "header"
+			scheme.AddExtension(ExtHttpScheme, strings.ToLower(s.Scheme))
+		}
+	case "oauth2":
+		scheme.Type = "oauth2"
+		flows := []struct {
+			name string
+			flow *openAPI3OAuthFlow
+		}{
+			{"application", s.Flows.ClientCredentials},
+			{"password", s.Flows.Password},
+			{"accessCode", s.Flows.AuthorizationCode},
+			{"implicit", s.Flows.Implicit},
+		}
+		for _, f := range flows {
+			if f.flow != nil {
+				scheme.Flow = f.name
+				scheme.AuthorizationURL = f.flow.AuthorizationURL
+				scheme.TokenURL = f.flow.TokenURL
+				scheme.Scopes = f.flow.Scopes
+				break
+			}
+		}
+	default:
+		mqutil.Logger.Printf("security scheme type %s is not supported, skipping", s.Type)
+		return nil
+	}
+	return scheme
+}
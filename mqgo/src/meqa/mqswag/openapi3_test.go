@@ -0,0 +1,265 @@
+package mqswag
+
+import (
+	"testing"
+
+	"meqa/mqutil"
+
+	"github.com/go-openapi/spec"
+)
+
+const openAPI3Doc = `{
+  "openapi": "3.0.0",
+  "info": {"title": "pets", "version": "1.0"},
+  "servers": [
+    {"url": "{scheme}://api.example.com/v1/", "variables": {"scheme": {"default": "https"}}},
+    {"url": "http://api.example.com/v1"},
+    {"url": "ftp://other.example.com/v1"}
+  ],
+  "paths": {
+    "/pets": {
+      "get": {
+        "operationId": "listPets",
+        "parameters": [
+          {"$ref": "#/components/parameters/limit"},
+          {"name": "tags", "in": "query", "style": "form", "explode": false,
+           "schema": {"type": "array", "items": {"type": "string"}}},
+          {"name": "status", "in": "query", "schema": {"$ref": "#/components/schemas/Status"}},
+          {"name": "session", "in": "cookie", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "pets", "content": {"application/json": {
+            "schema": {"type": "array", "items": {"$ref": "#/components/schemas/Pet"}}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "operationId": "addPet",
+        "requestBody": {"required": true, "content": {
+          "application/xml": {"schema": {"$ref": "#/components/schemas/Pet"}},
+          "application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}
+        }},
+        "responses": {
+          "2XX": {"description": "created", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}},
+          "200": {"description": "ok"}
+        }
+      }
+    },
+    "/pets/{petId}/image": {
+      "parameters": [{"name": "petId", "in": "path", "required": true, "schema": {"type": "integer", "format": "int64"}}],
+      "post": {
+        "requestBody": {"content": {"multipart/form-data": {"schema": {
+          "type": "object",
+          "required": ["file"],
+          "properties": {"file": {"type": "string", "format": "binary"}, "note": {"type": "string"}}
+        }}}},
+        "responses": {"2XX": {"description": "uploaded"}}
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Status": {"type": "string", "enum": ["available", "sold"]},
+      "Category": {"type": "object", "properties": {"id": {"type": "integer"}}},
+      "Pet": {"type": "object", "properties": {
+        "id": {"type": "integer", "description": "<meqa Pet.id>"},
+        "category": {"$ref": "#/components/schemas/Category"}
+      }}
+    },
+    "parameters": {
+      "limit": {"name": "limit", "in": "query", "schema": {"type": "integer", "maximum": 100}}
+    },
+    "responses": {
+      "Error": {"description": "error", "content": {"application/json": {"schema": {"type": "object"}}}}
+    },
+    "securitySchemes": {
+      "bearer": {"type": "http", "scheme": "Bearer"},
+      "basic": {"type": "http", "scheme": "basic"},
+      "session": {"type": "apiKey", "in": "cookie", "name": "session"},
+      "oauth": {"type": "oauth2", "flows": {
+        "implicit": {"authorizationUrl": "https://example.com/auth"},
+        "clientCredentials": {"tokenUrl": "https://example.com/token", "scopes": {"read": "read"}}
+      }}
+    }
+  }
+}`
+
+func findParam(params []spec.Parameter, name string) *spec.Parameter {
+	for i := range params {
+		if params[i].Name == name {
+			return &params[i]
+		}
+	}
+	return nil
+}
+
+func TestIsOpenAPI3(t *testing.T) {
+	cases := map[string]bool{
+		`{"openapi": "3.0.1"}`:  true,
+		`{"openapi": "3.1.0"}`:  true,
+		`{"swagger": "2.0"}`:    false,
+		`{"openapi": "2.0"}`:    false,
+		`not json`:              false,
+		`{"openapi": 3}`:        false,
+		`{"openapi": "3.0.0"} `: true,
+	}
+	for doc, expected := range cases {
+		if IsOpenAPI3([]byte(doc)) != expected {
+			t.Errorf("%s: expected %v", doc, expected)
+		}
+	}
+}
+
+func TestCreateSwaggerFromOpenAPI3(t *testing.T) {
+	mqutil.Logger = mqutil.NewStdLogger()
+	swagger, err := CreateSwaggerFromOpenAPI3([]byte(openAPI3Doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the servers on the host of the first one count.
+	if swagger.Host != "api.example.com" || swagger.BasePath != "/v1" {
+		t.Errorf("unexpected host and base path: %s %s", swagger.Host, swagger.BasePath)
+	}
+	if len(swagger.Schemes) != 2 || swagger.Schemes[0] != "https" || swagger.Schemes[1] != "http" {
+		t.Errorf("unexpected schemes: %v", swagger.Schemes)
+	}
+
+	// The schemas are the definitions, and the refs point to them.
+	if len(swagger.Definitions) != 3 {
+		t.Errorf("unexpected definitions: %v", swagger.Definitions)
+	}
+	category := swagger.Definitions["Pet"].Properties["category"]
+	if ref := category.Ref.String(); ref != "#/definitions/Category" {
+		t.Errorf("unexpected ref %s", ref)
+	}
+
+	list := swagger.Paths.Paths["/pets"].Get
+	if list == nil || list.ID != "listPets" {
+		t.Fatal("get /pets is missing")
+	}
+	if len(list.Parameters) != 3 || findParam(list.Parameters, "session") != nil {
+		t.Errorf("expected the cookie parameter to be skipped: %v", list.Parameters)
+	}
+	if limit := findParam(list.Parameters, "limit"); limit == nil || limit.Type != "integer" || *limit.Maximum != 100 {
+		t.Errorf("unexpected limit parameter %v", limit)
+	}
+	if tags := findParam(list.Parameters, "tags"); tags == nil || tags.Type != "array" || tags.Items.Type != "string" ||
+		tags.CollectionFormat != "csv" {
+		t.Errorf("unexpected tags parameter %v", tags)
+	}
+	// Refs to primitive schemas are followed, parameters don't have schemas in swagger 2.0.
+	if status := findParam(list.Parameters, "status"); status == nil || status.Type != "string" || len(status.Enum) != 2 {
+		t.Errorf("unexpected status parameter %v", status)
+	}
+	if resp, ok := list.Responses.StatusCodeResponses[200]; !ok || resp.Schema.Items.Schema.Ref.String() != "#/definitions/Pet" {
+		t.Errorf("unexpected 200 response %v", resp)
+	}
+	if list.Responses.Default == nil || list.Responses.Default.Description != "error" {
+		t.Errorf("unexpected default response %v", list.Responses.Default)
+	}
+
+	// The request body is the body parameter, json is preferred.
+	add := swagger.Paths.Paths["/pets"].Post
+	if len(add.Parameters) != 1 || add.Parameters[0].In != "body" || !add.Parameters[0].Required ||
+		add.Parameters[0].Schema.Ref.String() != "#/definitions/Pet" {
+		t.Errorf("unexpected body parameter %v", add.Parameters)
+	}
+	if len(add.Consumes) != 2 || add.Consumes[0] != "application/json" {
+		t.Errorf("unexpected consumes %v", add.Consumes)
+	}
+	// The explicit code wins over the range.
+	if len(add.Responses.StatusCodeResponses) != 1 || add.Responses.StatusCodeResponses[200].Description != "ok" {
+		t.Errorf("unexpected responses %v", add.Responses.StatusCodeResponses)
+	}
+
+	// The form is the formData parameters, binary strings are files.
+	image := swagger.Paths.Paths["/pets/{petId}/image"]
+	if len(image.Parameters) != 1 || image.Parameters[0].Type != "integer" || image.Parameters[0].Format != "int64" {
+		t.Errorf("unexpected path parameters %v", image.Parameters)
+	}
+	upload := image.Post
+	file := findParam(upload.Parameters, "file")
+	if file == nil || file.In != "formData" || file.Type != "file" || !file.Required {
+		t.Errorf("unexpected file parameter %v", file)
+	}
+	if note := findParam(upload.Parameters, "note"); note == nil || note.Type != "string" || note.Required {
+		t.Errorf("unexpected note parameter %v", note)
+	}
+	if resp := upload.Responses.StatusCodeResponses[200]; resp.Description != "uploaded" {
+		t.Errorf("expected the 2XX response to be the 200 response, got %v", upload.Responses.StatusCodeResponses)
+	}
+	if len(upload.Consumes) != 1 || upload.Consumes[0] != "multipart/form-data" {
+		t.Errorf("unexpected consumes %v", upload.Consumes)
+	}
+
+	security := swagger.SecurityDefinitions
+	if len(security) != 3 || security["session"] != nil {
+		t.Errorf("expected the cookie api key to be skipped: %v", security)
+	}
+	if bearer := security["bearer"]; bearer == nil || bearer.Type != "apiKey" || bearer.Name != "Authorization" ||
+		bearer.In != "header" || bearer.Extensions[ExtHttpScheme] != "bearer" {
+		t.Errorf("unexpected bearer scheme %v", bearer)
+	}
+	if basic := security["basic"]; basic == nil || basic.Type != "basic" {
+		t.Errorf("unexpected basic scheme %v", basic)
+	}
+	if oauth := security["oauth"]; oauth == nil || oauth.Flow != "application" || oauth.TokenURL != "https://example.com/token" {
+		t.Errorf("unexpected oauth scheme %v", oauth)
+	}
+}
+
+func TestCreateSwaggerFromOpenAPI3Errors(t *testing.T) {
+	docs := []string{
+		`{"openapi": "3.0.0", "paths": {"/pets": {"get": {"parameters": [{"$ref": "#/components/parameters/missing"}]}}}}`,
+		`{"openapi": "3.0.0", "paths": {"/pets": {"get": {"parameters": [{"$ref": "other.yml#/limit"}]}}}}`,
+		`{"openapi": "3.0.0", "paths": {"/pets": {"post": {"requestBody": {"$ref": "#/components/requestBodies/missing"}}}}}`,
+		`{"openapi": "3.0.0", "paths": {"/pets": {"get": {"responses": {"200": {"$ref": "#/components/responses/missing"}}}}}}`,
+		`{"openapi": "3.0.0", "servers": [{"url": "http://[::1"}]}`,
+		`{"openapi": "3.0.0"`,
+	}
+	for _, doc := range docs {
+		if _, err := CreateSwaggerFromOpenAPI3([]byte(doc)); err == nil {
+			t.Errorf("expected an error for %s", doc)
+		}
+	}
+}
+
+func TestCollectionFormat(t *testing.T) {
+	explode := true
+	noExplode := false
+	cases := []struct {
+		style   string
+		explode *bool
+		format  string
+	}{
+		{"", nil, "multi"},
+		{"form", &explode, "multi"},
+		{"form", &noExplode, "csv"},
+		{"spaceDelimited", nil, "ssv"},
+		{"pipeDelimited", nil, "pipes"},
+		{"simple", nil, "csv"},
+	}
+	for _, c := range cases {
+		if format := collectionFormat(c.style, c.explode); format != c.format {
+			t.Errorf("%s: expected %s, got %s", c.style, c.format, format)
+		}
+	}
+}
+
+func TestGetReferredSchemaComponents(t *testing.T) {
+	swagger, err := CreateSwaggerFromOpenAPI3([]byte(openAPI3Doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"#/components/schemas/Category", "#/definitions/Category"} {
+		schema := spec.RefSchema(ref)
+		name, referred, err := swagger.GetReferredSchema((*Schema)(schema))
+		if err != nil || name != "Category" || referred == nil {
+			t.Errorf("%s: unexpected result %s %v %v", ref, name, referred, err)
+		}
+	}
+	if _, _, err := swagger.GetReferredSchema((*Schema)(spec.RefSchema("#/components/parameters/limit"))); err == nil {
+		t.Error("expected an error for a ref that's not a schema")
+	}
+}
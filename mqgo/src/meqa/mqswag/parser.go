@@ -55,11 +55,19 @@ func (t *MeqaTag) Equals(o *MeqaTag) bool {
 
 func (t *MeqaTag) ToString() string {
 	str := "<meqa " + t.Class
-	if len(t.Property) > 0 {
+	if len(t.Operation) > 0 {
+		str = str + "." + t.Property + "." + t.Operation
+	} else if len(t.Property) > 0 {
 		str = str + "." + t.Property
 	}
-	if len(t.Operation) > 0 {
-		str = str + "." + t.Operation
+	if t.Flags&FlagSuccess != 0 {
+		str = str + " success"
+	}
+	if t.Flags&FlagFail != 0 {
+		str = str + " fail"
+	}
+	if t.Flags&FlagWeak != 0 {
+		str = str + " weak"
 	}
 	str = str + ">"
 	return str
@@ -71,7 +79,7 @@ func GetMeqaTag(desc string) *MeqaTag {
 	if len(desc) == 0 {
 		return nil
 	}
-	re := regexp.MustCompile("<meqa *[/-~\\-]+\\.?[/-~\\-]*\\.?[a-zA-Z]* *[a-zA-Z,]* *>")
+	re := regexp.MustCompile("<meqa *[/-~\\-]+\\.?[/-~\\-]*\\.?[a-zA-Z]*( +[a-zA-Z,]+)* *>")
 	ar := re.FindAllString(desc, -1)
 
 	// TODO it's possible that we have multiple choices because the server can't be
@@ -120,7 +128,7 @@ func GetMeqaTag(desc string) *MeqaTag {
 
 type Swagger spec.Swagger
 
-// Init from a file
+// Init from a file. Both swagger 2.0 and OpenAPI 3.0 documents are accepted.
 func CreateSwaggerFromURL(path string, meqaPath string) (*Swagger, error) {
 	tmpPath := filepath.Join(meqaPath, ".meqatmp")
 	os.Remove(tmpPath)
@@ -133,16 +141,22 @@ func CreateSwaggerFromURL(path string, meqaPath string) (*Swagger, error) {
 
 	// If input is yaml, transform to json
 	var swaggerJsonPath string
+	var jsonBytes []byte
 	ar := strings.Split(path, ".")
 	if ar[len(ar)-1] == "json" {
 		swaggerJsonPath = path
+		jsonBytes, err = ioutil.ReadFile(path)
+		if err != nil {
+			mqutil.Logger.Printf("can't read file %s", path)
+			return nil, err
+		}
 	} else {
 		yamlBytes, err := ioutil.ReadFile(path)
 		if err != nil {
 			mqutil.Logger.Printf("can't read file %s", path)
 			return nil, err
 		}
-		jsonBytes, err := mqutil.YamlToJson(yamlBytes)
+		jsonBytes, err = mqutil.YamlToJson(yamlBytes)
 		if err != nil {
 			mqutil.Logger.Printf("invalid yaml in file %s %v", path, err)
 			return nil, err
@@ -154,6 +168,10 @@ func CreateSwaggerFromURL(path string, meqaPath string) (*Swagger, error) {
 		}
 		swaggerJsonPath = tmpPath
 	}
+	// go-openapi only loads swagger 2.0, OpenAPI 3.0 is converted by us.
+	if IsOpenAPI3(jsonBytes) {
+		return CreateSwaggerFromOpenAPI3(jsonBytes)
+	}
 
 	specDoc, err := loads.Spec(swaggerJsonPath)
 	if err != nil {
@@ -199,7 +217,10 @@ func (swagger *Swagger) GetReferredSchema(schema *Schema) (string, *Schema, erro
 	if len(tokens) == 0 {
 		return "", nil, nil
 	}
-	if len(tokens) != 2 || tokens[0] != "definitions" {
+	// OpenAPI 3.0 keeps the schemas under components. They are loaded into definitions.
+	if len(tokens) == 3 && tokens[0] == "components" && tokens[1] == "schemas" {
+		tokens = tokens[1:]
+	} else if len(tokens) != 2 || tokens[0] != "definitions" {
 		return "", nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Invalid reference: %s", schema.Ref.GetURL()))
 	}
 	referredSchema := swagger.FindSchemaByName(tokens[1])
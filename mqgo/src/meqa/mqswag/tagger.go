@@ -0,0 +1,487 @@
+package mqswag
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/go-openapi/spec"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// This file infers the <meqa > tags for a spec that doesn't have them, so that test plans can be
+// generated without sending the spec to the meqa server. The heuristics are simple and name based:
+//   - a path is about the definition named by its last path element that is not a path param.
+//   - a path param is a property of the definition named by the path element right before it.
+//   - a field named like <definition><property> (e.g. petId) is that property of that definition.
+//   - an inline object whose fields are all in a definition is that definition.
+// Circular references between definitions are broken by marking one of the references weak.
+// Existing tags are never changed, so a partially tagged spec can be completed by the tagger.
+
+var meqaTagRE = regexp.MustCompile("<meqa [^>]*>")
+
+// Words in operation ids and summaries that tell us what a post operation does. Summaries are often
+// in the third person (e.g. "Updates a pet"), so those forms are listed too.
+var (
+	createWords = map[string]bool{"create": true, "creates": true, "add": true, "adds": true, "new": true,
+		"place": true, "places": true, "register": true, "registers": true}
+	updateWords = map[string]bool{"update": true, "updates": true, "modify": true, "modifies": true, "edit": true,
+		"edits": true, "change": true, "changes": true, "replace": true, "replaces": true, "upload": true, "uploads": true}
+	deleteWords = map[string]bool{"delete": true, "deletes": true, "remove": true, "removes": true}
+)
+
+// splitWords splits a name like "petId", "pet_id" or "PetID" into lower case words.
+func splitWords(name string) []string {
+	var words []string
+	var current []rune
+	runes := []rune(name)
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, strings.ToLower(string(current)))
+			current = nil
+		}
+	}
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		current = append(current, r)
+	}
+	flush()
+	return words
+}
+
+// singular turns a plural English word into its singular form, good enough for REST path names.
+func singular(word string) string {
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "sses"), strings.HasSuffix(word, "xes"), strings.HasSuffix(word, "ches"),
+		strings.HasSuffix(word, "shes"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") && len(word) > 3:
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+func wordsKey(words []string) string {
+	return strings.Join(words, "")
+}
+
+// addTag appends the tag to the description.
+func addTag(desc string, tag *MeqaTag) string {
+	return strings.TrimSpace(desc + " " + tag.ToString())
+}
+
+// typeMatches checks whether a parameter or property of type t can hold the values of the schema.
+func typeMatches(t string, schema *spec.Schema) bool {
+	if len(schema.Type) == 0 {
+		return false
+	}
+	st := schema.Type[0]
+	if st == t {
+		return true
+	}
+	numeric := map[string]bool{gojsonschema.TYPE_INTEGER: true, gojsonschema.TYPE_NUMBER: true}
+	return numeric[t] && numeric[st]
+}
+
+func isPrimitive(t string) bool {
+	return t == gojsonschema.TYPE_STRING || t == gojsonschema.TYPE_INTEGER || t == gojsonschema.TYPE_NUMBER ||
+		t == gojsonschema.TYPE_BOOLEAN
+}
+
+func sortedKeys(m map[string]spec.Schema) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type tagger struct {
+	swagger  *Swagger
+	defNames []string          // sorted, so that the result doesn't depend on map order
+	defKeys  map[string]string // normalized name -> definition name
+}
+
+func newTagger(swagger *Swagger) *tagger {
+	t := &tagger{swagger: swagger, defKeys: make(map[string]string)}
+	t.defNames = sortedKeys(swagger.Definitions)
+	for _, name := range t.defNames {
+		key := wordsKey(splitWords(name))
+		if _, ok := t.defKeys[key]; !ok {
+			t.defKeys[key] = name
+		}
+	}
+	return t
+}
+
+// findClass finds the definition the words refer to. The last word may be plural.
+func (t *tagger) findClass(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	if name, ok := t.defKeys[wordsKey(words)]; ok {
+		return name
+	}
+	singularWords := append(append([]string{}, words[:len(words)-1]...), singular(words[len(words)-1]))
+	return t.defKeys[wordsKey(singularWords)]
+}
+
+// findProperty finds the property of the class with the given name and a compatible type.
+func (t *tagger) findProperty(class string, name string, typeName string) string {
+	def, ok := t.swagger.Definitions[class]
+	if !ok {
+		return ""
+	}
+	key := wordsKey(splitWords(name))
+	for _, propName := range sortedKeys(def.Properties) {
+		prop := def.Properties[propName]
+		if wordsKey(splitWords(propName)) == key && typeMatches(typeName, &prop) {
+			return propName
+		}
+	}
+	return ""
+}
+
+// findClassProperty matches names like "petId" to the "id" property of the "Pet" definition. The
+// exclude class is never matched, a definition's fields are not references to itself.
+func (t *tagger) findClassProperty(name string, typeName string, exclude string) *MeqaTag {
+	words := splitWords(name)
+	for i := len(words) - 1; i > 0; i-- {
+		class := t.findClass(words[:i])
+		if len(class) == 0 || class == exclude {
+			continue
+		}
+		if prop := t.findProperty(class, wordsKey(words[i:]), typeName); len(prop) > 0 {
+			return &MeqaTag{class, prop, "", 0}
+		}
+	}
+	return nil
+}
+
+// findObjectClass finds the definition that has all the properties of the inline object schema.
+func (t *tagger) findObjectClass(schema *spec.Schema) string {
+	// Objects with just a couple of fields match too many definitions.
+	if len(schema.Properties) < 3 {
+		return ""
+	}
+	best := ""
+	bestExtra := 0
+	for _, name := range t.defNames {
+		def := t.swagger.Definitions[name]
+		if len(def.Properties) < len(schema.Properties) {
+			continue
+		}
+		contained := true
+		for propName := range schema.Properties {
+			if _, ok := def.Properties[propName]; !ok {
+				contained = false
+				break
+			}
+		}
+		if contained && (len(best) == 0 || len(def.Properties)-len(schema.Properties) < bestExtra) {
+			best = name
+			bestExtra = len(def.Properties) - len(schema.Properties)
+		}
+	}
+	return best
+}
+
+// tagProperties tags the primitive fields of an inline object schema. The fields are matched to
+// <definition><property> names, and failing that to the properties of the fallback class.
+func (t *tagger) tagProperties(schema *spec.Schema, exclude string, fallback string) {
+	if schema == nil {
+		return
+	}
+	if schema.Type.Contains(gojsonschema.TYPE_ARRAY) && schema.Items != nil && schema.Items.Schema != nil {
+		t.tagProperties(schema.Items.Schema, exclude, fallback)
+		return
+	}
+	for _, propName := range sortedKeys(schema.Properties) {
+		prop := schema.Properties[propName]
+		if prop.Ref.GetURL() != nil || GetMeqaTag(prop.Description) != nil || len(prop.Type) == 0 {
+			continue
+		}
+		if !isPrimitive(prop.Type[0]) {
+			t.tagProperties(&prop, exclude, "")
+		} else if tag := t.findClassProperty(propName, prop.Type[0], exclude); tag != nil {
+			prop.Description = addTag(prop.Description, tag)
+		} else if p := t.findProperty(fallback, propName, prop.Type[0]); len(p) > 0 {
+			prop.Description = addTag(prop.Description, &MeqaTag{fallback, p, "", 0})
+		}
+		schema.Properties[propName] = prop
+	}
+}
+
+func (t *tagger) tagDefinitions() {
+	for _, name := range t.defNames {
+		def := t.swagger.Definitions[name]
+		t.tagProperties(&def, name, "")
+		t.swagger.Definitions[name] = def
+	}
+}
+
+// pathClass returns the definition the path is about. If the last path element doesn't name a
+// definition, the elements before it are tried, and the returned bool is false.
+func (t *tagger) pathClass(pathName string) (string, bool) {
+	elements := strings.Split(pathName, "/")
+	last := true
+	for i := len(elements) - 1; i >= 0; i-- {
+		e := elements[i]
+		if len(e) == 0 || e[0] == '{' {
+			continue
+		}
+		if class := t.findClass(splitWords(e)); len(class) > 0 {
+			return class, last
+		}
+		last = false
+	}
+	return "", false
+}
+
+// paramClass returns the definition named by the path element right before the path param.
+func (t *tagger) paramClass(pathName string, paramName string) string {
+	elements := strings.Split(pathName, "/")
+	for i, e := range elements {
+		if e == "{"+paramName+"}" && i > 0 {
+			return t.findClass(splitWords(elements[i-1]))
+		}
+	}
+	return ""
+}
+
+func (t *tagger) tagParam(param *spec.Parameter, pathName string, class string) {
+	if GetMeqaTag(param.Description) != nil {
+		return
+	}
+	if param.In == "body" {
+		if param.Schema == nil || GetMeqaTag(param.Schema.Description) != nil {
+			return
+		}
+		if tag, _ := t.swagger.GetSchemaRootType((*Schema)(param.Schema), nil); tag != nil && len(tag.Class) > 0 {
+			param.Description = addTag(param.Description, &MeqaTag{tag.Class, "", "", 0})
+			return
+		}
+		if param.Schema.Type.Contains(gojsonschema.TYPE_OBJECT) {
+			if objClass := t.findObjectClass(param.Schema); len(objClass) > 0 {
+				param.Description = addTag(param.Description, &MeqaTag{objClass, "", "", 0})
+				return
+			}
+		}
+		t.tagProperties(param.Schema, "", class)
+		return
+	}
+	if !isPrimitive(param.Type) {
+		return
+	}
+	if tag := t.findClassProperty(param.Name, param.Type, ""); tag != nil {
+		param.Description = addTag(param.Description, tag)
+		return
+	}
+	if param.In == "path" {
+		if c := t.paramClass(pathName, param.Name); len(c) > 0 {
+			class = c
+		}
+	}
+	if len(class) == 0 {
+		return
+	}
+	prop := t.findProperty(class, param.Name, param.Type)
+	if len(prop) == 0 && param.In == "path" && strings.HasSuffix(strings.ToLower(param.Name), "id") {
+		// e.g. /users/{uid}
+		prop = t.findProperty(class, "id", param.Type)
+	}
+	if len(prop) > 0 {
+		param.Description = addTag(param.Description, &MeqaTag{class, prop, "", 0})
+	}
+}
+
+// opMethod guesses the REST method a post operation really is. Post is often used to update an
+// existing object, or to do something with it.
+func opMethod(op *spec.Operation, pathName string, method string, onPathClass bool) string {
+	if method != MethodPost {
+		return ""
+	}
+	words := append(splitWords(op.ID), splitWords(op.Summary)...)
+	for _, w := range words {
+		if deleteWords[w] {
+			return MethodDelete
+		}
+	}
+	for _, w := range words {
+		if createWords[w] {
+			return ""
+		}
+	}
+	for _, w := range words {
+		if updateWords[w] {
+			return MethodPut
+		}
+	}
+	elements := strings.Split(strings.TrimSuffix(pathName, "/"), "/")
+	if last := elements[len(elements)-1]; !onPathClass || (len(last) > 0 && last[0] == '{') {
+		return MethodPut
+	}
+	return ""
+}
+
+func (t *tagger) tagOperation(op *spec.Operation, pathName string, method string) {
+	class, onPathClass := t.pathClass(pathName)
+	if len(class) > 0 && GetMeqaTag(op.Description) == nil {
+		op.Description = addTag(op.Description, &MeqaTag{class, "", opMethod(op, pathName, method, onPathClass), 0})
+	}
+	for i := range op.Parameters {
+		t.tagParam(&op.Parameters[i], pathName, class)
+	}
+	if op.Responses == nil {
+		return
+	}
+	for code, resp := range op.Responses.StatusCodeResponses {
+		if code >= 200 && code < 300 && resp.Schema != nil && resp.Schema.Ref.GetURL() == nil {
+			t.tagProperties(resp.Schema, "", "")
+		}
+	}
+}
+
+func (t *tagger) tagPaths() {
+	if t.swagger.Paths == nil {
+		return
+	}
+	var pathNames []string
+	for pathName := range t.swagger.Paths.Paths {
+		pathNames = append(pathNames, pathName)
+	}
+	sort.Strings(pathNames)
+	for _, pathName := range pathNames {
+		pathItem := t.swagger.Paths.Paths[pathName]
+		for _, method := range MethodAll {
+			opInterface, err := pathItem.JSONLookup(method)
+			if err != nil {
+				continue
+			}
+			if op := opInterface.(*spec.Operation); op != nil {
+				t.tagOperation(op, pathName, method)
+			}
+		}
+		class, _ := t.pathClass(pathName)
+		for i := range pathItem.Parameters {
+			t.tagParam(&pathItem.Parameters[i], pathName, class)
+		}
+		t.swagger.Paths.Paths[pathName] = pathItem
+	}
+}
+
+// reference is a field of a definition that refers to another definition, either through a $ref
+// or through a tag. Properties are stored by value, so we keep the map and the key to update them.
+type reference struct {
+	class      string
+	properties map[string]spec.Schema
+	name       string
+	schema     *spec.Schema
+}
+
+// markWeak marks the reference weak, so that it's not followed when the dependencies are computed.
+func (ref *reference) markWeak() {
+	schema := ref.schema
+	if ref.properties != nil {
+		s := ref.properties[ref.name]
+		schema = &s
+	}
+	if tag := GetMeqaTag(schema.Description); tag != nil {
+		tag.Flags |= FlagWeak
+		schema.Description = meqaTagRE.ReplaceAllLiteralString(schema.Description, tag.ToString())
+	} else {
+		schema.Description = addTag(schema.Description, &MeqaTag{ref.class, "", "", FlagWeak})
+	}
+	if ref.properties != nil {
+		ref.properties[ref.name] = *schema
+	}
+}
+
+// collectReferences collects the references in the schema, which is found at the location loc.
+func (t *tagger) collectReferences(schema *spec.Schema, self string, loc reference, refs *[]reference) {
+	if schema == nil {
+		return
+	}
+	tag := GetMeqaTag(schema.Description)
+	if tag != nil && tag.Flags&FlagWeak != 0 {
+		return
+	}
+	if name, _, _ := t.swagger.GetReferredSchema((*Schema)(schema)); len(name) > 0 {
+		if name != self {
+			loc.class = name
+			*refs = append(*refs, loc)
+		}
+		return
+	}
+	if tag != nil && len(tag.Class) > 0 && tag.Class != self {
+		loc.class = tag.Class
+		*refs = append(*refs, loc)
+	}
+	if schema.Items != nil && schema.Items.Schema != nil {
+		t.collectReferences(schema.Items.Schema, self, reference{schema: schema.Items.Schema}, refs)
+	}
+	for _, propName := range sortedKeys(schema.Properties) {
+		prop := schema.Properties[propName]
+		t.collectReferences(&prop, self, reference{properties: schema.Properties, name: propName}, refs)
+	}
+}
+
+// breakCycles marks weak the references that close a dependency cycle between definitions.
+func (t *tagger) breakCycles() {
+	refMap := make(map[string][]reference)
+	for _, name := range t.defNames {
+		def := t.swagger.Definitions[name]
+		var refs []reference
+		t.collectReferences(&def, name, reference{properties: t.swagger.Definitions, name: name}, &refs)
+		refMap[name] = refs
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		for _, ref := range refMap[name] {
+			switch state[ref.class] {
+			case visiting:
+				ref.markWeak()
+			case unvisited:
+				if _, ok := t.swagger.Definitions[ref.class]; ok {
+					visit(ref.class)
+				}
+			}
+		}
+		state[name] = visited
+	}
+	for _, name := range t.defNames {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+}
+
+// AddTags infers the meqa tags for the definitions, operations and parameters that don't have them.
+func (swagger *Swagger) AddTags() {
+	t := newTagger(swagger)
+	t.tagDefinitions()
+	t.tagPaths()
+	t.breakCycles()
+}
@@ -0,0 +1,241 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+const untaggedSwagger = `{
+  "swagger": "2.0",
+  "paths": {
+    "/pets": {
+      "post": {"operationId": "addPet", "parameters": [{"name": "body", "in": "body", "schema": {"$ref": "#/definitions/Pet"}}]}
+    },
+    "/pets/{petId}": {
+      "get": {"parameters": [{"name": "petId", "in": "path", "type": "integer"}]},
+      "post": {"operationId": "updatePetWithForm", "parameters": [{"name": "name", "in": "formData", "type": "string"}]},
+      "delete": {"description": "<meqa Pet..delete>", "parameters": [{"name": "petId", "in": "path", "type": "integer",
+        "description": "<meqa Category.id>"}]}
+    },
+    "/pets/{petId}/sell": {
+      "post": {"operationId": "sellPet"}
+    },
+    "/users/{uid}": {
+      "parameters": [{"name": "uid", "in": "path", "type": "integer"}],
+      "get": {}
+    },
+    "/store/order": {
+      "post": {
+        "operationId": "placeOrder",
+        "parameters": [{"name": "body", "in": "body", "schema": {"type": "object", "properties": {
+          "petId": {"type": "integer"}, "quantity": {"type": "integer"}, "status": {"type": "string"}}}}],
+        "responses": {"200": {"description": "ok", "schema": {"type": "object", "properties": {
+          "orderId": {"type": "integer"}, "note": {"type": "string"}}}}}
+      }
+    }
+  },
+  "definitions": {
+    "Category": {"type": "object", "properties": {"id": {"type": "integer"}, "name": {"type": "string"}}},
+    "Pet": {"type": "object", "properties": {
+      "id": {"type": "integer"},
+      "name": {"type": "string"},
+      "category": {"$ref": "#/definitions/Category"},
+      "owner": {"$ref": "#/definitions/User"}
+    }},
+    "User": {"type": "object", "properties": {
+      "id": {"type": "integer"},
+      "pets": {"type": "array", "items": {"$ref": "#/definitions/Pet"}}
+    }},
+    "Order": {"type": "object", "properties": {
+      "id": {"type": "integer"},
+      "petId": {"type": "integer"},
+      "quantity": {"type": "integer"},
+      "status": {"type": "string"}
+    }}
+  }
+}`
+
+func TestSplitWords(t *testing.T) {
+	cases := map[string][]string{
+		"petId":      {"pet", "id"},
+		"pet_id":     {"pet", "id"},
+		"PetID":      {"pet", "id"},
+		"HTTPServer": {"http", "server"},
+		"user2Name":  {"user2", "name"},
+		"order-item": {"order", "item"},
+		"":           nil,
+	}
+	for name, expected := range cases {
+		if words := splitWords(name); !stringsEqual(words, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, words)
+		}
+	}
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSingular(t *testing.T) {
+	cases := map[string]string{
+		"pets":       "pet",
+		"categories": "category",
+		"addresses":  "address",
+		"boxes":      "box",
+		"branches":   "branch",
+		"status":     "status",
+		"class":      "class",
+		"bus":        "bus",
+		"pet":        "pet",
+	}
+	for word, expected := range cases {
+		if s := singular(word); s != expected {
+			t.Errorf("%s: expected %s, got %s", word, expected, s)
+		}
+	}
+}
+
+func TestOpMethod(t *testing.T) {
+	cases := []struct {
+		id          string
+		summary     string
+		path        string
+		method      string
+		onPathClass bool
+		expected    string
+	}{
+		{"addPet", "", "/pets", MethodPost, true, ""},
+		{"deletePet", "", "/pets", MethodPost, true, MethodDelete},
+		{"", "Updates a pet", "/pets", MethodPost, true, MethodPut},
+		{"", "Deletes a pet", "/pets", MethodPost, true, MethodDelete},
+		{"", "Modifies the status of a pet", "/pets/{petId}", MethodPost, true, MethodPut},
+		// Only the listed forms of the words count, "news" isn't "new" and "process" isn't anything.
+		{"updateNews", "", "/news", MethodPost, true, MethodPut},
+		{"processOrders", "", "/orders", MethodPost, true, ""},
+		{"createOrUpdatePet", "", "/pets", MethodPost, true, ""},
+		{"sellPet", "", "/pets/{petId}", MethodPost, true, MethodPut},
+		{"sellPet", "", "/pets/{petId}/sell", MethodPost, false, MethodPut},
+		{"findPets", "", "/pets", MethodPost, true, ""},
+		{"deletePet", "", "/pets/{petId}", MethodGet, true, ""},
+	}
+	for _, c := range cases {
+		op := &spec.Operation{}
+		op.ID = c.id
+		op.Summary = c.summary
+		if m := opMethod(op, c.path, c.method, c.onPathClass); m != c.expected {
+			t.Errorf("%s %s %s: expected %q, got %q", c.id, c.summary, c.path, c.expected, m)
+		}
+	}
+}
+
+func TestMeqaTagToString(t *testing.T) {
+	tags := []*MeqaTag{
+		{"Pet", "", "", 0},
+		{"Pet", "id", "", FlagWeak},
+		{"Pet", "", MethodPut, FlagSuccess},
+		{"Pet", "name", MethodPost, FlagFail | FlagWeak},
+	}
+	expected := []string{"<meqa Pet>", "<meqa Pet.id weak>", "<meqa Pet..put success>", "<meqa Pet.name.post fail weak>"}
+	for i, tag := range tags {
+		str := tag.ToString()
+		if str != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], str)
+		}
+		if parsed := GetMeqaTag(str); parsed == nil || !parsed.Equals(tag) || parsed.Flags != tag.Flags {
+			t.Errorf("%s: unexpected round trip %v", str, parsed)
+		}
+	}
+}
+
+func TestAddTags(t *testing.T) {
+	swagger := &Swagger{}
+	if err := json.Unmarshal([]byte(untaggedSwagger), (*spec.Swagger)(swagger)); err != nil {
+		t.Fatal(err)
+	}
+	swagger.AddTags()
+
+	checkTag := func(what string, desc string, expected *MeqaTag) {
+		tag := GetMeqaTag(desc)
+		if expected == nil {
+			if tag != nil {
+				t.Errorf("%s: expected no tag, got %s", what, desc)
+			}
+			return
+		}
+		if tag == nil || !tag.Equals(expected) || tag.Flags != expected.Flags {
+			t.Errorf("%s: expected %s, got %q", what, expected.ToString(), desc)
+		}
+	}
+
+	paths := swagger.Paths.Paths
+	addPet := paths["/pets"].Post
+	checkTag("post /pets", addPet.Description, &MeqaTag{"Pet", "", "", 0})
+	checkTag("post /pets body", addPet.Parameters[0].Description, &MeqaTag{"Pet", "", "", 0})
+
+	petPath := paths["/pets/{petId}"]
+	checkTag("get /pets/{petId}", petPath.Get.Description, &MeqaTag{"Pet", "", "", 0})
+	checkTag("get /pets/{petId} petId", petPath.Get.Parameters[0].Description, &MeqaTag{"Pet", "id", "", 0})
+	checkTag("post /pets/{petId}", petPath.Post.Description, &MeqaTag{"Pet", "", MethodPut, 0})
+	checkTag("post /pets/{petId} name", petPath.Post.Parameters[0].Description, &MeqaTag{"Pet", "name", "", 0})
+	// The existing tags are kept.
+	checkTag("delete /pets/{petId}", petPath.Delete.Description, &MeqaTag{"Pet", "", MethodDelete, 0})
+	checkTag("delete /pets/{petId} petId", petPath.Delete.Parameters[0].Description, &MeqaTag{"Category", "id", "", 0})
+
+	checkTag("post /pets/{petId}/sell", paths["/pets/{petId}/sell"].Post.Description, &MeqaTag{"Pet", "", MethodPut, 0})
+
+	userPath := paths["/users/{uid}"]
+	checkTag("get /users/{uid}", userPath.Get.Description, &MeqaTag{"User", "", "", 0})
+	checkTag("/users/{uid} uid", userPath.Parameters[0].Description, &MeqaTag{"User", "id", "", 0})
+
+	// The inline object has the fields of an order.
+	placeOrder := paths["/store/order"].Post
+	checkTag("post /store/order", placeOrder.Description, &MeqaTag{"Order", "", "", 0})
+	checkTag("post /store/order body", placeOrder.Parameters[0].Description, &MeqaTag{"Order", "", "", 0})
+	response := placeOrder.Responses.StatusCodeResponses[200].Schema
+	checkTag("post /store/order orderId", response.Properties["orderId"].Description, &MeqaTag{"Order", "id", "", 0})
+	checkTag("post /store/order note", response.Properties["note"].Description, nil)
+
+	// The fields named after another definition refer to it, the others don't.
+	order := swagger.Definitions["Order"]
+	checkTag("Order.petId", order.Properties["petId"].Description, &MeqaTag{"Pet", "id", "", 0})
+	checkTag("Order.id", order.Properties["id"].Description, nil)
+	checkTag("Order.quantity", order.Properties["quantity"].Description, nil)
+
+	// Pet -> User -> Pet is broken by making the reference that closes the cycle weak.
+	checkTag("Pet.owner", swagger.Definitions["Pet"].Properties["owner"].Description, nil)
+	checkTag("Pet.category", swagger.Definitions["Pet"].Properties["category"].Description, nil)
+	checkTag("User.pets", swagger.Definitions["User"].Properties["pets"].Items.Schema.Description, &MeqaTag{"Pet", "", "", FlagWeak})
+
+	// The tags are stable, tagging again changes nothing.
+	before, _ := json.Marshal((*spec.Swagger)(swagger))
+	swagger.AddTags()
+	after, _ := json.Marshal((*spec.Swagger)(swagger))
+	if string(before) != string(after) {
+		t.Errorf("expected tagging a tagged spec to change nothing:\n%s\n%s", before, after)
+	}
+}
+
+func TestAddTagsDAG(t *testing.T) {
+	swagger := &Swagger{}
+	if err := json.Unmarshal([]byte(untaggedSwagger), (*spec.Swagger)(swagger)); err != nil {
+		t.Fatal(err)
+	}
+	swagger.AddTags()
+	// With the cycle broken the definitions can be added to the DAG.
+	dag := NewDAG()
+	if err := swagger.AddToDAG(dag); err != nil {
+		t.Fatal(err)
+	}
+	dag.Sort()
+	dag.CheckWeight()
+}
@@ -15,6 +15,17 @@ const (
 	ErrInternal          // unexpected internal error (meqa error)
 )
 
+// ErrTypeNames are the names of the error types, used in reports.
+var ErrTypeNames = map[int]string{
+	ErrOK:         "ok",
+	ErrInvalid:    "invalid",
+	ErrNotFound:   "notFound",
+	ErrExpect:     "expect",
+	ErrHttp:       "http",
+	ErrServerResp: "serverResp",
+	ErrInternal:   "internal",
+}
+
 // Error implements MQ specific error type.
 type Error interface {
 	error
@@ -25,6 +36,7 @@ type Error interface {
 type TypedError struct {
 	errType int
 	errMsg  string
+	msg     string // the message without the back trace
 }
 
 func (e *TypedError) Error() string {
@@ -35,9 +47,22 @@ func (e *TypedError) Type() int {
 	return e.errType
 }
 
+// Message returns the error message without the back trace.
+func (e *TypedError) Message() string {
+	return e.msg
+}
+
 func NewError(errType int, str string) error {
 	buf := string(debug.Stack())
-	err := TypedError{errType, ""}
+	err := TypedError{errType, "", str}
 	err.errMsg = fmt.Sprintf("==== %v ====\nError message:\n%s\nBacktrace:%v", errType, str, buf)
 	return &err
 }
+
+// ErrorMessage returns the error message of err, without the back trace for TypedError.
+func ErrorMessage(err error) string {
+	if e, ok := err.(*TypedError); ok {
+		return e.Message()
+	}
+	return err.Error()
+}
@@ -9,11 +9,13 @@ import (
 
 // Test results constants
 const (
-	Passed         = "Passed"
-	Failed         = "Failed"
-	Skipped        = "Skipped"
-	SchemaMismatch = "SchemaMismatch"
-	Total          = "Total"
+	Passed           = "Passed"
+	Failed           = "Failed"
+	Skipped          = "Skipped"
+	SkippedDependent = "SkippedDependent" // the tests skipped because they refer to the tests that failed
+	SchemaMismatch   = "SchemaMismatch"
+	TeardownFailed   = "TeardownFailed" // the teardown tests that failed, they are not counted in the total
+	Total            = "Total"
 )
 
 // Colors for better logging
@@ -26,8 +28,9 @@ const (
 	END    = "\033[0m"
 )
 
+// NewLogger creates the logger. The secret values are masked in the log.
 func NewLogger(out io.Writer) *log.Logger {
-	Logger = log.New(out, "", (log.Ldate | log.Lmicroseconds | log.Lshortfile))
+	Logger = log.New(secretWriter{out}, "", (log.Ldate | log.Lmicroseconds | log.Lshortfile))
 	return Logger
 }
 
@@ -13,6 +13,10 @@ import (
 )
 
 func InterfaceToJsonString(i interface{}) string {
+	if str, ok := i.(string); ok {
+		// Strings are sent as they are, not json escaped.
+		return str
+	}
 	b, _ := json.Marshal(i)
 	if b[0] == '"' {
 		return string(b[1 : len(b)-1]) // remove the ""
@@ -164,7 +168,7 @@ func InterfacePrint(m interface{}, printToConsole bool) {
 	yamlBytes, _ := yaml.Marshal(m)
 	Logger.Print(string(yamlBytes))
 	if printToConsole {
-		fmt.Println(string(yamlBytes))
+		fmt.Println(MaskSecrets(string(yamlBytes)))
 	}
 }
 
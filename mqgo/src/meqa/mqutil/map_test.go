@@ -0,0 +1,29 @@
+package mqutil
+
+import (
+	"testing"
+)
+
+func TestMapInterfaceToMapString(t *testing.T) {
+	params := map[string]interface{}{
+		"name":   `a "quoted" <name> & \ more`,
+		"id":     12,
+		"ok":     true,
+		"tags":   []interface{}{"x,y", 3},
+		"filter": map[string]interface{}{"status": "sold"},
+	}
+	expected := map[string]string{
+		"name":   `a "quoted" <name> & \ more`,
+		"id":     "12",
+		"ok":     "true",
+		"tags":   "x,y,3",
+		"filter": `{"status":"sold"}`,
+	}
+	// The strings are sent as they are, not JSON escaped.
+	dst := MapInterfaceToMapString(params)
+	for k, v := range expected {
+		if dst[k] != v {
+			t.Errorf("%s: expected %s, got %s", k, v, dst[k])
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package mqutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SecretMask is what the secret values are replaced with in the output.
+const SecretMask = "******"
+
+var secrets struct {
+	values []string // longest first, so a secret containing another is masked as a whole
+	mutex  sync.RWMutex
+}
+
+// The reports escape the secrets in JSON, XML or HTML before they are masked, so the escaped forms are
+// masked too.
+var secretEscapes = []func(string) string{escapeJSON, escapeXML, escapeHTML}
+
+func escapeJSON(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1]) // remove the ""
+}
+
+func escapeXML(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+var htmlText = template.Must(template.New("text").Parse("{{.}}"))
+
+func escapeHTML(s string) string {
+	var buf bytes.Buffer
+	htmlText.Execute(&buf, s)
+	return buf.String()
+}
+
+// AddSecret makes MaskSecrets hide the value from now on.
+func AddSecret(value string) {
+	if len(value) == 0 {
+		return
+	}
+	secrets.mutex.Lock()
+	defer secrets.mutex.Unlock()
+	forms := []string{value}
+	for _, escape := range secretEscapes {
+		forms = append(forms, escape(value))
+	}
+	for _, form := range forms {
+		found := false
+		for _, v := range secrets.values {
+			if v == form {
+				found = true
+				break
+			}
+		}
+		if !found {
+			secrets.values = append(secrets.values, form)
+		}
+	}
+	sort.SliceStable(secrets.values, func(i, j int) bool {
+		return len(secrets.values[i]) > len(secrets.values[j])
+	})
+}
+
+// MaskSecrets replaces the secret values in the string with the mask, escaped or not.
+func MaskSecrets(s string) string {
+	secrets.mutex.RLock()
+	defer secrets.mutex.RUnlock()
+	for _, v := range secrets.values {
+		s = strings.Replace(s, v, SecretMask, -1)
+	}
+	return s
+}
+
+// secretWriter masks the secrets in what is written to it.
+type secretWriter struct {
+	out io.Writer
+}
+
+func (w secretWriter) Write(p []byte) (int, error) {
+	if _, err := w.out.Write([]byte(MaskSecrets(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,43 @@
+package mqutil
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMaskSecrets(t *testing.T) {
+	AddSecret("")
+	AddSecret("tok")
+	AddSecret("token-1234")
+	AddSecret("tok")
+	if masked := MaskSecrets("no secret here"); masked != "no secret here" {
+		t.Errorf("unexpected mask: %s", masked)
+	}
+	// The longer secret is masked as a whole, not around the shorter one it contains.
+	if masked := MaskSecrets("Bearer token-1234, tok"); masked != "Bearer "+SecretMask+", "+SecretMask {
+		t.Errorf("unexpected mask: %s", masked)
+	}
+}
+
+func TestLoggerMasksSecrets(t *testing.T) {
+	AddSecret("log-secret")
+	var out bytes.Buffer
+	logger := NewLogger(&out)
+	defer NewStdLogger()
+	logger.Printf("sending api_key log-secret")
+	if log := out.String(); strings.Contains(log, "log-secret") || !strings.Contains(log, "sending api_key "+SecretMask) {
+		t.Errorf("the secret isn't masked in the log: %s", log)
+	}
+}
+
+func TestMaskEscapedSecrets(t *testing.T) {
+	// The reports escape the secret before it's masked.
+	AddSecret(`p&ss<w>rd"+1`)
+	for _, escaped := range []string{`p&ss<w>rd"+1`, `p\u0026ss\u003cw\u003erd\"+1`, "p&amp;ss&lt;w&gt;rd&#34;+1",
+		"p&amp;ss&lt;w&gt;rd&#34;&#43;1"} {
+		if masked := MaskSecrets("password " + escaped); masked != "password "+SecretMask {
+			t.Errorf("%s: unexpected mask: %s", escaped, masked)
+		}
+	}
+}